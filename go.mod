@@ -13,7 +13,6 @@ require (
 	github.com/iopred/bruxism v0.0.0-20221206114111-7a7262c31e85
 	github.com/pkg/errors v0.9.1
 	github.com/stretchr/testify v1.9.0
-	github.com/tj/go-naturaldate v1.3.0
 	github.com/voldyman/bitstats v0.0.0-20221002022302-5b42b685b384
 	gonum.org/v1/plot v0.14.0
 )
@@ -0,0 +1,176 @@
+package musicplugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// metadataTTL is how long resolved song metadata for a query stays valid.
+const metadataTTL = 7 * 24 * time.Hour
+
+// streamTTL is used for stream URLs that don't carry their own expiry.
+const streamTTL = 5 * time.Hour
+
+type cachedQuery struct {
+	Songs   []song
+	Expires time.Time
+}
+
+type cachedStream struct {
+	URL     string
+	Expires time.Time
+}
+
+// trackCache maps youtube-dl queries/URLs to resolved songs and song IDs to
+// direct stream URLs. It is persisted next to the plugin state.
+type trackCache struct {
+	sync.Mutex
+	path string
+
+	Queries map[string]*cachedQuery
+	Streams map[string]*cachedStream
+
+	queryHits, queryMisses   int
+	streamHits, streamMisses int
+}
+
+func newTrackCache() *trackCache {
+	return &trackCache{
+		Queries: map[string]*cachedQuery{},
+		Streams: map[string]*cachedStream{},
+	}
+}
+
+// load reads the cache from path, later saves will write to the same path.
+func (c *trackCache) load(path string) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.path = path
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Println("tunesplugin: reading cache err:", err)
+		}
+		return
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		log.Println("tunesplugin: loading cache err:", err)
+	}
+	if c.Queries == nil {
+		c.Queries = map[string]*cachedQuery{}
+	}
+	if c.Streams == nil {
+		c.Streams = map[string]*cachedStream{}
+	}
+}
+
+func (c *trackCache) save() error {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.path == "" {
+		return nil
+	}
+	c.prune(time.Now())
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, data, os.ModePerm)
+}
+
+// prune removes expired entries, caller must hold the lock.
+func (c *trackCache) prune(now time.Time) {
+	for k, q := range c.Queries {
+		if now.After(q.Expires) {
+			delete(c.Queries, k)
+		}
+	}
+	for k, s := range c.Streams {
+		if now.After(s.Expires) {
+			delete(c.Streams, k)
+		}
+	}
+}
+
+func (c *trackCache) songs(query string) ([]song, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	q, ok := c.Queries[query]
+	if !ok || time.Now().After(q.Expires) {
+		c.queryMisses++
+		return nil, false
+	}
+	c.queryHits++
+
+	songs := make([]song, len(q.Songs))
+	copy(songs, q.Songs)
+	return songs, true
+}
+
+func (c *trackCache) putSongs(query string, songs []song) {
+	if len(songs) == 0 {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+
+	c.Queries[query] = &cachedQuery{
+		Songs:   songs,
+		Expires: time.Now().Add(metadataTTL),
+	}
+}
+
+func (c *trackCache) stream(songID string) (string, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	s, ok := c.Streams[songID]
+	if !ok || time.Now().After(s.Expires) {
+		c.streamMisses++
+		return "", false
+	}
+	c.streamHits++
+	return s.URL, true
+}
+
+func (c *trackCache) putStream(songID, streamURL string) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.Streams[songID] = &cachedStream{
+		URL:     streamURL,
+		Expires: streamExpiry(streamURL, time.Now()),
+	}
+}
+
+func (c *trackCache) String() string {
+	c.Lock()
+	defer c.Unlock()
+
+	return fmt.Sprintf("`Cached Queries:` %d (%d hits, %d misses)\n`Cached Streams:` %d (%d hits, %d misses)\n",
+		len(c.Queries), c.queryHits, c.queryMisses, len(c.Streams), c.streamHits, c.streamMisses)
+}
+
+// streamExpiry uses the "expire" unix timestamp that youtube puts on its
+// stream URLs, with a margin so that a song doesn't expire mid-playback.
+func streamExpiry(streamURL string, now time.Time) time.Time {
+	u, err := url.Parse(streamURL)
+	if err != nil {
+		return now.Add(streamTTL)
+	}
+	expire, err := strconv.ParseInt(u.Query().Get("expire"), 10, 64)
+	if err != nil {
+		return now.Add(streamTTL)
+	}
+	return time.Unix(expire, 0).Add(-1 * time.Hour)
+}
@@ -0,0 +1,52 @@
+package musicplugin
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStreamExpiry(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cases := []struct {
+		name string
+		url  string
+		want time.Time
+	}{
+		{"expire param", "https://rr1.googlevideo.com/videoplayback?expire=1700020000&id=abc", time.Unix(1700020000, 0).Add(-1 * time.Hour)},
+		{"no expire param", "https://example.com/song.webm", now.Add(streamTTL)},
+		{"bad expire param", "https://example.com/song.webm?expire=soon", now.Add(streamTTL)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := streamExpiry(c.url, now); !got.Equal(c.want) {
+				t.Fatalf("expected expiry %v, got %v", c.want, got)
+			}
+		})
+	}
+}
+
+func TestTrackCachePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tunes.cache")
+
+	c := newTrackCache()
+	c.load(path)
+	if _, ok := c.songs("ytsearch:never gonna give you up"); ok {
+		t.Fatal("expected empty cache to miss")
+	}
+	c.putSongs("ytsearch:never gonna give you up", []song{{ID: "dQw4w9WgXcQ", Title: "Never Gonna Give You Up"}})
+	if err := c.save(); err != nil {
+		t.Fatalf("unable to save cache: %+v", err)
+	}
+
+	loaded := newTrackCache()
+	loaded.load(path)
+	songs, ok := loaded.songs("ytsearch:never gonna give you up")
+	if !ok || len(songs) != 1 || songs[0].ID != "dQw4w9WgXcQ" {
+		t.Fatalf("expected cached song after reload, got %+v", songs)
+	}
+	if loaded.queryHits != 1 {
+		t.Fatalf("expected 1 cache hit, got %d", loaded.queryHits)
+	}
+}
@@ -0,0 +1,122 @@
+package musicplugin
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// importProgressInterval is the number of songs added between edits of the
+// progress message.
+const importProgressInterval = 10
+
+// maxReportedFailures limits how many failed entries are listed in the
+// import summary.
+const maxReportedFailures = 10
+
+// runImport resolves the queries and adds the songs to the queue, editing a
+// progress message in channelID as it goes.
+func (p *MusicPlugin) runImport(ctx context.Context, vc *voiceConnection, queries []string, channelID, addedBy string) {
+	defer func() {
+		vc.Lock()
+		cancel := vc.importing
+		vc.importing = nil
+		vc.Unlock()
+
+		if cancel != nil {
+			cancel()
+		}
+	}()
+
+	session := p.discord.Session
+	progress, err := session.ChannelMessageSend(channelID, "Looking up songs...")
+	if err != nil {
+		log.Println("tunesplugin: sending import progress err:", err)
+	}
+
+	report := func(msg string) {
+		if progress == nil {
+			if _, err := session.ChannelMessageSend(channelID, msg); err != nil {
+				log.Println("tunesplugin: sending import summary err:", err)
+			}
+			return
+		}
+		if _, err := session.ChannelMessageEdit(channelID, progress.ID, msg); err != nil {
+			log.Println("tunesplugin: editing import progress err:", err)
+		}
+	}
+
+	added := []song{}
+	failures := []string{}
+	for _, query := range queries {
+		failed, err := p.resolve(ctx, query, vc.debug, func(s song) {
+			s.AddedBy = addedBy
+
+			vc.Lock()
+			vc.Queue = append(vc.Queue, s)
+			vc.Unlock()
+
+			added = append(added, s)
+			if len(added)%importProgressInterval == 0 {
+				report(fmt.Sprintf("Looking up songs... %d added so far.", len(added)))
+			}
+		})
+		failures = append(failures, failed...)
+
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			log.Println("tunesplugin: resolve err:", err)
+			failures = append(failures, fmt.Sprintf("%s: %s", query, err))
+		}
+	}
+
+	report(importSummary(added, failures, ctx.Err() != nil))
+}
+
+func importSummary(added []song, failures []string, cancelled bool) string {
+	var msg string
+	switch {
+	case len(added) == 0:
+		msg = "No songs were added"
+	case len(added) == 1:
+		msg = fmt.Sprintf("Added song: %s", added[0].Title)
+	default:
+		msg = fmt.Sprintf("Added song: %s and %d others", added[0].Title, len(added)-1)
+	}
+
+	if cancelled {
+		msg += ", import cancelled."
+	} else {
+		msg += "."
+	}
+
+	if len(failures) == 0 {
+		return msg
+	}
+
+	msg += fmt.Sprintf("\n%d entries failed:", len(failures))
+	for i, f := range failures {
+		if i >= maxReportedFailures {
+			msg += fmt.Sprintf("\n...and %d more.", len(failures)-maxReportedFailures)
+			break
+		}
+		msg += "\n`" + f + "`"
+	}
+	return msg
+}
+
+// youtubeDLErrors extracts the error lines that youtube-dl prints for
+// entries it was unable to resolve.
+func youtubeDLErrors(stderr string) []string {
+	errs := []string{}
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "ERROR:") {
+			errs = append(errs, strings.TrimSpace(strings.TrimPrefix(line, "ERROR:")))
+		}
+	}
+	return errs
+}
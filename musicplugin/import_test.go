@@ -0,0 +1,115 @@
+package musicplugin
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImportSummary(t *testing.T) {
+	songs := []song{{Title: "one"}, {Title: "two"}, {Title: "three"}}
+	cases := []struct {
+		name      string
+		added     []song
+		failures  []string
+		cancelled bool
+		result    string
+	}{
+		{"nothing added", nil, nil, false, "No songs were added."},
+		{"single song", songs[:1], nil, false, "Added song: one."},
+		{"playlist", songs, nil, false, "Added song: one and 2 others."},
+		{"cancelled", songs[:2], nil, true, "Added song: one and 1 others, import cancelled."},
+		{"failures", songs[:1], []string{"[youtube] abc: Video unavailable"}, false, "Added song: one.\n1 entries failed:\n`[youtube] abc: Video unavailable`"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := importSummary(c.added, c.failures, c.cancelled); got != c.result {
+				t.Fatalf("expected '%s' but got '%s'", c.result, got)
+			}
+		})
+	}
+}
+
+func TestYoutubeDLErrors(t *testing.T) {
+	stderr := "WARNING: unable to extract uploader\nERROR: [youtube] abc: Video unavailable\n\nERROR: [youtube] def: Private video\n"
+	expected := []string{"[youtube] abc: Video unavailable", "[youtube] def: Private video"}
+
+	if got := youtubeDLErrors(stderr); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %+v but got %+v", expected, got)
+	}
+}
+
+// fakeYoutubeDL replaces youtube-dl with a shell script for the test.
+func fakeYoutubeDL(t *testing.T, script string) {
+	path := filepath.Join(t.TempDir(), "youtube-dl")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatalf("unable to write fake youtube-dl: %+v", err)
+	}
+	old := youtubeDL
+	youtubeDL = path
+	t.Cleanup(func() { youtubeDL = old })
+}
+
+func TestResolveLongOutput(t *testing.T) {
+	// a line longer than is read, followed by more than the pipe holds
+	fakeYoutubeDL(t, `echo '{"id": "a", "title": "one"}'
+head -c 5000000 /dev/zero | tr '\0' x
+echo
+yes '{"id": "b", "title": "two"}' | head -n 100000
+`)
+	p := &MusicPlugin{cache: newTrackCache()}
+
+	type result struct {
+		songs    []song
+		failures []string
+		err      error
+	}
+	done := make(chan result)
+	go func() {
+		r := result{}
+		r.failures, r.err = p.resolve(context.Background(), "playlist", false, func(s song) {
+			r.songs = append(r.songs, s)
+		})
+		done <- r
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			t.Fatalf("unexpected error: %+v", r.err)
+		}
+		if len(r.songs) != 1 || r.songs[0].ID != "a" {
+			t.Fatalf("expected the song before the long line but got %+v", r.songs)
+		}
+		if len(r.failures) != 1 || !strings.Contains(r.failures[0], "cut short") {
+			t.Fatalf("expected the long line to be reported but got %+v", r.failures)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("resolve didn't return after youtube-dl output was cut short")
+	}
+
+	if _, ok := p.cache.songs("playlist"); ok {
+		t.Fatal("expected a playlist that was cut short not to be cached")
+	}
+}
+
+func TestResolveCachesPlaylist(t *testing.T) {
+	fakeYoutubeDL(t, `echo '{"id": "a", "title": "one"}'
+echo '{"id": "b", "title": "two"}'
+`)
+	p := &MusicPlugin{cache: newTrackCache()}
+
+	failures, err := p.resolve(context.Background(), "playlist", false, func(song) {})
+	if err != nil || len(failures) != 0 {
+		t.Fatalf("unexpected failures %+v %+v", failures, err)
+	}
+	songs, ok := p.cache.songs("playlist")
+	if !ok || len(songs) != 2 {
+		t.Fatalf("expected the whole playlist to be cached but got %+v", songs)
+	}
+}
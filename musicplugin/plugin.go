@@ -2,7 +2,8 @@ package musicplugin
 
 import (
 	"bufio"
-	"encoding/binary"
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -23,7 +24,7 @@ import (
 const commandName = "tunes"
 const defaultCmdPrefix = "."
 
-var commandSet = buildSet("help", "stats", "join", "leave", "debug", "add", "play", "stop", "skip", "pause", "resume", "info", "list", "clear", "prefix")
+var commandSet = buildSet("help", "stats", "join", "leave", "debug", "add", "play", "stop", "skip", "pause", "resume", "info", "list", "clear", "prefix", "cancel", "move-here", "crossfade", "sfx")
 
 type set map[string]struct{}
 
@@ -46,10 +47,16 @@ func (s set) contains(str string) bool {
 type MusicPlugin struct {
 	sync.Mutex
 
-	discord          *bruxism.Discord
-	CmdPrefix        string
+	discord   *bruxism.Discord
+	CmdPrefix string
+	// VoiceConnections is keyed by guild ID, discord allows a single voice
+	// connection per guild.
 	VoiceConnections map[string]*voiceConnection
 	adminRoles       map[string][]string // guild id -> role names
+	cache            *trackCache
+	// Clips are the soundboard clips of a guild, guild id -> name -> clip
+	Clips  map[string]map[string]*soundClip
+	sfxDir string
 }
 
 type voiceConnection struct {
@@ -60,11 +67,14 @@ type voiceConnection struct {
 	ChannelID    string
 	MaxQueueSize int
 	Queue        []song
-
-	close   chan struct{}
-	control chan controlMessage
-	playing *song
-	conn    *discordgo.VoiceConnection
+	Crossfade    time.Duration
+
+	close     chan struct{}
+	control   chan controlMessage
+	playing   *song
+	conn      *discordgo.VoiceConnection
+	importing context.CancelFunc
+	sfx       chan string
 }
 
 type controlMessage int
@@ -105,6 +115,8 @@ func New(discord *bruxism.Discord, adminRoles map[string][]string) bruxism.Plugi
 		VoiceConnections: make(map[string]*voiceConnection),
 		adminRoles:       adminRoles,
 		CmdPrefix:        defaultCmdPrefix,
+		cache:            newTrackCache(),
+		Clips:            map[string]map[string]*soundClip{},
 	}
 
 	return p
@@ -127,6 +139,13 @@ func (p *MusicPlugin) Load(bot *bruxism.Bot, service bruxism.Service, data []byt
 		}
 	}
 
+	if p.Clips == nil {
+		p.Clips = map[string]map[string]*soundClip{}
+	}
+
+	p.cache.load(bot.PluginFile(service, p) + ".cache")
+	p.sfxDir = bot.PluginFile(service, p) + "-sfx"
+
 	go p.init()
 
 	return nil
@@ -144,22 +163,38 @@ func (p *MusicPlugin) init() {
 }
 
 func (p *MusicPlugin) ready() {
-	// Join all registered voice channels and start the playback queue
+	for _, s := range p.discord.Sessions {
+		s.AddHandler(p.voiceStateUpdate)
+	}
+
+	// Join all registered voice channels and start the playback queue, each
+	// guild on its own so a slow join doesn't hold up the others.
+	p.Lock()
+	channelIDs := []string{}
 	for _, v := range p.VoiceConnections {
-		if v.ChannelID == "" {
-			continue
-		}
-		vc, err := p.join(v.ChannelID)
-		if err != nil {
-			log.Println("tunesplugin: join channel err:", err)
-			continue
+		if v.ChannelID != "" {
+			channelIDs = append(channelIDs, v.ChannelID)
 		}
-		p.gostart(vc)
+	}
+	p.Unlock()
+
+	for _, channelID := range channelIDs {
+		go func(channelID string) {
+			vc, err := p.join(channelID)
+			if err != nil {
+				log.Println("tunesplugin: join channel err:", err)
+				return
+			}
+			p.gostart(vc)
+		}(channelID)
 	}
 }
 
 // Save will save plugin state to a byte array.
 func (p *MusicPlugin) Save() ([]byte, error) {
+	if err := p.cache.save(); err != nil {
+		log.Println("tunesplugin: saving cache err:", err)
+	}
 	return json.Marshal(p)
 }
 
@@ -174,15 +209,21 @@ func (p *MusicPlugin) Help(bot *bruxism.Bot, service bruxism.Service, message br
 			"Examples:",
 			bruxism.CommandHelp(service, commandName, "join [channelid]", "Join your voice channel or the provided voice channel.")[0],
 			bruxism.CommandHelp(service, commandName, "leave", "Leave current voice channel.")[0],
+			bruxism.CommandHelp(service, commandName, "move-here", "Move to your voice channel, keeping the queue.")[0],
 			bruxism.CommandHelp(service, commandName, "play [song name]", "Start playing music and optionally enqueue a song by name.")[0],
 			bruxism.CommandHelp(service, commandName, "add [URL]", "Start playing music and optionally enqueue a song by URL.")[0],
+			bruxism.CommandHelp(service, commandName, "cancel", "Cancel the playlist import in progress.")[0],
 			bruxism.CommandHelp(service, commandName, "info", "Information about this plugin and the currently playing song.")[0],
+			bruxism.CommandHelp(service, commandName, "stats", "Voice connection and track cache statistics.")[0],
 			bruxism.CommandHelp(service, commandName, "pause", "Pause playback of current song.")[0],
 			bruxism.CommandHelp(service, commandName, "resume", "Resume playback of current song.")[0],
 			bruxism.CommandHelp(service, commandName, "skip", "Skip current song.")[0],
 			bruxism.CommandHelp(service, commandName, "stop", "Stop playing music.")[0],
 			bruxism.CommandHelp(service, commandName, "list", "List contents of queue.")[0],
 			bruxism.CommandHelp(service, commandName, "clear", "Clear all items from queue.")[0],
+			bruxism.CommandHelp(service, commandName, "crossfade [seconds]", "Crossfade between songs, 0 to play them back-to-back.")[0],
+			bruxism.CommandHelp(service, commandName, "sfx [name]", "Play a sound clip over the music, or list the clips.")[0],
+			bruxism.CommandHelp(service, commandName, "sfx add|remove <name>", "Add the attached sound clip or remove one, admins only.")[0],
 			bruxism.CommandHelp(service, commandName, "prefix <cmdPrefix>", "Set the shortcut command prefix.")[0],
 		}...)
 	}
@@ -265,7 +306,9 @@ func (p *MusicPlugin) Message(bot *bruxism.Bot, service bruxism.Service, message
 	}
 
 	// grab pointer to this channels voice connection, if exists.
+	p.Lock()
 	vc, vcok := p.VoiceConnections[channel.GuildID]
+	p.Unlock()
 
 	switch parts[0] {
 
@@ -274,7 +317,20 @@ func (p *MusicPlugin) Message(bot *bruxism.Bot, service bruxism.Service, message
 		service.SendMessage(message.Channel(), strings.Join(p.Help(bot, service, message, true), "\n"))
 
 	case "stats":
-		// TODO: maybe provide plugin stats, total channels, total song queues, etc
+		// report voice connections, queued songs and track cache usage
+
+		p.Lock()
+		queued := 0
+		for _, v := range p.VoiceConnections {
+			v.Lock()
+			queued += len(v.Queue)
+			v.Unlock()
+		}
+		msg := fmt.Sprintf("`Voice Connections:` %d\n`Queued Songs:` %d\n", len(p.VoiceConnections), queued)
+		p.Unlock()
+
+		msg += p.cache.String()
+		service.SendMessage(message.Channel(), msg)
 
 	case "join":
 		// join the voice channel of the caller or the provided channel ID
@@ -285,15 +341,7 @@ func (p *MusicPlugin) Message(bot *bruxism.Bot, service bruxism.Service, message
 		}
 
 		if channelID == "" {
-			messageUserID := message.UserID()
-			for _, g := range p.discord.Guilds() {
-				for _, v := range g.VoiceStates {
-					if v.UserID == messageUserID {
-						channelID = v.ChannelID
-					}
-				}
-			}
-
+			channelID = p.userVoiceChannel(channel.GuildID, message.UserID())
 			if channelID == "" {
 				service.SendMessage(message.Channel(), "I couldn't find you in any voice channels, please join one.")
 				return
@@ -308,14 +356,50 @@ func (p *MusicPlugin) Message(bot *bruxism.Bot, service bruxism.Service, message
 
 		service.SendMessage(message.Channel(), "Now, let's play some tunes!")
 
+	case "move-here":
+		// follow the caller to their voice channel without losing the queue
+
+		channelID := p.userVoiceChannel(channel.GuildID, message.UserID())
+		if channelID == "" {
+			service.SendMessage(message.Channel(), "I couldn't find you in any voice channels, please join one.")
+			return
+		}
+
+		if vcok && vc.conn != nil && vc.ChannelID == channelID {
+			service.SendMessage(message.Channel(), "I'm already here.")
+			return
+		}
+
+		vc, err := p.join(channelID)
+		if err != nil {
+			service.SendMessage(message.Channel(), err.Error())
+			break
+		}
+
+		// playback stops when the bot is disconnected, pick it up again
+		if len(vc.Queue) > 0 {
+			p.gostart(vc)
+		}
+
+		service.SendMessage(message.Channel(), "Moved, the tunes go on!")
+
 	case "leave":
 		if !vcok {
 			service.SendMessage(message.Channel(), "There is no voice connection for this Guild.")
+			return
 		}
 
-		vc.conn.Disconnect()
-		vc.conn.Close()
+		// forget the connection first so the voice state update for leaving
+		// isn't treated as being disconnected by someone else.
+		p.Lock()
 		delete(p.VoiceConnections, channel.GuildID)
+		p.Unlock()
+
+		vc.stop()
+		if vc.conn != nil {
+			vc.conn.Disconnect()
+			vc.conn.Close()
+		}
 		service.SendMessage(message.Channel(), "Closed voice connection.")
 
 	case "debug":
@@ -335,16 +419,20 @@ func (p *MusicPlugin) Message(bot *bruxism.Bot, service bruxism.Service, message
 
 		p.gostart(vc)
 
+		urls := []string{}
 		for _, v := range parts[1:] {
 			url, err := url.Parse(v) // doesn't check much..
 			if err != nil {
 				continue
 			}
-			err = p.enqueue(vc, url.String(), service, message)
-			if err != nil {
-				// TODO: Might need improving.
-				service.SendMessage(message.Channel(), err.Error())
-			}
+			urls = append(urls, url.String())
+		}
+		if len(urls) == 0 {
+			break
+		}
+		err = p.enqueue(vc, urls, service, message)
+		if err != nil {
+			service.SendMessage(message.Channel(), err.Error())
 		}
 
 	case "play":
@@ -354,8 +442,9 @@ func (p *MusicPlugin) Message(bot *bruxism.Bot, service bruxism.Service, message
 
 		if len(songName) == 0 {
 			service.SendMessage(message.Channel(), "Please give me the name of the song. `play <song name>`")
+			return
 		}
-		err = p.enqueue(vc, "ytsearch:"+songName, service, message)
+		err = p.enqueue(vc, []string{"ytsearch:" + songName}, service, message)
 		if err != nil {
 			service.SendMessage(message.Channel(), err.Error())
 		}
@@ -368,15 +457,25 @@ func (p *MusicPlugin) Message(bot *bruxism.Bot, service bruxism.Service, message
 			return
 		}
 
-		if vc.close != nil {
-			close(vc.close)
-			vc.close = nil
+		vc.stop()
+
+	case "cancel":
+		// cancel the playlist import in progress
+
+		if !vcok {
+			service.SendMessage(message.Channel(), "There is no voice connection for this Guild.")
+			return
 		}
 
-		if vc.control != nil {
-			close(vc.control)
-			vc.control = nil
+		vc.Lock()
+		cancel := vc.importing
+		vc.Unlock()
+
+		if cancel == nil {
+			service.SendMessage(message.Channel(), "There is no playlist import to cancel.")
+			return
 		}
+		cancel()
 
 	case "skip":
 		// skip current song
@@ -411,6 +510,7 @@ func (p *MusicPlugin) Message(bot *bruxism.Bot, service bruxism.Service, message
 		}
 
 		msg += fmt.Sprintf("`Queue Size:` %d\n", len(vc.Queue))
+		msg += fmt.Sprintf("`Crossfade:` %s\n", vc.Crossfade)
 
 		if vc.playing == nil {
 			service.SendMessage(message.Channel(), msg)
@@ -445,7 +545,7 @@ func (p *MusicPlugin) Message(bot *bruxism.Bot, service bruxism.Service, message
 		msg = fmt.Sprintf("Total Songs: %d\n", len(vc.Queue))
 		for k, v := range vc.Queue {
 			np := ""
-			if vc.playing != nil && *vc.playing == v {
+			if k == 0 && vc.playing != nil && vc.playing.URL == v.URL {
 				np = "**(Now Playing)**"
 			}
 			d := v.DurationString()
@@ -473,6 +573,35 @@ func (p *MusicPlugin) Message(bot *bruxism.Bot, service bruxism.Service, message
 		vc.Queue = []song{}
 		vc.Unlock()
 
+	case "crossfade":
+		// show or set the crossfade between songs
+
+		if !vcok {
+			service.SendMessage(message.Channel(), "There is no voice connection for this Guild.")
+			return
+		}
+
+		if len(parts) < 2 {
+			service.SendMessage(message.Channel(), fmt.Sprintf("Crossfade is %s, specify the seconds to change it.", vc.Crossfade))
+			return
+		}
+
+		seconds, err := strconv.ParseFloat(parts[1], 64)
+		crossfade := time.Duration(seconds * float64(time.Second))
+		if err != nil || crossfade < 0 || crossfade > maxCrossfade {
+			service.SendMessage(message.Channel(), fmt.Sprintf("Crossfade must be between 0 and %.0f seconds.", maxCrossfade.Seconds()))
+			return
+		}
+
+		vc.Lock()
+		vc.Crossfade = crossfade
+		vc.Unlock()
+		service.SendMessage(message.Channel(), fmt.Sprintf("Crossfade set to %s.", crossfade))
+
+	case "sfx":
+		// play or manage soundboard clips
+		p.handleSfx(service, message, channel.GuildID, vc, parts[1:])
+
 	case "prefix":
 		if len(parts) < 2 {
 			service.SendMessage(message.Channel(), fmt.Sprintf("Current command prefix is '%s', please specify a new one if you want to change it", p.CmdPrefix))
@@ -499,13 +628,7 @@ func (p *MusicPlugin) join(cID string) (vc *voiceConnection, err error) {
 	}
 
 	// Get or Create the VoiceConnection object
-	p.Lock()
-	vc, ok := p.VoiceConnections[c.GuildID]
-	if !ok {
-		vc = &voiceConnection{}
-		p.VoiceConnections[c.GuildID] = vc
-	}
-	p.Unlock()
+	vc = p.guildVoiceConnection(c.GuildID)
 
 	guild, err := p.discord.Guild(c.GuildID)
 	if err != nil {
@@ -520,26 +643,31 @@ func (p *MusicPlugin) join(cID string) (vc *voiceConnection, err error) {
 	shardID := int((guildID >> 22) % int64(len(p.discord.Sessions)))
 
 	// NOTE: Setting mute to false, deaf to true.
-	vc.conn, err = p.discord.Sessions[int(shardID)].ChannelVoiceJoin(c.GuildID, cID, false, true)
+	conn, err := p.discord.Sessions[int(shardID)].ChannelVoiceJoin(c.GuildID, cID, false, true)
 	if err != nil {
 		return
 	}
 
-	vc.GuildID = c.GuildID
+	vc.Lock()
+	vc.conn = conn
 	vc.ChannelID = cID
+	vc.Unlock()
 
 	return
 }
 
-// enqueue a song/playlest to a VoiceConnections Queue
-func (p *MusicPlugin) enqueue(vc *voiceConnection, url string, service bruxism.Service, message bruxism.Message) (err error) {
+// enqueue songs/playlists to a VoiceConnections Queue, the lookup happens in
+// the background and can be stopped with `tunes cancel`.
+func (p *MusicPlugin) enqueue(vc *voiceConnection, urls []string, service bruxism.Service, message bruxism.Message) (err error) {
 
 	if vc == nil {
 		return fmt.Errorf("cannot enqueue to nil voice connection")
 	}
 
-	if url == "" {
-		return fmt.Errorf("cannot enqueue an empty string")
+	for _, url := range urls {
+		if url == "" {
+			return fmt.Errorf("cannot enqueue an empty string")
+		}
 	}
 
 	// TODO //////////////////////////////////////////////////////////////////
@@ -554,58 +682,144 @@ func (p *MusicPlugin) enqueue(vc *voiceConnection, url string, service bruxism.S
 	// right now option 4 and 5 work, only.
 	//////////////////////////////////////////////////////////////////////////
 
-	cmd := exec.Command("./youtube-dl", "-i", "-j", url)
-	if vc.debug {
-		cmd.Stderr = os.Stderr
+	vc.Lock()
+	if vc.importing != nil {
+		vc.Unlock()
+		return fmt.Errorf("Already adding songs, wait for it to finish or use `tunes cancel`.")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	vc.importing = cancel
+	vc.Unlock()
+
+	go p.runImport(ctx, vc, urls, message.Channel(), message.UserName())
+
+	return
+}
+
+// youtubeDL is the youtube-dl binary songs are looked up with.
+var youtubeDL = "./youtube-dl"
+
+// maxYoutubeDLLine is the longest line of youtube-dl json that is read, the
+// format lists of some videos make lines much longer than bufio's default.
+const maxYoutubeDLLine = 4 * 1024 * 1024
+
+// resolve a youtube-dl query or URL into songs, calling fn for each song as
+// it is found. The track cache is used when the query was resolved recently.
+// Entries that youtube-dl could not resolve are returned as failures.
+func (p *MusicPlugin) resolve(ctx context.Context, query string, debug bool, fn func(song)) (failures []string, err error) {
+	if songs, ok := p.cache.songs(query); ok {
+		for _, s := range songs {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			fn(s)
+		}
+		return nil, nil
+	}
+
+	stderr := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, youtubeDL, "-i", "-j", query)
+	cmd.Stderr = stderr
+	if debug {
+		cmd.Stderr = io.MultiWriter(stderr, os.Stderr)
 	}
 
 	output, err := cmd.StdoutPipe()
 	if err != nil {
-		log.Println(err)
-		service.SendMessage(message.Channel(), fmt.Sprintf("Error adding song to playlist."))
-		return
+		return nil, err
 	}
 
 	err = cmd.Start()
 	if err != nil {
-		log.Println(err)
-		service.SendMessage(message.Channel(), fmt.Sprintf("Error adding song to playlist."))
-		return
+		return nil, err
 	}
-	go func() {
-		cmd.Wait()
-	}()
 
 	scanner := bufio.NewScanner(output)
+	scanner.Buffer(make([]byte, 64*1024), maxYoutubeDLLine)
 
-	totalAdded := 0
-	var firstSong *song
+	songs := []song{}
 	for scanner.Scan() {
 		s := song{}
 		err = json.Unmarshal(scanner.Bytes(), &s)
 		if err != nil {
 			log.Println(err)
+			failures = append(failures, fmt.Sprintf("%s: unreadable youtube-dl output", query))
 			continue
 		}
+		songs = append(songs, s)
+		fn(s)
+	}
 
-		s.AddedBy = message.UserName()
+	// youtube-dl blocks writing the rest of its output once reading stops
+	// early, stop it and drain the pipe so that Wait returns.
+	scanErr := scanner.Err()
+	if scanErr != nil {
+		log.Println("tunesplugin: reading youtube-dl output err:", scanErr)
+		failures = append(failures, fmt.Sprintf("%s: youtube-dl output was cut short", query))
+		cmd.Process.Kill()
+		io.Copy(io.Discard, output)
+	}
 
-		if totalAdded == 0 {
-			firstSong = &s
-		}
-		vc.Lock()
-		vc.Queue = append(vc.Queue, s)
-		vc.Unlock()
-		totalAdded++
+	// youtube-dl exits with an error when some entries of a playlist fail,
+	// those are reported through the failures instead.
+	cmd.Wait()
+	if ctx.Err() != nil {
+		return failures, ctx.Err()
 	}
 
-	updatedQueueMessage := fmt.Sprintf("Added song: %s", firstSong.Title)
-	if totalAdded > 1 {
-		updatedQueueMessage += fmt.Sprintf(". and %d other.", totalAdded)
+	failures = append(failures, youtubeDLErrors(stderr.String())...)
+	if len(songs) == 0 && len(failures) == 0 {
+		failures = append(failures, fmt.Sprintf("%s: nothing found", query))
 	}
 
-	service.SendMessage(message.Channel(), updatedQueueMessage)
-	return
+	// don't cache partial results, failed entries or output that was cut
+	// short should be retried next time
+	if scanErr == nil && len(failures) == 0 {
+		p.cache.putSongs(query, songs)
+	}
+	return failures, nil
+}
+
+// resolveStream returns a direct media URL for a song, asking youtube-dl
+// again when the cached one has expired.
+func (p *MusicPlugin) resolveStream(s song, debug bool) (string, error) {
+	if streamURL, ok := p.cache.stream(s.ID); ok {
+		return streamURL, nil
+	}
+
+	cmd := exec.Command(youtubeDL, "-f", "bestaudio", "-g", s.URL)
+	if debug {
+		cmd.Stderr = os.Stderr
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+
+	urls := strings.Fields(string(out))
+	if len(urls) == 0 {
+		return "", fmt.Errorf("no stream url found for %s", s.URL)
+	}
+
+	p.cache.putStream(s.ID, urls[0])
+	return urls[0], nil
+}
+
+// stop the queue player if it is running.
+func (vc *voiceConnection) stop() {
+	vc.Lock()
+	defer vc.Unlock()
+
+	if vc.close != nil {
+		close(vc.close)
+		vc.close = nil
+	}
+
+	if vc.control != nil {
+		close(vc.control)
+		vc.control = nil
+	}
 }
 
 // little wrapper function for start() to fire it off in a
@@ -644,8 +858,19 @@ func (p *MusicPlugin) start(vc *voiceConnection, close <-chan struct{}, control
 		return
 	}
 
-	var i int
+	var err error
 	var Song song
+	var enc *opusEncoder
+	var next *pcmStream
+
+	defer func() {
+		if next != nil {
+			next.close()
+		}
+		if enc != nil {
+			enc.close()
+		}
+	}()
 
 	// main loop keeps this going until close
 	for {
@@ -658,116 +883,142 @@ func (p *MusicPlugin) start(vc *voiceConnection, close <-chan struct{}, control
 		default:
 		}
 
-		// loop until voice connection is ready and songs are in the queue.
-		if vc.conn == nil || !vc.conn.Ready || len(vc.Queue) < 1 {
+		// loop until voice connection is ready.
+		if vc.conn == nil || !vc.conn.Ready {
 			time.Sleep(1 * time.Second)
 			continue
 		}
 
+		// the encoder lives as long as the player so songs play back-to-back
+		if enc == nil {
+			enc, err = startEncoder(vc.debug)
+			if err != nil {
+				log.Println("tunesplugin: dca start err:", err)
+				time.Sleep(1 * time.Second)
+				continue
+			}
+			go p.send(vc.conn, enc, close)
+		}
+
+		// play sound clips while waiting for songs to be queued.
+		if len(vc.Queue) < 1 {
+			select {
+			case file := <-vc.sfxQueue():
+				p.playClip(vc, enc, close, file)
+			case <-close:
+			case <-time.After(1 * time.Second):
+			}
+			continue
+		}
+
 		// Get song to play and store it in local Song var
 		vc.Lock()
-		if len(vc.Queue)-1 >= i {
-			Song = vc.Queue[i]
-		} else {
-			i = 0
+		if len(vc.Queue) < 1 {
 			vc.Unlock()
 			continue
 		}
+		Song = vc.Queue[0]
 		vc.Unlock()
 
-		vc.playing = &Song
-		p.play(vc, close, control, Song)
-		vc.playing = nil
+		// use the prefetched stream if it is still the next song
+		cur := next
+		next = nil
+		if cur != nil && cur.song != Song {
+			cur.close()
+			cur = nil
+		}
+		if cur == nil {
+			cur, err = p.openStream(Song, vc.debug)
+			if err != nil {
+				log.Println("tunesplugin: open stream err:", err)
+			}
+		}
 
-		vc.Lock()
-		if len(vc.Queue) > 0 {
-			vc.Queue = append(vc.Queue[:i], vc.Queue[i+1:]...)
+		if cur != nil {
+			vc.setPlaying(Song)
+			next = p.play(vc, close, control, enc, cur)
+			cur.close()
+			vc.playing = nil
 		}
-		vc.Unlock()
+
+		// keep the song in the queue when playback was stopped so that it
+		// plays again when the player restarts
+		select {
+		case <-close:
+			log.Println("tunesplugin: start() exited due to close channel.")
+			return
+		default:
+		}
+
+		vc.dequeue(Song)
 	}
 }
 
-// play an individual song
-func (p *MusicPlugin) play(vc *voiceConnection, close <-chan struct{}, control <-chan controlMessage, s song) {
-	var err error
+// setPlaying keeps a copy of the song so that updating how much of it
+// remains doesn't change the song that is dequeued.
+func (vc *voiceConnection) setPlaying(s song) {
+	vc.playing = &s
+}
 
-	if close == nil || control == nil || vc == nil || vc.conn == nil {
-		log.Println("tunesplugin: play exited because [close|control|vc|vc.conn] is nil.")
-		return
+// dequeue removes the song once it is done, unless the queue was changed
+// while it played.
+func (vc *voiceConnection) dequeue(s song) {
+	vc.Lock()
+	defer vc.Unlock()
+	if len(vc.Queue) > 0 && vc.Queue[0] == s {
+		vc.Queue = vc.Queue[1:]
 	}
+}
 
-	ytdl := exec.Command("./youtube-dl", "-v", "-f", "bestaudio", "-o", "-", s.URL)
-	if vc.debug {
-		ytdl.Stderr = os.Stderr
-	}
-	ytdlout, err := ytdl.StdoutPipe()
-	if err != nil {
-		log.Println("tunesplugin: ytdl StdoutPipe err:", err)
-		return
-	}
-	ytdlbuf := bufio.NewReaderSize(ytdlout, 16384)
+// send opus frames from the encoder to the voice connection until the
+// encoder is closed.
+func (p *MusicPlugin) send(conn *discordgo.VoiceConnection, enc *opusEncoder, close <-chan struct{}) {
 
-	ffmpeg := exec.Command("ffmpeg", "-i", "pipe:0", "-f", "s16le", "-ar", "48000", "-ac", "2", "-af", "volume=0.5", "pipe:1")
-	ffmpeg.Stdin = ytdlbuf
-	if vc.debug {
-		ffmpeg.Stderr = os.Stderr
-	}
-	ffmpegout, err := ffmpeg.StdoutPipe()
-	if err != nil {
-		log.Println("tunesplugin: ffmpeg StdoutPipe err:", err)
-		return
-	}
-	ffmpegbuf := bufio.NewReaderSize(ffmpegout, 16384)
+	// Send "speaking" packet over the voice websocket
+	conn.Speaking(true)
 
-	dca := exec.Command("./dca")
-	dca.Stdin = ffmpegbuf
-	if vc.debug {
-		dca.Stderr = os.Stderr
-	}
-	dcaout, err := dca.StdoutPipe()
-	if err != nil {
-		log.Println("tunesplugin: dca StdoutPipe err:", err)
-		return
-	}
-	dcabuf := bufio.NewReaderSize(dcaout, 16384)
+	// Send not "speaking" packet over the websocket when we finish
+	defer conn.Speaking(false)
 
-	err = ytdl.Start()
-	if err != nil {
-		log.Println("tunesplugin: ytdl Start err:", err)
-		return
-	}
-	go func() {
-		ytdl.Wait()
-	}()
+	for {
+		opus, err := enc.readOpus()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return
+		}
+		if err != nil {
+			log.Println("tunesplugin: read opus from dca err:", err)
+			return
+		}
 
-	err = ffmpeg.Start()
-	if err != nil {
-		log.Println("tunesplugin: ffmpeg Start err:", err)
-		return
+		// nothing drains OpusSend once the connection is gone so give up
+		// when the player is stopped.
+		select {
+		case conn.OpusSend <- opus:
+		case <-close:
+			return
+		}
 	}
-	go func() {
-		ffmpeg.Wait()
-	}()
+}
 
-	err = dca.Start()
-	if err != nil {
-		log.Println("tunesplugin: dca Start err:", err)
+// play an individual song, the next song in the queue is prefetched near the
+// end and crossfaded in if enabled. The prefetched stream is returned.
+func (p *MusicPlugin) play(vc *voiceConnection, close <-chan struct{}, control <-chan controlMessage, enc *opusEncoder, cur *pcmStream) (next *pcmStream) {
+
+	if close == nil || control == nil || vc == nil || enc == nil || cur == nil {
+		log.Println("tunesplugin: play exited because [close|control|vc|enc|cur] is nil.")
 		return
 	}
-	go func() {
-		dca.Wait()
-	}()
 
-	// header "buffer"
-	var opuslen int16
-
-	// Send "speaking" packet over the voice websocket
-	vc.conn.Speaking(true)
+	vc.Lock()
+	crossfade := vc.Crossfade
+	vc.Unlock()
 
-	// Send not "speaking" packet over the websocket when we finish
-	defer vc.conn.Speaking(false)
+	length := time.Duration(cur.song.Duration) * time.Second
+	prefetched := false
 
-	start := time.Now()
+	sfx := vc.sfxQueue()
+	frame := make([]int16, frameSamples)
+	nextFrame := make([]int16, frameSamples)
 	for {
 
 		select {
@@ -803,41 +1054,64 @@ func (p *MusicPlugin) play(vc *voiceConnection, close <-chan struct{}, control <
 					}
 
 				}
+				enc.resetClock()
+			}
+		case file := <-sfx:
+			// the song holds its position while the clip plays
+			if !p.playClip(vc, enc, close, file) {
+				return
 			}
 		default:
 		}
 
-		// read dca opus length header
-		err = binary.Read(dcabuf, binary.LittleEndian, &opuslen)
-		if err == io.EOF || err == io.ErrUnexpectedEOF {
+		pos := cur.position()
+		remaining := length - pos
+
+		// songs without a known duration are only started after they end
+		if !prefetched && length > 0 && remaining <= crossfade+prefetchLead {
+			prefetched = true
+			next = p.prefetch(vc)
+		}
+
+		err := cur.readFrame(frame)
+		if err == io.EOF {
 			return
 		}
 		if err != nil {
-			log.Println("tunesplugin: read opus length from dca err:", err)
+			log.Println("tunesplugin: read pcm from ffmpeg err:", err)
 			return
 		}
 
-		// read opus data from dca
-		opus := make([]byte, opuslen)
-		err = binary.Read(dcabuf, binary.LittleEndian, &opus)
-		if err == io.EOF || err == io.ErrUnexpectedEOF {
-			return
+		if next != nil && crossfade > 0 && remaining <= crossfade {
+			if err := next.readFrame(nextFrame); err == nil {
+				mixFrames(frame, nextFrame, crossfadeGain(remaining, crossfade))
+			}
 		}
-		if err != nil {
-			log.Println("tunesplugin: read opus from dca err:", err)
+
+		if !enc.writeFrame(frame, close) {
 			return
 		}
 
-		// Send received PCM to the sendPCM channel
-		vc.conn.OpusSend <- opus
-		// TODO: Add a select and timeout to above
-		// shouldn't ever block longer than maybe 18-25ms
+		vc.playing.Remaining = cur.song.Duration - int(pos.Seconds())
+	}
+}
 
-		// this can cause a panic if vc becomes nil while waiting to send
-		// on the opus channel. TODO fix..
-		vc.playing.Remaining = (vc.playing.Duration - int(time.Since(start).Seconds()))
+// prefetch starts decoding the song after the one playing.
+func (p *MusicPlugin) prefetch(vc *voiceConnection) *pcmStream {
+	vc.Lock()
+	if len(vc.Queue) < 2 {
+		vc.Unlock()
+		return nil
+	}
+	s := vc.Queue[1]
+	vc.Unlock()
 
+	st, err := p.openStream(s, vc.debug)
+	if err != nil {
+		log.Println("tunesplugin: prefetch stream err:", err)
+		return nil
 	}
+	return st
 }
 
 // Stats will return the stats for a plugin.
@@ -21,3 +21,28 @@ func TestMessageMatches(t *testing.T) {
 		})
 	}
 }
+
+func TestDequeueAfterSkip(t *testing.T) {
+	first := song{ID: "1", URL: "https://example.com/1", Duration: 200}
+	second := song{ID: "2", URL: "https://example.com/2", Duration: 100}
+	vc := &voiceConnection{Queue: []song{first, second}}
+
+	// skipped part way through the song
+	vc.setPlaying(vc.Queue[0])
+	vc.playing.Remaining = 150
+	vc.playing = nil
+	vc.dequeue(first)
+
+	if len(vc.Queue) != 1 || vc.Queue[0] != second {
+		t.Fatalf("expected the queue to move on to %s but got %v", second, vc.Queue)
+	}
+
+	// the queue was cleared while the song played
+	vc.setPlaying(second)
+	vc.Queue = []song{}
+	vc.dequeue(second)
+
+	if len(vc.Queue) != 0 {
+		t.Fatalf("expected the queue to stay empty but got %v", vc.Queue)
+	}
+}
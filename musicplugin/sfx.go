@@ -0,0 +1,250 @@
+package musicplugin
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/iopred/bruxism"
+)
+
+// maxClipSize is the largest attachment accepted as a sound clip.
+const maxClipSize = 2 * 1024 * 1024
+
+// maxClipLength cuts off clips that turn out to be longer than a sound effect.
+const maxClipLength = 15 * time.Second
+
+var clipNameRegexp = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+var reservedClipNames = buildSet("add", "remove", "list")
+
+// soundClip is a short sound effect uploaded to a guild.
+type soundClip struct {
+	Name    string
+	File    string
+	AddedBy string
+	Added   time.Time
+}
+
+// sfxQueue returns the channel that clip files to play are sent on.
+func (vc *voiceConnection) sfxQueue() chan string {
+	vc.Lock()
+	defer vc.Unlock()
+
+	if vc.sfx == nil {
+		vc.sfx = make(chan string, 4)
+	}
+	return vc.sfx
+}
+
+// handleSfx handles `tunes sfx [add|remove] [name]`.
+func (p *MusicPlugin) handleSfx(service bruxism.Service, message bruxism.Message, guildID string, vc *voiceConnection, args []string) {
+	if len(args) == 0 || args[0] == "list" {
+		service.SendMessage(message.Channel(), p.listClips(guildID))
+		return
+	}
+
+	switch args[0] {
+	case "add", "remove":
+		if !p.isUserAdmin(guildID, message.UserID()) {
+			service.SendMessage(message.Channel(), "Only tunes admins can manage sound clips.")
+			return
+		}
+		if len(args) < 2 {
+			service.SendMessage(message.Channel(), fmt.Sprintf("Please give the clip a name. `sfx %s <name>`", args[0]))
+			return
+		}
+
+		if args[0] == "add" {
+			if err := p.addClip(guildID, args[1], message); err != nil {
+				service.SendMessage(message.Channel(), err.Error())
+				return
+			}
+			service.SendMessage(message.Channel(), fmt.Sprintf("Added sound clip %s.", args[1]))
+			return
+		}
+
+		if err := p.removeClip(guildID, args[1]); err != nil {
+			service.SendMessage(message.Channel(), err.Error())
+			return
+		}
+		service.SendMessage(message.Channel(), fmt.Sprintf("Removed sound clip %s.", args[1]))
+
+	default:
+		if vc == nil || vc.conn == nil {
+			service.SendMessage(message.Channel(), "There is no voice connection for this Guild.")
+			return
+		}
+
+		p.Lock()
+		clip, ok := p.Clips[guildID][args[0]]
+		p.Unlock()
+		if !ok {
+			service.SendMessage(message.Channel(), fmt.Sprintf("There is no sound clip called %s, try `tunes sfx list`.", args[0]))
+			return
+		}
+
+		p.gostart(vc)
+
+		select {
+		case vc.sfxQueue() <- clip.File:
+		default:
+			service.SendMessage(message.Channel(), "Too many sound clips queued, slow down.")
+		}
+	}
+}
+
+// validClipName returns whether name can be played with `tunes sfx <name>`.
+func validClipName(name string) bool {
+	return clipNameRegexp.MatchString(name) && !reservedClipNames.contains(name)
+}
+
+func (p *MusicPlugin) listClips(guildID string) string {
+	p.Lock()
+	defer p.Unlock()
+
+	names := []string{}
+	for name := range p.Clips[guildID] {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return "There are no sound clips, admins can upload one with `tunes sfx add <name>`."
+	}
+	sort.Strings(names)
+	return fmt.Sprintf("Sound clips: %s", strings.Join(names, ", "))
+}
+
+// addClip downloads the message attachment into the clip directory.
+func (p *MusicPlugin) addClip(guildID, name string, message bruxism.Message) error {
+	if !validClipName(name) {
+		return fmt.Errorf("Invalid clip name, use up to 32 letters, numbers, - or _.")
+	}
+
+	attachment := messageAttachment(message)
+	if attachment == nil {
+		return fmt.Errorf("Please attach the sound clip to the message.")
+	}
+	if attachment.Size > maxClipSize {
+		return fmt.Errorf("Sound clips can be at most %dMB.", maxClipSize/1024/1024)
+	}
+
+	dir := filepath.Join(p.sfxDir, guildID)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		log.Println("tunesplugin: creating sfx directory err:", err)
+		return fmt.Errorf("Unable to store sound clip.")
+	}
+
+	file := filepath.Join(dir, name+strings.ToLower(filepath.Ext(attachment.Filename)))
+	if err := download(attachment.URL, file); err != nil {
+		log.Println("tunesplugin: downloading clip err:", err)
+		return fmt.Errorf("Unable to download sound clip.")
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	if old, ok := p.Clips[guildID][name]; ok && old.File != file {
+		os.Remove(old.File)
+	}
+	if p.Clips[guildID] == nil {
+		p.Clips[guildID] = map[string]*soundClip{}
+	}
+	p.Clips[guildID][name] = &soundClip{
+		Name:    name,
+		File:    file,
+		AddedBy: message.UserName(),
+		Added:   time.Now(),
+	}
+	return nil
+}
+
+func (p *MusicPlugin) removeClip(guildID, name string) error {
+	p.Lock()
+	defer p.Unlock()
+
+	clip, ok := p.Clips[guildID][name]
+	if !ok {
+		return fmt.Errorf("There is no sound clip called %s.", name)
+	}
+	delete(p.Clips[guildID], name)
+
+	if err := os.Remove(clip.File); err != nil && !os.IsNotExist(err) {
+		log.Println("tunesplugin: removing clip err:", err)
+	}
+	return nil
+}
+
+// playClip plays a clip file through the encoder, the song that was playing
+// continues where it was once it returns.
+func (p *MusicPlugin) playClip(vc *voiceConnection, enc *opusEncoder, close <-chan struct{}, file string) bool {
+	clip, err := decode(song{}, file, vc.debug)
+	if err != nil {
+		log.Println("tunesplugin: open clip err:", err)
+		return true
+	}
+	defer clip.close()
+
+	frame := make([]int16, frameSamples)
+	for clip.position() < maxClipLength {
+		err := clip.readFrame(frame)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Println("tunesplugin: read pcm from clip err:", err)
+			break
+		}
+
+		if !enc.writeFrame(frame, close) {
+			return false
+		}
+	}
+	return true
+}
+
+func messageAttachment(message bruxism.Message) *discordgo.MessageAttachment {
+	m, ok := message.(*bruxism.DiscordMessage)
+	if !ok || m.DiscordgoMessage == nil || len(m.DiscordgoMessage.Attachments) == 0 {
+		return nil
+	}
+	return m.DiscordgoMessage.Attachments[0]
+}
+
+// download url to file, the file is only replaced once the download is
+// complete so a failed one leaves the old clip as it was.
+func download(url, file string) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, io.LimitReader(resp.Body, maxClipSize))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), file)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
@@ -0,0 +1,107 @@
+package musicplugin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/iopred/bruxism"
+)
+
+func TestValidClipName(t *testing.T) {
+	cases := []struct {
+		name   string
+		clip   string
+		result bool
+	}{
+		{"simple", "airhorn", true},
+		{"numbers and separators", "sad_trombone-2", true},
+		{"empty", "", false},
+		{"upper case", "Airhorn", false},
+		{"space", "air horn", false},
+		{"path", "../airhorn", false},
+		{"too long", "abcdefghijklmnopqrstuvwxyz0123456", false},
+		{"reserved add", "add", false},
+		{"reserved remove", "remove", false},
+		{"reserved list", "list", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if validClipName(c.clip) != c.result {
+				t.Fatalf("expected '%s' to be '%+v'", c.clip, c.result)
+			}
+		})
+	}
+}
+
+func TestAddClipReplacesFile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken.ogg" {
+			// the connection drops part way through
+			w.Header().Set("Content-Length", "1000")
+			w.Write([]byte("partial"))
+			return
+		}
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer server.Close()
+
+	p := &MusicPlugin{
+		Clips:  map[string]map[string]*soundClip{},
+		sfxDir: t.TempDir(),
+	}
+	nick := "dj"
+	upload := func(filename string) bruxism.Message {
+		return &bruxism.DiscordMessage{
+			Nick: &nick,
+			DiscordgoMessage: &discordgo.Message{
+				Attachments: []*discordgo.MessageAttachment{
+					{Filename: filename, URL: server.URL + "/" + filename, Size: 100},
+				},
+			},
+		}
+	}
+
+	if err := p.addClip("g", "airhorn", upload("airhorn.MP3")); err != nil {
+		t.Fatalf("unable to add clip: %+v", err)
+	}
+	first := p.Clips["g"]["airhorn"].File
+	if filepath.Base(first) != "airhorn.mp3" {
+		t.Fatalf("expected the clip to be stored as airhorn.mp3, got %s", first)
+	}
+
+	if err := p.addClip("g", "airhorn", upload("louder.ogg")); err != nil {
+		t.Fatalf("unable to replace clip: %+v", err)
+	}
+	second := p.Clips["g"]["airhorn"].File
+	if _, err := os.Stat(first); !os.IsNotExist(err) {
+		t.Fatalf("expected the replaced file %s to be removed, got %v", first, err)
+	}
+	data, err := os.ReadFile(second)
+	if err != nil || string(data) != "/louder.ogg" {
+		t.Fatalf("expected the new clip in %s, got %q %v", second, data, err)
+	}
+	if len(p.Clips["g"]) != 1 || p.Clips["g"]["airhorn"].AddedBy != nick {
+		t.Fatalf("expected one clip added by %s, got %+v", nick, p.Clips["g"])
+	}
+
+	if err := p.addClip("g", "airhorn", upload("broken.ogg")); err == nil {
+		t.Fatal("expected a failed download to be reported")
+	}
+	data, err = os.ReadFile(second)
+	if err != nil || string(data) != "/louder.ogg" {
+		t.Fatalf("expected a failed download to keep the clip, got %q %v", data, err)
+	}
+	files, _ := os.ReadDir(filepath.Dir(second))
+	if len(files) != 1 {
+		t.Fatalf("expected only the clip to be left but got %d files", len(files))
+	}
+
+	if err := p.addClip("g", "list", upload("list.mp3")); err == nil {
+		t.Fatal("expected a reserved name to be refused")
+	}
+}
@@ -0,0 +1,229 @@
+package musicplugin
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sampleRate   = 48000
+	channels     = 2
+	frameSize    = 960 // samples per channel in a 20ms frame, what dca expects
+	frameSamples = frameSize * channels
+	frameLength  = time.Second * frameSize / sampleRate
+)
+
+// maxCrossfade is the longest crossfade that can be configured.
+const maxCrossfade = 12 * time.Second
+
+// prefetchLead is how long before the end of a song the next one is started.
+const prefetchLead = 10 * time.Second
+
+// encoderLead is how far PCM is allowed to run ahead of real time, it bounds
+// the delay of pause and skip.
+const encoderLead = 1 * time.Second
+
+// pcmStream is the decoded PCM audio of a single song.
+type pcmStream struct {
+	song   song
+	ffmpeg *exec.Cmd
+	out    *bufio.Reader
+	frames int
+}
+
+// openStream starts decoding a song with ffmpeg.
+func (p *MusicPlugin) openStream(s song, debug bool) (*pcmStream, error) {
+	streamURL, err := p.resolveStream(s, debug)
+	if err != nil {
+		return nil, err
+	}
+
+	return decode(s, streamURL, debug)
+}
+
+// decode starts ffmpeg on a URL or local file.
+func decode(s song, input string, debug bool) (*pcmStream, error) {
+	args := []string{}
+	if strings.HasPrefix(input, "http://") || strings.HasPrefix(input, "https://") {
+		args = append(args, "-reconnect", "1", "-reconnect_streamed", "1", "-reconnect_delay_max", "5")
+	}
+	args = append(args, "-i", input, "-f", "s16le", "-ar", "48000", "-ac", "2", "-af", "volume=0.5", "pipe:1")
+
+	ffmpeg := exec.Command("ffmpeg", args...)
+	if debug {
+		ffmpeg.Stderr = os.Stderr
+	}
+	ffmpegout, err := ffmpeg.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	err = ffmpeg.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	return &pcmStream{
+		song:   s,
+		ffmpeg: ffmpeg,
+		out:    bufio.NewReaderSize(ffmpegout, 16384),
+	}, nil
+}
+
+// readFrame reads the next 20ms of audio, a short last frame is padded with
+// silence.
+func (st *pcmStream) readFrame(frame []int16) error {
+	err := binary.Read(st.out, binary.LittleEndian, frame)
+	if err == io.ErrUnexpectedEOF {
+		for i := range frame {
+			frame[i] = 0
+		}
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+	st.frames++
+	return nil
+}
+
+// position is how much of the song has been read.
+func (st *pcmStream) position() time.Duration {
+	return time.Duration(st.frames) * frameLength
+}
+
+func (st *pcmStream) close() {
+	if st.ffmpeg.Process != nil {
+		st.ffmpeg.Process.Kill()
+	}
+	st.ffmpeg.Wait()
+}
+
+// opusEncoder is a dca process that outlives individual songs so that there
+// is no gap when one song follows another.
+type opusEncoder struct {
+	sync.Mutex
+	dca *exec.Cmd
+	in  io.WriteCloser
+	out *bufio.Reader
+
+	start  time.Time
+	frames int
+}
+
+func startEncoder(debug bool) (*opusEncoder, error) {
+	dca := exec.Command("./dca")
+	if debug {
+		dca.Stderr = os.Stderr
+	}
+	in, err := dca.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	dcaout, err := dca.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	err = dca.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	return &opusEncoder{
+		dca: dca,
+		in:  in,
+		out: bufio.NewReaderSize(dcaout, 16384),
+	}, nil
+}
+
+// writeFrame encodes a frame of PCM, it blocks to keep the encoder close to
+// real time and returns false if close is closed while waiting.
+func (e *opusEncoder) writeFrame(frame []int16, close <-chan struct{}) bool {
+	e.Lock()
+	if e.frames == 0 {
+		e.start = time.Now()
+	}
+	ahead := time.Until(e.start.Add(time.Duration(e.frames)*frameLength)) - encoderLead
+	e.frames++
+	e.Unlock()
+
+	if ahead > 0 {
+		select {
+		case <-time.After(ahead):
+		case <-close:
+			return false
+		}
+	}
+
+	err := binary.Write(e.in, binary.LittleEndian, frame)
+	if err != nil {
+		log.Println("tunesplugin: write pcm to dca err:", err)
+		return false
+	}
+	return true
+}
+
+// resetClock restarts real time pacing, after being paused for example.
+func (e *opusEncoder) resetClock() {
+	e.Lock()
+	e.frames = 0
+	e.Unlock()
+}
+
+// readOpus reads the next dca opus frame.
+func (e *opusEncoder) readOpus() ([]byte, error) {
+	// header "buffer"
+	var opuslen int16
+
+	// read dca opus length header
+	err := binary.Read(e.out, binary.LittleEndian, &opuslen)
+	if err != nil {
+		return nil, err
+	}
+
+	// read opus data from dca
+	opus := make([]byte, opuslen)
+	err = binary.Read(e.out, binary.LittleEndian, &opus)
+	if err != nil {
+		return nil, err
+	}
+	return opus, nil
+}
+
+func (e *opusEncoder) close() {
+	e.in.Close()
+	if e.dca.Process != nil {
+		e.dca.Process.Kill()
+	}
+	e.dca.Wait()
+}
+
+// crossfadeGain is how loud the next song is while the current one has
+// remaining time left in a crossfade of length fade, from 0 to 1.
+func crossfadeGain(remaining, fade time.Duration) float64 {
+	if fade <= 0 || remaining <= 0 {
+		return 1
+	}
+	if remaining >= fade {
+		return 0
+	}
+	return 1 - float64(remaining)/float64(fade)
+}
+
+// mixFrames mixes next into frame, with gain applied to next and the inverse
+// to frame.
+func mixFrames(frame, next []int16, gain float64) {
+	for i := range frame {
+		v := float64(frame[i])*(1-gain) + float64(next[i])*gain
+		frame[i] = int16(math.Max(math.MinInt16, math.Min(math.MaxInt16, math.Round(v))))
+	}
+}
@@ -0,0 +1,50 @@
+package musicplugin
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCrossfadeGain(t *testing.T) {
+	cases := []struct {
+		name      string
+		remaining time.Duration
+		fade      time.Duration
+		gain      float64
+	}{
+		{"before fade", 10 * time.Second, 4 * time.Second, 0},
+		{"fade start", 4 * time.Second, 4 * time.Second, 0},
+		{"half way", 2 * time.Second, 4 * time.Second, 0.5},
+		{"song over", 0, 4 * time.Second, 1},
+		{"no fade", 2 * time.Second, 0, 1},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := crossfadeGain(c.remaining, c.fade); got != c.gain {
+				t.Fatalf("expected gain %v but got %v", c.gain, got)
+			}
+		})
+	}
+}
+
+func TestMixFrames(t *testing.T) {
+	frame := []int16{1000, -1000, math.MaxInt16, 0}
+	next := []int16{3000, 1000, math.MaxInt16, math.MinInt16}
+
+	mixFrames(frame, next, 0.5)
+
+	expected := []int16{2000, 0, math.MaxInt16, math.MinInt16 / 2}
+	for i := range expected {
+		if frame[i] != expected[i] {
+			t.Fatalf("sample %d: expected %d but got %d", i, expected[i], frame[i])
+		}
+	}
+}
+
+func TestFrameLength(t *testing.T) {
+	if frameLength != 20*time.Millisecond {
+		t.Fatalf("expected 20ms frames but got %s", frameLength)
+	}
+}
@@ -0,0 +1,83 @@
+package musicplugin
+
+import (
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// guildVoiceConnection returns the guild's voice connection, creating it if
+// there isn't one. Each guild has its own queue and player, so the bot can
+// play in several guilds at the same time.
+func (p *MusicPlugin) guildVoiceConnection(guildID string) *voiceConnection {
+	p.Lock()
+	defer p.Unlock()
+
+	vc, ok := p.VoiceConnections[guildID]
+	if !ok {
+		vc = &voiceConnection{GuildID: guildID}
+		p.VoiceConnections[guildID] = vc
+	}
+	return vc
+}
+
+// voiceStateUpdate keeps track of the bot being moved between channels or
+// disconnected by a moderator.
+func (p *MusicPlugin) voiceStateUpdate(s *discordgo.Session, v *discordgo.VoiceStateUpdate) {
+	if s.State.User == nil || v.UserID != s.State.User.ID {
+		return
+	}
+
+	p.Lock()
+	vc, ok := p.VoiceConnections[v.GuildID]
+	p.Unlock()
+	if !ok {
+		return
+	}
+
+	if v.ChannelID == "" {
+		p.disconnected(vc)
+		return
+	}
+
+	vc.Lock()
+	if vc.ChannelID != v.ChannelID {
+		log.Printf("tunesplugin: moved from channel %s to %s in guild %s", vc.ChannelID, v.ChannelID, v.GuildID)
+		vc.ChannelID = v.ChannelID
+	}
+	vc.Unlock()
+}
+
+// disconnected stops playback and releases the voice connection, the queue
+// is kept so that `move-here` or `join` can continue where it left off.
+func (p *MusicPlugin) disconnected(vc *voiceConnection) {
+	log.Printf("tunesplugin: disconnected from channel %s in guild %s", vc.ChannelID, vc.GuildID)
+
+	vc.stop()
+
+	vc.Lock()
+	conn := vc.conn
+	vc.conn = nil
+	vc.ChannelID = ""
+	vc.Unlock()
+
+	if conn != nil {
+		conn.Disconnect()
+	}
+}
+
+// userVoiceChannel returns the voice channel the user is in on the guild.
+func (p *MusicPlugin) userVoiceChannel(guildID, userID string) string {
+	g, err := p.discord.Guild(guildID)
+	if err != nil {
+		log.Println("tunesplugin: fetching guild err:", err)
+		return ""
+	}
+
+	for _, v := range g.VoiceStates {
+		if v.UserID == userID {
+			return v.ChannelID
+		}
+	}
+	return ""
+}
@@ -0,0 +1,63 @@
+package musicplugin
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestGuildVoiceConnections(t *testing.T) {
+	p := &MusicPlugin{VoiceConnections: map[string]*voiceConnection{}}
+	guilds := []string{"1", "2", "3"}
+
+	// guilds look up their connection at the same time
+	var wg sync.WaitGroup
+	for _, guildID := range guilds {
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func(guildID string) {
+				defer wg.Done()
+				vc := p.guildVoiceConnection(guildID)
+				vc.Lock()
+				vc.Queue = append(vc.Queue, song{ID: guildID})
+				vc.Unlock()
+			}(guildID)
+		}
+	}
+	wg.Wait()
+
+	if len(p.VoiceConnections) != len(guilds) {
+		t.Fatalf("expected %d voice connections but got %d", len(guilds), len(p.VoiceConnections))
+	}
+	for _, guildID := range guilds {
+		vc := p.guildVoiceConnection(guildID)
+		if vc.GuildID != guildID || len(vc.Queue) != 5 {
+			t.Fatalf("expected guild %s to have its own queue of 5 songs, got %s with %d", guildID, vc.GuildID, len(vc.Queue))
+		}
+		for _, s := range vc.Queue {
+			if s.ID != guildID {
+				t.Fatalf("guild %s has a song queued in guild %s", guildID, s.ID)
+			}
+		}
+	}
+
+	// every guild gets its own player, stopping one leaves the others going
+	for _, guildID := range guilds {
+		if err := p.gostart(p.guildVoiceConnection(guildID)); err != nil {
+			t.Fatalf("unable to start the player of guild %s: %+v", guildID, err)
+		}
+	}
+	p.guildVoiceConnection("1").stop()
+	if p.guildVoiceConnection("1").close != nil {
+		t.Fatal("expected the player of guild 1 to be stopped")
+	}
+	for _, guildID := range guilds[1:] {
+		vc := p.guildVoiceConnection(guildID)
+		vc.Lock()
+		running := vc.close != nil
+		vc.Unlock()
+		if !running {
+			t.Fatalf("expected the player of guild %s to keep running", guildID)
+		}
+		vc.stop()
+	}
+}
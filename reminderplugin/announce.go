@@ -0,0 +1,458 @@
+package reminderplugin
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/dustin/go-humanize"
+	"github.com/iopred/bruxism"
+)
+
+// maxAnnouncements is how many announcements each server can have, paused
+// ones included.
+const maxAnnouncements = 50
+
+var errNoAnnouncement = errors.New("there's no announcement with that ID")
+
+var (
+	channelMentionRegexp = regexp.MustCompile(`^<#(\d+)>$`)
+	sectionRegexp        = regexp.MustCompile(`\s+\|\s+`)
+	colorRegexp          = regexp.MustCompile(`^#([0-9a-fA-F]{6})$`)
+)
+
+// An Announcement is what makes a reminder a post scheduled by a server
+// admin, the reminder's Target is the channel it is posted in and its
+// Requester is the admin who scheduled it.
+type Announcement struct {
+	GuildID string
+	Embed   *Embed
+	// Paused announcements are kept out of the scheduler until they are
+	// resumed.
+	Paused bool
+}
+
+// An Embed is the rich part of an announcement.
+type Embed struct {
+	Title       string
+	Description string
+	Color       int
+	Image       string
+}
+
+func (e *Embed) embed() *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title:       e.Title,
+		Description: e.Description,
+		Color:       e.Color,
+	}
+	if e.Image != "" {
+		embed.Image = &discordgo.MessageEmbedImage{URL: e.Image}
+	}
+	return embed
+}
+
+// parseAnnouncement reads `<message> [| title | description | #color | image]`,
+// the message can be left empty when there is an embed.
+func parseAnnouncement(text string) (string, *Embed, error) {
+	sections := sectionRegexp.Split(strings.TrimSpace(text), -1)
+	content := sections[0]
+	if content == "-" {
+		content = ""
+	}
+	if len(content) > 2000 {
+		return "", nil, errors.New("the message is longer than 2000 characters")
+	}
+	if len(sections) == 1 {
+		if content == "" {
+			return "", nil, errors.New("no message")
+		}
+		return content, nil, nil
+	}
+
+	embed := &Embed{Title: sections[1]}
+	if len(embed.Title) > 256 {
+		return "", nil, errors.New("the title is longer than 256 characters")
+	}
+	if len(sections) > 2 {
+		embed.Description = sections[2]
+		if len(embed.Description) > 4096 {
+			return "", nil, errors.New("the description is longer than 4096 characters")
+		}
+	}
+	for _, s := range sections[min(len(sections), 3):] {
+		if m := colorRegexp.FindStringSubmatch(s); m != nil {
+			color, _ := strconv.ParseInt(m[1], 16, 32)
+			embed.Color = int(color)
+		} else if strings.HasPrefix(s, "https://") || strings.HasPrefix(s, "http://") {
+			embed.Image = s
+		} else {
+			return "", nil, fmt.Errorf("expected a #color or an image link but got '%s'", s)
+		}
+	}
+	return content, embed, nil
+}
+
+// rawSuffix returns the end of raw holding its last n words, keeping the
+// newlines and spacing between them.
+func rawSuffix(raw string, n int) string {
+	raw = strings.TrimRightFunc(raw, unicode.IsSpace)
+	start := len(raw)
+	for ; n > 0 && start > 0; n-- {
+		start = strings.LastIndexFunc(raw[:start], unicode.IsSpace) + 1
+		if n > 1 {
+			start = len(strings.TrimRightFunc(raw[:start], unicode.IsSpace))
+		}
+	}
+	return raw[start:]
+}
+
+// announcementIn matches the announcement with the ID if it is in the guild.
+func announcementIn(guildID, id string) func(*Reminder) bool {
+	return func(r *Reminder) bool {
+		return r.Announcement != nil && r.Announcement.GuildID == guildID && strings.EqualFold(r.ID, id)
+	}
+}
+
+func announcementsIn(guildID string) func(*Reminder) bool {
+	return func(r *Reminder) bool {
+		return r.Announcement != nil && r.Announcement.GuildID == guildID
+	}
+}
+
+func announcementLine(r *Reminder) string {
+	what := r.Message
+	if r.Announcement.Embed != nil && r.Announcement.Embed.Title != "" {
+		what = r.Announcement.Embed.Title
+	}
+	if len(what) > 80 {
+		what = what[:77] + "..."
+	}
+	line := fmt.Sprintf("%s - <#%s> %s: %s", r.ID, r.Target, humanize.Time(r.Time), strings.Join(strings.Fields(what), " "))
+	if r.Recurrence != nil {
+		line += fmt.Sprintf(" (%s)", r.Recurrence)
+	}
+	if r.Announcement.Paused {
+		line += " [paused]"
+	}
+	return line
+}
+
+// announcementMessage renders an announcement, admins schedule them so they
+// may notify anyone.
+func announcementMessage(r *Reminder) *discordgo.MessageSend {
+	send := &discordgo.MessageSend{
+		Content: r.Message,
+		AllowedMentions: &discordgo.MessageAllowedMentions{
+			Parse: []discordgo.AllowedMentionType{
+				discordgo.AllowedMentionTypeUsers,
+				discordgo.AllowedMentionTypeRoles,
+				discordgo.AllowedMentionTypeEveryone,
+			},
+		},
+	}
+	if r.Announcement.Embed != nil {
+		send.Embeds = []*discordgo.MessageEmbed{r.Announcement.Embed.embed()}
+	}
+	return send
+}
+
+// addAnnouncement schedules an announcement, they don't count towards the
+// requester's reminders.
+func (p *ReminderPlugin) addAnnouncement(announcement *Reminder) error {
+	p.Lock()
+	defer p.Unlock()
+
+	guildID := announcement.Announcement.GuildID
+	n := p.announcer.count(announcementsIn(guildID))
+	for _, r := range p.paused {
+		if r.Announcement.GuildID == guildID {
+			n++
+		}
+	}
+	if n >= maxAnnouncements {
+		return fmt.Errorf("This server already has %d announcements.", maxAnnouncements)
+	}
+
+	if announcement.ID == "" {
+		announcement.ID = p.newID()
+	}
+	p.announcer.add(announcement)
+	return nil
+}
+
+// announcements returns copies of a guild's announcements, paused ones last.
+func (p *ReminderPlugin) announcements(guildID string) []*Reminder {
+	announcements := p.announcer.reminders(announcementsIn(guildID))
+
+	p.RLock()
+	defer p.RUnlock()
+	for _, r := range p.paused {
+		if r.Announcement.GuildID == guildID {
+			c := r.copy()
+			announcements = append(announcements, &c)
+		}
+	}
+	return announcements
+}
+
+// announcement returns a copy of an announcement whether it is paused or not.
+func (p *ReminderPlugin) announcement(guildID, id string) (*Reminder, error) {
+	for _, r := range p.announcements(guildID) {
+		if strings.EqualFold(r.ID, id) {
+			return r, nil
+		}
+	}
+	return nil, errNoAnnouncement
+}
+
+func (p *ReminderPlugin) pauseAnnouncement(guildID, id string) (Reminder, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	r, ok := p.announcer.remove(announcementIn(guildID, id))
+	if !ok {
+		return Reminder{}, errNoAnnouncement
+	}
+	r.Announcement.Paused = true
+	p.paused[r.ID] = &r
+	return r, nil
+}
+
+// resumeAnnouncement schedules a paused announcement again, at the time in
+// when if there is one. Recurring announcements skip what they missed while
+// paused, others need a new time once theirs has passed.
+func (p *ReminderPlugin) resumeAnnouncement(guildID, id string, when []string, now time.Time) (Reminder, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	var r *Reminder
+	for _, paused := range p.paused {
+		if announcementIn(guildID, id)(paused) {
+			r = paused
+		}
+	}
+	if r == nil {
+		return Reminder{}, errNoAnnouncement
+	}
+
+	t := r.Time
+	if len(when) > 0 {
+		var rest []string
+		var err error
+		t, rest, err = parseWhen(when, now)
+		if err == nil && len(rest) > 0 {
+			err = &ParseError{Input: strings.Join(rest, " "), Reason: "expected nothing after the time"}
+		}
+		if err == nil {
+			err = validTime(t, now)
+		}
+		if err != nil {
+			return Reminder{}, err
+		}
+	} else if t.Before(now) {
+		if r.Recurrence == nil {
+			return Reminder{}, fmt.Errorf("it was due %s, give it a new time", humanize.RelTime(t, now, "ago", "from now"))
+		}
+		next, ok := r.Recurrence.Next(t, now)
+		if !ok {
+			return Reminder{}, errors.New("it has finished repeating")
+		}
+		t = next
+	}
+
+	delete(p.paused, r.ID)
+	r.Time = t
+	r.Announcement.Paused = false
+	resumed := r.copy()
+	p.announcer.add(r)
+	return resumed, nil
+}
+
+func (p *ReminderPlugin) deleteAnnouncement(guildID, id string) (Reminder, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	if r, ok := p.announcer.remove(announcementIn(guildID, id)); ok {
+		return r, nil
+	}
+	for _, r := range p.paused {
+		if announcementIn(guildID, id)(r) {
+			delete(p.paused, r.ID)
+			return r.copy(), nil
+		}
+	}
+	return Reminder{}, errNoAnnouncement
+}
+
+// fireAnnouncements posts the announcements that are due, those that were
+// due too long ago while the bot was down are reported to their admin
+// instead.
+func (p *ReminderPlugin) fireAnnouncements(due []*Reminder) {
+	p.RLock()
+	policy := p.CatchUp
+	p.RUnlock()
+	now := p.clock.Now()
+
+	for _, r := range due {
+		if policy.MaxLate > 0 && now.Sub(r.Time) > policy.MaxLate {
+			p.recordFailure(r, fmt.Sprintf("missed while the bot was down, announcements are posted up to %s late", formatDuration(policy.MaxLate)))
+			continue
+		}
+		if _, err := p.session().ChannelMessageSendComplex(r.Target, announcementMessage(r)); err != nil {
+			log.Println("Error posting announcement", err)
+			p.recordFailure(r, failureReason(err))
+		}
+	}
+}
+
+// preview posts an announcement as it will look in channel, without
+// notifying anyone.
+func (p *ReminderPlugin) preview(channel string, r *Reminder, loc *time.Location) {
+	send := announcementMessage(r)
+	send.AllowedMentions = &discordgo.MessageAllowedMentions{}
+	when := formatTime(r.Time, loc)
+	if r.Recurrence != nil {
+		when += fmt.Sprintf(", repeating %s", r.Recurrence)
+	}
+	if r.Announcement.Paused {
+		when += ", paused"
+	}
+	send.Content = fmt.Sprintf("_Announcement %s posts in <#%s> %s:_\n%s", r.ID, r.Target, when, send.Content)
+	if _, err := p.session().ChannelMessageSendComplex(channel, send); err != nil {
+		log.Println("Error sending preview", err)
+	}
+}
+
+// channelGuild returns the ID of the guild a channel is in.
+func (p *ReminderPlugin) channelGuild(channelID string) string {
+	c, err := p.discord.Channel(channelID)
+	if err != nil {
+		return ""
+	}
+	return c.GuildID
+}
+
+// handleAnnounce handles the `announce` command, only server admins can use
+// it.
+func (p *ReminderPlugin) handleAnnounce(service bruxism.Service, message bruxism.Message, requester string) {
+	if service.Name() != bruxism.DiscordServiceName || service.IsPrivate(message) {
+		service.SendMessage(message.Channel(), "Announcements can only be scheduled in a server channel.")
+		return
+	}
+	if !service.IsModerator(message) {
+		service.SendMessage(message.Channel(), "Only server admins can schedule announcements.")
+		return
+	}
+	guildID := p.channelGuild(message.Channel())
+	if guildID == "" {
+		service.SendMessage(message.Channel(), "Announcements can only be scheduled in a server channel.")
+		return
+	}
+
+	parts := rawParts(service, message, "announce")
+	if len(parts) == 0 {
+		service.SendMessage(message.Channel(), "eg: announce #events every friday at 10am Weekly event thread | This week's event | Sign up below")
+		return
+	}
+	loc := p.location(message.UserID())
+	now := p.clock.Now().In(loc)
+
+	command := strings.ToLower(parts[0])
+	switch command {
+	case "list":
+		announcements := []string{}
+		for _, r := range p.announcements(guildID) {
+			announcements = append(announcements, announcementLine(r))
+		}
+		if len(announcements) == 0 {
+			service.SendMessage(message.Channel(), "There are no announcements.")
+			return
+		}
+		p.sendQuiet(service, message.Channel(), fmt.Sprintf("Announcements:\n%s", strings.Join(announcements, "\n")))
+		return
+	case "preview", "pause", "resume", "delete":
+		if len(parts) < 2 {
+			service.SendMessage(message.Channel(), fmt.Sprintf("Which announcement? eg: announce %s k3p9", command))
+			return
+		}
+		id := parts[1]
+		var r Reminder
+		var err error
+		switch command {
+		case "preview":
+			var a *Reminder
+			if a, err = p.announcement(guildID, id); err == nil {
+				p.preview(message.Channel(), a, loc)
+				return
+			}
+		case "pause":
+			if r, err = p.pauseAnnouncement(guildID, id); err == nil {
+				service.SendMessage(message.Channel(), fmt.Sprintf("Paused announcement %s, resume it with `announce resume %s`.", r.ID, r.ID))
+				return
+			}
+		case "resume":
+			if r, err = p.resumeAnnouncement(guildID, id, parts[2:], now); err == nil {
+				service.SendMessage(message.Channel(), fmt.Sprintf("Resumed announcement %s, it posts in <#%s> %s.", r.ID, r.Target, formatTime(r.Time, loc)))
+				return
+			}
+		case "delete":
+			if r, err = p.deleteAnnouncement(guildID, id); err == nil {
+				service.SendMessage(message.Channel(), fmt.Sprintf("Deleted announcement %s.", r.ID))
+				return
+			}
+		}
+		service.SendMessage(message.Channel(), fmt.Sprintf("Couldn't %s %s, %s.", command, id, err))
+		return
+	}
+
+	m := channelMentionRegexp.FindStringSubmatch(parts[0])
+	if m == nil || len(parts) < 3 {
+		service.SendMessage(message.Channel(), "Invalid announcement, no channel, time or message. eg: announce #events every friday at 10am Weekly event thread")
+		return
+	}
+	channelID := m[1]
+	if p.channelGuild(channelID) != guildID {
+		service.SendMessage(message.Channel(), "Announcements can only be posted in this server.")
+		return
+	}
+
+	t, recurrence, rest, err := parseSchedule(parts[1:], now)
+	if err != nil {
+		service.SendMessage(message.Channel(), fmt.Sprintf("Invalid time, %s.", err))
+		return
+	}
+	if err := validTime(t, now); err != nil {
+		service.SendMessage(message.Channel(), fmt.Sprintf("Invalid time, %s.", err))
+		return
+	}
+	content, embed, err := parseAnnouncement(rawSuffix(message.RawMessage(), len(rest)))
+	if len(rest) == 0 {
+		err = errors.New("no message")
+	}
+	if err != nil {
+		service.SendMessage(message.Channel(), fmt.Sprintf("Invalid announcement, %s.", err))
+		return
+	}
+
+	announcement := &Reminder{
+		StartTime:    now,
+		Time:         t,
+		Requester:    requester,
+		Target:       channelID,
+		Message:      content,
+		Recurrence:   recurrence,
+		Announcement: &Announcement{GuildID: guildID, Embed: embed},
+	}
+	if err := p.addAnnouncement(announcement); err != nil {
+		service.SendMessage(message.Channel(), err.Error())
+		return
+	}
+	p.preview(message.Channel(), announcement, loc)
+}
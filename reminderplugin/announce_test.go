@@ -0,0 +1,196 @@
+package reminderplugin
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAnnouncement(t *testing.T) {
+	cases := []struct {
+		text    string
+		content string
+		embed   *Embed
+		err     bool
+	}{
+		{"Weekly event thread", "Weekly event thread", nil, false},
+		{"@everyone ||spoilers|| ahead", "@everyone ||spoilers|| ahead", nil, false},
+		{"Sign up! | Game night", "Sign up!", &Embed{Title: "Game night"}, false},
+		{"- | Game night | Friday at 8\nBring snacks | #ff8800 | https://example.com/a.png", "", &Embed{Title: "Game night", Description: "Friday at 8\nBring snacks", Color: 0xff8800, Image: "https://example.com/a.png"}, false},
+		{"-", "", nil, true},
+		{"hi | title | description | orange", "", nil, true},
+	}
+
+	for _, c := range cases {
+		content, embed, err := parseAnnouncement(c.text)
+		if c.err {
+			if err == nil {
+				t.Errorf("expected '%s' to be invalid", c.text)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error for '%s': %s", c.text, err)
+			continue
+		}
+		if content != c.content {
+			t.Errorf("expected content '%s' but got '%s'", c.content, content)
+		}
+		if (embed == nil) != (c.embed == nil) || (embed != nil && *embed != *c.embed) {
+			t.Errorf("expected embed %+v but got %+v", c.embed, embed)
+		}
+	}
+}
+
+func TestRawSuffix(t *testing.T) {
+	cases := []struct {
+		raw      string
+		n        int
+		expected string
+	}{
+		{"announce <#1> tomorrow hello there", 2, "hello there"},
+		{"announce <#1> tomorrow **Game night**\n\nBring  snacks\n", 4, "**Game night**\n\nBring  snacks"},
+		{"announce <#1> tomorrow hi", 0, ""},
+	}
+	for _, c := range cases {
+		if s := rawSuffix(c.raw, c.n); s != c.expected {
+			t.Errorf("expected '%s' but got '%s'", c.expected, s)
+		}
+	}
+}
+
+func TestAnnouncementsAreSeparateFromReminders(t *testing.T) {
+	_, p, _ := newTestPlugin()
+
+	for i := 0; i < 21; i++ {
+		p.AddReminder(&Reminder{Time: testNow.Add(time.Hour), Requester: "<@1>", Message: "mine"})
+	}
+	if err := p.AddReminder(&Reminder{Time: testNow.Add(time.Hour), Requester: "<@1>", Message: "mine"}); err == nil {
+		t.Fatal("expected the reminder limit to apply")
+	}
+
+	a := &Reminder{Time: testNow.Add(time.Hour), Requester: "<@1>", Target: "events", Message: "event", Announcement: &Announcement{GuildID: "g"}}
+	if err := p.addAnnouncement(a); err != nil {
+		t.Fatalf("expected announcements not to count towards reminders: %s", err)
+	}
+	if len(p.listReminders("<@1>")) != 21 {
+		t.Error("expected announcements not to be listed with reminders")
+	}
+	if len(p.announcements("g")) != 1 || len(p.announcements("other")) != 0 {
+		t.Error("expected announcements to be listed by server")
+	}
+
+	for i := 1; i < maxAnnouncements; i++ {
+		p.addAnnouncement(&Reminder{Time: testNow.Add(time.Hour), Target: "events", Message: "event", Announcement: &Announcement{GuildID: "g"}})
+	}
+	if err := p.addAnnouncement(&Reminder{Time: testNow.Add(time.Hour), Target: "events", Message: "event", Announcement: &Announcement{GuildID: "g"}}); err == nil {
+		t.Error("expected the announcement limit to apply")
+	}
+}
+
+func TestAnnouncementPauseAndResume(t *testing.T) {
+	clock, p, sender := newTestPlugin()
+
+	_, rec, _, err := parseRecurrence(strings.Fields("every day at 3pm"), testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &Reminder{Time: testNow.Add(30 * time.Minute), Requester: "<@1>", Target: "events", Message: "daily", Recurrence: rec, Announcement: &Announcement{GuildID: "g", Embed: &Embed{Title: "Today"}}}
+	p.addAnnouncement(a)
+
+	clock.advance(time.Hour)
+	if len(sender.sent) != 1 || sender.sent[0] != "events" || len(sender.messages[0].Embeds) != 1 || sender.messages[0].Embeds[0].Title != "Today" {
+		t.Fatalf("expected the announcement to be posted with its embed: %v", sender.sent)
+	}
+
+	if _, err := p.pauseAnnouncement("other", a.ID); err != errNoAnnouncement {
+		t.Errorf("expected other servers not to be able to pause it, got %v", err)
+	}
+	if _, err := p.pauseAnnouncement("g", a.ID); err != nil {
+		t.Fatal(err)
+	}
+	clock.advance(48 * time.Hour)
+	if len(sender.sent) != 1 {
+		t.Fatal("expected a paused announcement not to be posted")
+	}
+	if r, err := p.announcement("g", a.ID); err != nil || !r.Announcement.Paused {
+		t.Errorf("expected the announcement to be listed as paused")
+	}
+
+	resumed, err := p.resumeAnnouncement("g", a.ID, nil, clock.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resumed.Time.After(clock.Now()) || resumed.Time.Hour() != 15 {
+		t.Errorf("expected the missed posts to be skipped but it's due %s", resumed.Time)
+	}
+	clock.advance(24 * time.Hour)
+	if len(sender.sent) != 2 {
+		t.Errorf("expected the resumed announcement to be posted once but got %d posts", len(sender.sent))
+	}
+}
+
+func TestResumeOneOffAnnouncement(t *testing.T) {
+	clock, p, _ := newTestPlugin()
+
+	a := &Reminder{Time: testNow.Add(time.Hour), Target: "events", Message: "once", Announcement: &Announcement{GuildID: "g"}}
+	p.addAnnouncement(a)
+	p.pauseAnnouncement("g", a.ID)
+	clock.advance(2 * time.Hour)
+
+	if _, err := p.resumeAnnouncement("g", a.ID, nil, clock.Now()); err == nil {
+		t.Fatal("expected a passed announcement to need a new time")
+	}
+	resumed, err := p.resumeAnnouncement("g", a.ID, []string{"1h"}, clock.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resumed.Time.Equal(clock.Now().Add(time.Hour)) {
+		t.Errorf("expected the announcement to be due in an hour but got %s", resumed.Time)
+	}
+
+	if _, err := p.deleteAnnouncement("g", a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.announcements("g")) != 0 {
+		t.Error("expected the announcement to be deleted")
+	}
+}
+
+func TestAnnouncementFailures(t *testing.T) {
+	clock, p, sender := newTestPlugin()
+	sender.fail = map[string]error{"events": errors.New("gone")}
+
+	p.addAnnouncement(&Reminder{Time: testNow.Add(time.Minute), Requester: "<@1>", Target: "events", Message: "event", Announcement: &Announcement{GuildID: "g"}})
+	clock.advance(time.Hour)
+
+	lines := p.takeFailures("<@1>")
+	if len(lines) != 1 || !strings.Contains(lines[0], "gone") {
+		t.Errorf("expected the admin to be told the announcement failed: %v", lines)
+	}
+}
+
+func TestSaveLoadAnnouncements(t *testing.T) {
+	clock, p, _ := newTestPlugin()
+	a := &Reminder{Time: testNow.Add(time.Hour), Target: "events", Message: "one", Announcement: &Announcement{GuildID: "g"}}
+	b := &Reminder{Time: testNow.Add(time.Hour), Target: "events", Message: "two", Announcement: &Announcement{GuildID: "g", Embed: &Embed{Title: "Two"}}}
+	p.addAnnouncement(a)
+	p.addAnnouncement(b)
+	p.pauseAnnouncement("g", b.ID)
+
+	data, err := p.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := &ReminderPlugin{clock: clock, scheduler: newScheduler(clock), announcer: newScheduler(clock)}
+	loaded.load(data)
+	if n := loaded.announcer.count(announcementsIn("g")); n != 1 {
+		t.Errorf("expected one scheduled announcement but got %d", n)
+	}
+	paused, err := loaded.announcement("g", b.ID)
+	if err != nil || !paused.Announcement.Paused || paused.Announcement.Embed.Title != "Two" {
+		t.Errorf("expected the paused announcement to stay paused: %+v", paused)
+	}
+}
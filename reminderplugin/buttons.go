@@ -0,0 +1,222 @@
+package reminderplugin
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// deliveredTTL is how long the buttons on a delivered reminder keep working.
+const deliveredTTL = 7 * 24 * time.Hour
+
+const buttonPrefix = "reminder:"
+
+// snoozes are the snooze buttons, by action, with the time they snooze until.
+var snoozes = []struct {
+	action string
+	label  string
+	when   []string
+}{
+	{"snooze-10m", "Snooze 10m", []string{"10m"}},
+	{"snooze-1h", "Snooze 1h", []string{"1h"}},
+	{"snooze-tomorrow", "Tomorrow", []string{"tomorrow"}},
+}
+
+// reminderButtons returns the snooze and done buttons for a delivered
+// reminder.
+func reminderButtons(id string) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{buttonRow(id, "")}
+}
+
+// batchButtons returns a row of buttons for each batched reminder, labelled
+// with the reminder's number in the message starting at first.
+func batchButtons(reminders []*Reminder, first int) []discordgo.MessageComponent {
+	rows := []discordgo.MessageComponent{}
+	for i, r := range reminders {
+		rows = append(rows, buttonRow(r.ID, fmt.Sprintf("%d: ", first+i)))
+	}
+	return rows
+}
+
+func buttonRow(id, prefix string) discordgo.ActionsRow {
+	buttons := []discordgo.MessageComponent{}
+	for _, s := range snoozes {
+		buttons = append(buttons, discordgo.Button{
+			Label:    prefix + s.label,
+			Style:    discordgo.SecondaryButton,
+			CustomID: buttonPrefix + s.action + ":" + id,
+		})
+	}
+	buttons = append(buttons, discordgo.Button{
+		Label:    prefix + "Done",
+		Style:    discordgo.SuccessButton,
+		CustomID: buttonPrefix + "done:" + id,
+	})
+	return discordgo.ActionsRow{Components: buttons}
+}
+
+// otherButtons returns the rows of buttons on a message that aren't for the
+// reminder, batched reminders share a message.
+func otherButtons(m *discordgo.Message, id string) []discordgo.MessageComponent {
+	rows := []discordgo.MessageComponent{}
+	if m == nil {
+		return rows
+	}
+	for _, c := range m.Components {
+		var buttons []discordgo.MessageComponent
+		switch row := c.(type) {
+		case *discordgo.ActionsRow:
+			buttons = row.Components
+		case discordgo.ActionsRow:
+			buttons = row.Components
+		}
+		other := true
+		for _, b := range buttons {
+			if button, ok := b.(*discordgo.Button); ok && strings.HasSuffix(button.CustomID, ":"+id) {
+				other = false
+			}
+			if button, ok := b.(discordgo.Button); ok && strings.HasSuffix(button.CustomID, ":"+id) {
+				other = false
+			}
+		}
+		if other {
+			rows = append(rows, c)
+		}
+	}
+	return rows
+}
+
+// delivered remembers a sent reminder so that its buttons can act on it.
+func (p *ReminderPlugin) delivered(reminder *Reminder) {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.Delivered == nil {
+		p.Delivered = map[string]*Reminder{}
+	}
+	now := p.clock.Now()
+	for id, r := range p.Delivered {
+		if now.Sub(r.Time) > deliveredTTL {
+			delete(p.Delivered, id)
+		}
+	}
+
+	c := reminder.copy()
+	p.Delivered[reminder.ID] = &c
+}
+
+// takeDelivered removes a delivered reminder if it belongs to requester.
+func (p *ReminderPlugin) takeDelivered(requester, id string) (*Reminder, bool) {
+	p.Lock()
+	defer p.Unlock()
+
+	r, ok := p.Delivered[id]
+	if !ok || r.Requester != requester {
+		return nil, false
+	}
+	delete(p.Delivered, id)
+	return r, true
+}
+
+// handleReminderButton snoozes or acknowledges a delivered reminder.
+func (p *ReminderPlugin) handleReminderButton(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	parts := strings.SplitN(strings.TrimPrefix(i.MessageComponentData().CustomID, buttonPrefix), ":", 2)
+	if len(parts) != 2 {
+		return
+	}
+	action, id := parts[0], parts[1]
+	requester := fmt.Sprintf("<@%s>", userID(i))
+
+	p.RLock()
+	r, ok := p.Delivered[id]
+	p.RUnlock()
+	if ok && r.Requester != requester {
+		p.sendEphemeralResponse(s, i, "This isn't your reminder.")
+		return
+	}
+
+	content := ""
+	if i.Message != nil {
+		content = i.Message.Content
+	}
+	rows := otherButtons(i.Message, id)
+
+	r, ok = p.takeDelivered(requester, id)
+	if !ok {
+		p.updateMessage(s, i, content+"\nThis reminder can't be changed anymore.", rows)
+		return
+	}
+
+	// name the reminder when it shares the message with others
+	label := ""
+	if i.Message != nil && len(i.Message.Components) > 1 {
+		label = r.Message + ": "
+	}
+
+	if action == "done" {
+		p.updateMessage(s, i, content+"\n✅ "+label+"Done.", rows)
+		return
+	}
+
+	for _, snooze := range snoozes {
+		if snooze.action != action {
+			continue
+		}
+
+		loc := p.location(userID(i))
+		now := p.clock.Now().In(loc)
+		t, _, err := parseWhen(snooze.when, now)
+		if err != nil {
+			log.Print("unable to snooze reminder: ", err)
+			return
+		}
+
+		snoozed := r.copy()
+		snoozed.Time = t
+		if snoozed.Recurrence != nil {
+			// the schedule carries on, the snooze is a one off
+			snoozed.ID = ""
+			snoozed.Recurrence = nil
+		}
+		if err := p.AddReminder(&snoozed); err != nil {
+			p.delivered(r)
+			p.sendEphemeralResponse(s, i, err.Error())
+			return
+		}
+		p.updateMessage(s, i, content+fmt.Sprintf("\n💤 %sSnoozed until %s.", label, formatTime(t, loc)), rows)
+		return
+	}
+}
+
+// updateMessage replaces the message the buttons were on, keeping only the
+// rows of buttons for other reminders.
+func (p *ReminderPlugin) updateMessage(s *discordgo.Session, i *discordgo.InteractionCreate, content string, rows []discordgo.MessageComponent) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:         content,
+			Components:      rows,
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		},
+	})
+	if err != nil {
+		log.Print("unable to update reminder message: ", err)
+	}
+}
+
+func (p *ReminderPlugin) sendEphemeralResponse(s *discordgo.Session, i *discordgo.InteractionCreate, msg string) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content:         msg,
+			Flags:           discordgo.MessageFlagsEphemeral,
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		},
+	})
+	if err != nil {
+		log.Print("unable to respond: ", err)
+	}
+}
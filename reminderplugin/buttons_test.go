@@ -0,0 +1,77 @@
+package reminderplugin
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestReminderButtons(t *testing.T) {
+	rows := reminderButtons("k3p9")
+	if len(rows) != 1 {
+		t.Fatalf("expected a single row of buttons but got %d", len(rows))
+	}
+	buttons := rows[0].(discordgo.ActionsRow).Components
+	if len(buttons) != len(snoozes)+1 {
+		t.Fatalf("expected %d buttons but got %d", len(snoozes)+1, len(buttons))
+	}
+	for _, b := range buttons {
+		id := b.(discordgo.Button).CustomID
+		if !strings.HasPrefix(id, buttonPrefix) || !strings.HasSuffix(id, ":k3p9") || len(id) > 100 {
+			t.Errorf("unexpected custom id %s", id)
+		}
+	}
+}
+
+func TestDelivered(t *testing.T) {
+	clock, p, _ := newTestPlugin()
+
+	old := &Reminder{ID: "old1", Time: testNow, Requester: "a", Message: "old"}
+	p.delivered(old)
+	clock.advance(deliveredTTL + time.Hour)
+
+	r := &Reminder{ID: "new1", Time: clock.Now(), Requester: "a", Message: "new"}
+	p.delivered(r)
+	r.Message = "changed after delivery"
+
+	if _, ok := p.Delivered["old1"]; ok {
+		t.Error("expected old deliveries to be forgotten")
+	}
+	if _, ok := p.takeDelivered("b", "new1"); ok {
+		t.Error("expected other users not to be able to act on the reminder")
+	}
+	taken, ok := p.takeDelivered("a", "new1")
+	if !ok || taken.Message != "new" {
+		t.Fatalf("expected the delivered reminder but got %+v", taken)
+	}
+	if _, ok := p.takeDelivered("a", "new1"); ok {
+		t.Error("expected a delivered reminder to only be acted on once")
+	}
+}
+
+func TestOtherButtons(t *testing.T) {
+	batch := []*Reminder{{ID: "a1"}, {ID: "b2"}, {ID: "c3"}}
+	m := &discordgo.Message{Components: batchButtons(batch, 1)}
+
+	rows := otherButtons(m, "b2")
+	if len(rows) != 2 {
+		t.Fatalf("expected the buttons of the other 2 reminders but got %d rows", len(rows))
+	}
+	for _, row := range rows {
+		for _, b := range row.(discordgo.ActionsRow).Components {
+			if strings.HasSuffix(b.(discordgo.Button).CustomID, ":b2") {
+				t.Errorf("expected the buttons of b2 to be removed")
+			}
+		}
+	}
+	label := rows[1].(discordgo.ActionsRow).Components[0].(discordgo.Button).Label
+	if label != "3: Snooze 10m" {
+		t.Errorf("expected numbered labels but got %s", label)
+	}
+
+	if rows := otherButtons(&discordgo.Message{Components: reminderButtons("a1")}, "a1"); len(rows) != 0 {
+		t.Errorf("expected no buttons left on a single reminder but got %d rows", len(rows))
+	}
+}
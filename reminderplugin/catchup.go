@@ -0,0 +1,217 @@
+package reminderplugin
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/dustin/go-humanize"
+	"github.com/iopred/bruxism"
+)
+
+// lateAfter is how overdue a reminder has to be before it is treated as
+// missed while the bot was down.
+const lateAfter = time.Minute
+
+// maxBatchRows is how many reminders a batch message has buttons for,
+// discord allows 5 rows of buttons on a message.
+const maxBatchRows = 5
+
+// A CatchUp is the policy for reminders that were due while the bot was down.
+type CatchUp struct {
+	// MaxLate is how overdue a reminder can be and still be delivered, later
+	// ones are reported to the requester instead. Zero delivers them all.
+	MaxLate time.Duration
+	// Batch sends a requester's overdue reminders for a channel in one
+	// message.
+	Batch bool
+}
+
+var defaultCatchUp = CatchUp{MaxLate: 48 * time.Hour, Batch: true}
+
+func (c CatchUp) String() string {
+	max := "delivered however late they are"
+	if c.MaxLate > 0 {
+		max = fmt.Sprintf("delivered up to %s late", formatDuration(c.MaxLate))
+	}
+	batch := "one at a time"
+	if c.Batch {
+		batch = "batched per user"
+	}
+	return fmt.Sprintf("Missed reminders are %s, %s.", max, batch)
+}
+
+func formatDuration(d time.Duration) string {
+	if d >= 24*time.Hour && d%(24*time.Hour) == 0 {
+		days := int(d / (24 * time.Hour))
+		if days == 1 {
+			return "1 day"
+		}
+		return fmt.Sprintf("%d days", days)
+	}
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// fire delivers the reminders that are due, those that are late because the
+// bot was down are handled by the catch up policy.
+func (p *ReminderPlugin) fire(service bruxism.Service, due []*Reminder) {
+	p.RLock()
+	policy := p.CatchUp
+	p.RUnlock()
+	now := p.clock.Now()
+
+	type group struct {
+		late, missed []*Reminder
+	}
+	groups := map[string]*group{}
+	keys := []string{}
+	groupOf := func(r *Reminder) *group {
+		key := r.Requester + " " + r.Target
+		g, ok := groups[key]
+		if !ok {
+			g = &group{}
+			groups[key] = g
+			keys = append(keys, key)
+		}
+		return g
+	}
+
+	for _, r := range due {
+		late := now.Sub(r.Time)
+		switch {
+		case late <= lateAfter:
+			p.SendReminder(service, r)
+		case policy.MaxLate > 0 && late > policy.MaxLate:
+			g := groupOf(r)
+			g.missed = append(g.missed, r)
+		case !policy.Batch || len(r.Mentions) > 0 || len(r.Roles) > 0:
+			p.SendReminder(service, r)
+		default:
+			g := groupOf(r)
+			g.late = append(g.late, r)
+		}
+	}
+
+	for _, key := range keys {
+		g := groups[key]
+		if len(g.late) == 1 {
+			p.SendReminder(service, g.late[0])
+		} else if len(g.late) > 1 {
+			p.sendBatch(service, g.late, now)
+		}
+		if len(g.missed) > 0 {
+			p.reportMissed(service, g.missed, policy, now)
+		}
+	}
+}
+
+func whoText(reminder *Reminder) string {
+	if reminder.IsPrivate {
+		return "You"
+	}
+	return reminder.Requester
+}
+
+func missedLines(reminders []*Reminder, now time.Time) string {
+	lines := []string{}
+	for _, r := range reminders {
+		lines = append(lines, fmt.Sprintf("- %s, due %s", r.Message, humanize.RelTime(r.Time, now, "ago", "from now")))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// sendBatch delivers a requester's overdue reminders in one message, or one
+// per maxBatchRows reminders, with numbered buttons for each.
+func (p *ReminderPlugin) sendBatch(service bruxism.Service, reminders []*Reminder, now time.Time) {
+	first := reminders[0]
+	for start := 0; start < len(reminders); start += maxBatchRows {
+		batch := reminders[start:min(start+maxBatchRows, len(reminders))]
+		lines := []string{}
+		if start == 0 {
+			lines = append(lines, fmt.Sprintf("%s missed %d reminders while I was away:", whoText(first), len(reminders)))
+		}
+		for i, r := range batch {
+			lines = append(lines, fmt.Sprintf("%d. %s, due %s", start+i+1, r.Message, humanize.RelTime(r.Time, now, "ago", "from now")))
+		}
+		err := p.post(service, first, &discordgo.MessageSend{
+			Content:         strings.Join(lines, "\n"),
+			Components:      batchButtons(batch, start+1),
+			AllowedMentions: p.allowedMentions(first),
+		})
+		for _, r := range batch {
+			if err != nil {
+				p.recordFailure(r, err.Error())
+			} else if service.Name() == bruxism.DiscordServiceName {
+				p.delivered(r)
+			}
+		}
+	}
+}
+
+// reportMissed tells the requester about reminders that were too late to be
+// delivered.
+func (p *ReminderPlugin) reportMissed(service bruxism.Service, reminders []*Reminder, policy CatchUp, now time.Time) {
+	first := reminders[0]
+	text := fmt.Sprintf("%s, these reminders were more than %s late when I came back so they weren't sent:\n%s", whoText(first), formatDuration(policy.MaxLate), missedLines(reminders, now))
+	err := p.post(service, first, &discordgo.MessageSend{
+		Content:         text,
+		AllowedMentions: p.allowedMentions(&Reminder{Requester: first.Requester, IsPrivate: first.IsPrivate}),
+	})
+	if err != nil {
+		for _, r := range reminders {
+			p.recordFailure(r, "missed while the bot was down, "+err.Error())
+		}
+	}
+}
+
+// handleCatchUp handles `reminder catchup [<max late>|forever] [batch on|off]`,
+// only the bot owner can change the policy.
+func (p *ReminderPlugin) handleCatchUp(service bruxism.Service, message bruxism.Message, parts []string) {
+	p.RLock()
+	policy := p.CatchUp
+	p.RUnlock()
+
+	if len(parts) < 2 {
+		service.SendMessage(message.Channel(), policy.String())
+		return
+	}
+	if !service.IsBotOwner(message) {
+		service.SendMessage(message.Channel(), "Only the bot owner can change how missed reminders are handled.")
+		return
+	}
+
+	switch strings.ToLower(parts[1]) {
+	case "batch":
+		if len(parts) < 3 {
+			service.SendMessage(message.Channel(), "eg: reminder catchup batch on")
+			return
+		}
+		policy.Batch = strings.EqualFold(parts[2], "on")
+	case "forever":
+		policy.MaxLate = 0
+	default:
+		now := p.clock.Now()
+		t, rest, err := parseWhen(parts[1:], now)
+		if err == nil && len(rest) > 0 {
+			err = &ParseError{Input: strings.Join(rest, " "), Reason: "expected nothing after the time"}
+		}
+		if err != nil {
+			service.SendMessage(message.Channel(), fmt.Sprintf("Invalid time, %s. eg: reminder catchup 2d", err))
+			return
+		}
+		policy.MaxLate = t.Sub(now)
+	}
+
+	p.Lock()
+	p.CatchUp = policy
+	p.Unlock()
+	service.SendMessage(message.Channel(), policy.String())
+}
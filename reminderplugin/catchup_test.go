@@ -0,0 +1,120 @@
+package reminderplugin
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCatchUp(t *testing.T) {
+	clock, p, sender := newTestPlugin()
+
+	p.AddReminder(&Reminder{Time: testNow.Add(-5 * time.Minute), Requester: "<@1>", Target: "c", Message: "tea"})
+	p.AddReminder(&Reminder{Time: testNow.Add(-time.Hour), Requester: "<@1>", Target: "c", Message: "stretch"})
+	p.AddReminder(&Reminder{Time: testNow.Add(-72 * time.Hour), Requester: "<@1>", Target: "c", Message: "ancient"})
+	p.AddReminder(&Reminder{Time: testNow.Add(-2 * time.Hour), Requester: "<@2>", Target: "c", Message: "walk"})
+	p.AddReminder(&Reminder{Time: testNow.Add(30 * time.Second), Requester: "<@2>", Target: "c", Message: "on time"})
+
+	p.scheduler.start(func(due []*Reminder) {
+		p.fire(discordService{}, due)
+	})
+	clock.advance(0)
+
+	if len(sender.messages) != 3 {
+		t.Fatalf("expected a batch, a report and a late reminder but got %d messages", len(sender.messages))
+	}
+	contents := []string{}
+	for _, m := range sender.messages {
+		contents = append(contents, m.Content)
+	}
+	all := strings.Join(contents, "\n---\n")
+
+	if !strings.Contains(all, "<@1> missed 2 reminders while I was away:\n1. stretch, due 1 hour ago\n2. tea, due 5 minutes ago") {
+		t.Errorf("expected the overdue reminders to be batched:\n%s", all)
+	}
+	for _, m := range sender.messages {
+		if strings.Contains(m.Content, "missed 2 reminders") && len(m.Components) != 2 {
+			t.Errorf("expected buttons for each batched reminder but got %d rows", len(m.Components))
+		}
+	}
+	delivered := []string{}
+	for _, r := range p.Delivered {
+		delivered = append(delivered, r.Message)
+	}
+	if len(delivered) != 3 {
+		t.Errorf("expected the batched and late reminders to be snoozable but got %v", delivered)
+	}
+	if !strings.Contains(all, "more than 2 days late") || !strings.Contains(all, "- ancient, due 3 days ago") {
+		t.Errorf("expected the ancient reminder to be reported as missed:\n%s", all)
+	}
+	if !strings.Contains(all, "walk\n_This was due 2 hours ago._") {
+		t.Errorf("expected the lone late reminder to note when it was due:\n%s", all)
+	}
+
+	clock.advance(time.Minute)
+	if len(sender.messages) != 4 || strings.Contains(sender.messages[3].Content, "due") {
+		t.Errorf("expected the on time reminder to be sent without a note")
+	}
+}
+
+func TestCatchUpWithoutBatching(t *testing.T) {
+	clock, p, sender := newTestPlugin()
+	p.CatchUp = CatchUp{}
+
+	p.AddReminder(&Reminder{Time: testNow.Add(-5 * time.Minute), Requester: "<@1>", Target: "c", Message: "tea"})
+	p.AddReminder(&Reminder{Time: testNow.Add(-72 * time.Hour), Requester: "<@1>", Target: "c", Message: "ancient"})
+
+	p.scheduler.start(func(due []*Reminder) {
+		p.fire(discordService{}, due)
+	})
+	clock.advance(0)
+
+	if len(sender.messages) != 2 {
+		t.Fatalf("expected every reminder to be delivered on its own but got %d messages", len(sender.messages))
+	}
+	if !strings.Contains(sender.messages[0].Content, "ancient\n_This was due 3 days ago._") {
+		t.Errorf("unexpected message %s", sender.messages[0].Content)
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	cases := map[time.Duration]string{
+		48 * time.Hour:                "2 days",
+		24 * time.Hour:                "1 day",
+		90 * time.Minute:              "1h30m",
+		3 * time.Hour:                 "3h",
+		30*time.Hour + 30*time.Minute: "30h30m",
+	}
+	for d, expected := range cases {
+		if s := formatDuration(d); s != expected {
+			t.Errorf("expected %s to format as %s but got %s", d, expected, s)
+		}
+	}
+}
+
+func TestCatchUpLargeBatch(t *testing.T) {
+	clock, p, sender := newTestPlugin()
+
+	for i := 1; i <= maxBatchRows+2; i++ {
+		p.AddReminder(&Reminder{Time: testNow.Add(-time.Duration(i) * time.Hour), Requester: "<@1>", Target: "c", Message: fmt.Sprintf("task %d", i)})
+	}
+
+	p.scheduler.start(func(due []*Reminder) {
+		p.fire(discordService{}, due)
+	})
+	clock.advance(0)
+
+	if len(sender.messages) != 2 {
+		t.Fatalf("expected the batch to be split in 2 messages but got %d", len(sender.messages))
+	}
+	if len(sender.messages[0].Components) != maxBatchRows || len(sender.messages[1].Components) != 2 {
+		t.Errorf("expected %d and 2 rows of buttons but got %d and %d", maxBatchRows, len(sender.messages[0].Components), len(sender.messages[1].Components))
+	}
+	if !strings.HasPrefix(sender.messages[1].Content, "6. ") {
+		t.Errorf("expected the numbering to carry on but got %s", sender.messages[1].Content)
+	}
+	if len(p.Delivered) != maxBatchRows+2 {
+		t.Errorf("expected every batched reminder to be delivered but got %d", len(p.Delivered))
+	}
+}
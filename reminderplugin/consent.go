@@ -0,0 +1,239 @@
+package reminderplugin
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/iopred/bruxism"
+)
+
+var userMentionRegexp = regexp.MustCompile(`^<@!?(\d+)>$`)
+var roleMentionRegexp = regexp.MustCompile(`^<@&(\d+)>$`)
+
+// A Consent is who a user lets set reminders for them. Nobody can until they
+// allow it.
+type Consent struct {
+	Everyone bool
+	// Allowed and Blocked are user ids, blocking wins over everyone.
+	Allowed []string
+	Blocked []string
+}
+
+func (c *Consent) allows(userID string) bool {
+	if c == nil || contains(c.Blocked, userID) {
+		return false
+	}
+	return c.Everyone || contains(c.Allowed, userID)
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+func without(list []string, s string) []string {
+	out := []string{}
+	for _, l := range list {
+		if l != s {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// mentionID returns the user id in a mention like <@123>.
+func mentionID(mention string) string {
+	m := userMentionRegexp.FindStringSubmatch(mention)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// allows reports if userID lets requesterID set reminders for them.
+func (p *ReminderPlugin) allows(userID, requesterID string) bool {
+	if userID == requesterID {
+		return true
+	}
+	p.RLock()
+	defer p.RUnlock()
+	return p.Consents[userID].allows(requesterID)
+}
+
+// setConsent allows or blocks a user, or everyone when who is empty.
+func (p *ReminderPlugin) setConsent(userID, who string, allow bool) {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.Consents == nil {
+		p.Consents = map[string]*Consent{}
+	}
+	c, ok := p.Consents[userID]
+	if !ok {
+		c = &Consent{}
+		p.Consents[userID] = c
+	}
+
+	switch {
+	case who == "":
+		c.Everyone = allow
+		if !allow {
+			c.Allowed = nil
+		}
+	case allow:
+		c.Blocked = without(c.Blocked, who)
+		if !contains(c.Allowed, who) {
+			c.Allowed = append(c.Allowed, who)
+		}
+	default:
+		c.Allowed = without(c.Allowed, who)
+		if !contains(c.Blocked, who) {
+			c.Blocked = append(c.Blocked, who)
+		}
+	}
+}
+
+func (p *ReminderPlugin) consentText(userID string) string {
+	p.RLock()
+	defer p.RUnlock()
+
+	c := p.Consents[userID]
+	switch {
+	case c == nil:
+		return "Nobody can set reminders for you."
+	case c.Everyone && len(c.Blocked) > 0:
+		return fmt.Sprintf("Everyone except %s can set reminders for you.", mentions(c.Blocked))
+	case c.Everyone:
+		return "Everyone can set reminders for you."
+	case len(c.Allowed) > 0:
+		return fmt.Sprintf("%s can set reminders for you.", mentions(c.Allowed))
+	}
+	return "Nobody can set reminders for you."
+}
+
+func mentions(ids []string) string {
+	m := []string{}
+	for _, id := range ids {
+		m = append(m, fmt.Sprintf("<@%s>", id))
+	}
+	return strings.Join(m, ", ")
+}
+
+// handleConsent handles `reminder allow|block <@user>|everyone` and
+// `reminder consent`.
+func (p *ReminderPlugin) handleConsent(service bruxism.Service, message bruxism.Message, parts []string) {
+	userID := message.UserID()
+	if parts[0] == "consent" {
+		p.sendQuiet(service, message.Channel(), p.consentText(userID))
+		return
+	}
+
+	allow := parts[0] == "allow"
+	if len(parts) < 2 {
+		service.SendMessage(message.Channel(), fmt.Sprintf("Who? eg: reminder %s @someone or reminder %s everyone", parts[0], parts[0]))
+		return
+	}
+
+	who := ""
+	if !strings.EqualFold(parts[1], "everyone") {
+		who = mentionID(parts[1])
+		if who == "" {
+			service.SendMessage(message.Channel(), "Please mention the user.")
+			return
+		}
+	}
+	p.setConsent(userID, who, allow)
+	p.sendQuiet(service, message.Channel(), p.consentText(userID))
+}
+
+// rawParts returns the words after the reminder command as they were typed,
+// mentions stay as <@id> rather than being replaced with names.
+func rawParts(service bruxism.Service, message bruxism.Message, commands ...string) []string {
+	_, parts := bruxism.ParseCommand(service, message)
+	if service.Name() != bruxism.DiscordServiceName {
+		return parts
+	}
+
+	prefix := strings.ToLower(strings.TrimSpace(service.CommandPrefix()))
+	words := strings.Fields(message.RawMessage())
+	for i := 0; i < len(words) && i < 2; i++ {
+		if contains(commands, strings.TrimPrefix(strings.ToLower(words[i]), prefix)) {
+			return words[i+1:]
+		}
+	}
+	return parts
+}
+
+// parseTargets takes the users and roles mentioned at the start of parts.
+func parseTargets(parts []string) (users, roles, rest []string) {
+	for len(parts) > 0 {
+		if m := userMentionRegexp.FindStringSubmatch(parts[0]); m != nil {
+			users = append(users, m[1])
+		} else if m := roleMentionRegexp.FindStringSubmatch(parts[0]); m != nil {
+			roles = append(roles, m[1])
+		} else {
+			break
+		}
+		parts = parts[1:]
+	}
+	return users, roles, parts
+}
+
+// checkTargets returns why the requester can't remind the users and roles, or
+// an empty string if they can.
+func (p *ReminderPlugin) checkTargets(service bruxism.Service, message bruxism.Message, users, roles []string) string {
+	if len(users) == 0 && len(roles) == 0 {
+		return ""
+	}
+	if service.Name() != bruxism.DiscordServiceName || service.IsPrivate(message) {
+		return "Reminders for other people can only be set in a server channel."
+	}
+	if len(roles) > 0 && !service.IsModerator(message) {
+		return "Only server admins can set reminders for roles."
+	}
+	for _, u := range users {
+		if !p.allows(u, message.UserID()) {
+			return fmt.Sprintf("<@%s> hasn't allowed you to set reminders for them, they can with `reminder allow <@%s>`.", u, message.UserID())
+		}
+	}
+	return ""
+}
+
+// allowedMentions is who a delivered reminder may notify: the requester and
+// the users who still allow it, and the roles it was set for.
+func (p *ReminderPlugin) allowedMentions(reminder *Reminder) *discordgo.MessageAllowedMentions {
+	requesterID := mentionID(reminder.Requester)
+	allowed := &discordgo.MessageAllowedMentions{Roles: reminder.Roles}
+	if requesterID != "" && !reminder.IsPrivate {
+		allowed.Users = append(allowed.Users, requesterID)
+	}
+	for _, u := range reminder.Mentions {
+		if p.allows(u, requesterID) && !contains(allowed.Users, u) {
+			allowed.Users = append(allowed.Users, u)
+		}
+	}
+	return allowed
+}
+
+// sendQuiet sends a message without notifying anyone it mentions.
+func (p *ReminderPlugin) sendQuiet(service bruxism.Service, channel, text string) {
+	if service.Name() != bruxism.DiscordServiceName || p.discord == nil {
+		service.SendMessage(channel, text)
+		return
+	}
+
+	_, err := p.discord.Session.ChannelMessageSendComplex(channel, &discordgo.MessageSend{
+		Content:         text,
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		log.Println("Error sending message", err)
+	}
+}
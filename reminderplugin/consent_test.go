@@ -0,0 +1,73 @@
+package reminderplugin
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConsent(t *testing.T) {
+	_, p, _ := newTestPlugin()
+
+	if p.allows("1", "2") {
+		t.Error("expected nobody to be allowed by default")
+	}
+	if !p.allows("1", "1") {
+		t.Error("expected users to always be able to remind themselves")
+	}
+
+	p.setConsent("1", "2", true)
+	if !p.allows("1", "2") || p.allows("1", "3") {
+		t.Error("expected only the allowed user to be allowed")
+	}
+
+	p.setConsent("1", "", true)
+	p.setConsent("1", "3", false)
+	if !p.allows("1", "4") || p.allows("1", "3") {
+		t.Error("expected everyone but the blocked user to be allowed")
+	}
+
+	p.setConsent("1", "3", true)
+	if !p.allows("1", "3") {
+		t.Error("expected allowing a blocked user to unblock them")
+	}
+
+	p.setConsent("1", "", false)
+	if p.allows("1", "2") || p.allows("1", "4") {
+		t.Error("expected blocking everyone to allow nobody")
+	}
+}
+
+func TestParseTargets(t *testing.T) {
+	users, roles, rest := parseTargets(strings.Fields("<@123> <@!456> <@&789> in 10 minutes stand up <@111>"))
+	if !reflect.DeepEqual(users, []string{"123", "456"}) {
+		t.Errorf("unexpected users %v", users)
+	}
+	if !reflect.DeepEqual(roles, []string{"789"}) {
+		t.Errorf("unexpected roles %v", roles)
+	}
+	if r := strings.Join(rest, " "); r != "in 10 minutes stand up <@111>" {
+		t.Errorf("unexpected rest %s", r)
+	}
+}
+
+func TestAllowedMentions(t *testing.T) {
+	_, p, _ := newTestPlugin()
+	p.setConsent("2", "1", true)
+
+	allowed := p.allowedMentions(&Reminder{
+		Requester: "<@1>",
+		Message:   "@everyone <@3> look",
+		Mentions:  []string{"2", "3"},
+		Roles:     []string{"9"},
+	})
+	if len(allowed.Parse) != 0 {
+		t.Errorf("expected no mention types to be parsed but got %v", allowed.Parse)
+	}
+	if !reflect.DeepEqual(allowed.Users, []string{"1", "2"}) {
+		t.Errorf("expected the requester and consenting users only but got %v", allowed.Users)
+	}
+	if !reflect.DeepEqual(allowed.Roles, []string{"9"}) {
+		t.Errorf("unexpected roles %v", allowed.Roles)
+	}
+}
@@ -0,0 +1,193 @@
+package reminderplugin
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/dustin/go-humanize"
+	"github.com/iopred/bruxism"
+)
+
+// maxFailures is how many delivery failures are kept for each requester.
+const maxFailures = 10
+
+// A Failure records a reminder that couldn't be delivered anywhere.
+type Failure struct {
+	ReminderID string
+	Message    string
+	Time       time.Time
+	Reason     string
+}
+
+// messageSender is the part of a discord session reminders are sent with.
+type messageSender interface {
+	ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	UserChannelCreate(recipientID string, options ...discordgo.RequestOption) (*discordgo.Channel, error)
+}
+
+func (p *ReminderPlugin) session() messageSender {
+	if p.sender != nil {
+		return p.sender
+	}
+	return p.discord.Session
+}
+
+// wantsDM reports if a reminder should be delivered by DM first. Reminders
+// for other people are always posted where they can see them.
+func (p *ReminderPlugin) wantsDM(reminder *Reminder) bool {
+	if reminder.IsPrivate || len(reminder.Mentions) > 0 || len(reminder.Roles) > 0 {
+		return false
+	}
+	if reminder.DM {
+		return true
+	}
+	p.RLock()
+	defer p.RUnlock()
+	return p.DMs[mentionID(reminder.Requester)]
+}
+
+func (p *ReminderPlugin) setDMs(userID string, on bool) {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.DMs == nil {
+		p.DMs = map[string]bool{}
+	}
+	if on {
+		p.DMs[userID] = true
+	} else {
+		delete(p.DMs, userID)
+	}
+}
+
+// deliver sends a reminder by DM or in its channel, whichever is preferred,
+// falling back to the other if that fails.
+func (p *ReminderPlugin) deliver(reminder *Reminder, send *discordgo.MessageSend) error {
+	order := []string{"channel"}
+	if p.wantsDM(reminder) {
+		order = []string{"DM", "channel"}
+	} else if !reminder.IsPrivate {
+		order = append(order, "DM")
+	}
+
+	reasons := []string{}
+	for _, target := range order {
+		err := p.deliverTo(target, reminder, send)
+		if err == nil {
+			return nil
+		}
+		log.Println("Error sending reminder by", target, err)
+		reasons = append(reasons, fmt.Sprintf("%s: %s", target, failureReason(err)))
+	}
+	return errors.New(strings.Join(reasons, ", "))
+}
+
+func (p *ReminderPlugin) deliverTo(target string, reminder *Reminder, send *discordgo.MessageSend) error {
+	channelID := reminder.Target
+	if target == "DM" {
+		requesterID := mentionID(reminder.Requester)
+		if requesterID == "" {
+			return errors.New("no user to DM")
+		}
+		c, err := p.session().UserChannelCreate(requesterID)
+		if err != nil {
+			return err
+		}
+		channelID = c.ID
+	}
+	_, err := p.session().ChannelMessageSendComplex(channelID, send)
+	return err
+}
+
+// failureReason explains a discord error to the requester.
+func failureReason(err error) string {
+	var rerr *discordgo.RESTError
+	if !errors.As(err, &rerr) {
+		return err.Error()
+	}
+	if rerr.Message != nil {
+		switch rerr.Message.Code {
+		case discordgo.ErrCodeCannotSendMessagesToThisUser:
+			return "your DMs are closed"
+		case discordgo.ErrCodeUnknownChannel:
+			return "the channel was deleted"
+		case discordgo.ErrCodeMissingAccess, discordgo.ErrCodeMissingPermissions:
+			return "the bot can't post there"
+		}
+	}
+	if rerr.Response != nil {
+		switch rerr.Response.StatusCode {
+		case http.StatusNotFound:
+			return "the channel was deleted"
+		case http.StatusForbidden:
+			return "the bot can't post there"
+		}
+	}
+	return err.Error()
+}
+
+// recordFailure keeps a reminder that couldn't be delivered so that the
+// requester can find out about it.
+func (p *ReminderPlugin) recordFailure(reminder *Reminder, reason string) {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.Failures == nil {
+		p.Failures = map[string][]*Failure{}
+	}
+	failures := append(p.Failures[reminder.Requester], &Failure{
+		ReminderID: reminder.ID,
+		Message:    reminder.Message,
+		Time:       reminder.Time,
+		Reason:     reason,
+	})
+	if len(failures) > maxFailures {
+		failures = failures[len(failures)-maxFailures:]
+	}
+	p.Failures[reminder.Requester] = failures
+}
+
+func (p *ReminderPlugin) failureCount(requester string) int {
+	p.RLock()
+	defer p.RUnlock()
+	return len(p.Failures[requester])
+}
+
+// takeFailures returns a line for each failed delivery and forgets them.
+func (p *ReminderPlugin) takeFailures(requester string) []string {
+	p.Lock()
+	defer p.Unlock()
+
+	lines := []string{}
+	for _, f := range p.Failures[requester] {
+		lines = append(lines, fmt.Sprintf("%s - %s: %s (%s)", f.ReminderID, humanize.Time(f.Time), f.Message, f.Reason))
+	}
+	delete(p.Failures, requester)
+	return lines
+}
+
+// handleDelivery handles `reminder dm on|off` and `reminder failures`.
+func (p *ReminderPlugin) handleDelivery(service bruxism.Service, message bruxism.Message, requester string, parts []string) {
+	if parts[0] == "failures" {
+		lines := p.takeFailures(requester)
+		if len(lines) == 0 {
+			service.SendMessage(message.Channel(), "All your reminders were delivered.")
+			return
+		}
+		p.sendQuiet(service, message.Channel(), fmt.Sprintf("These reminders couldn't be delivered:\n%s", strings.Join(lines, "\n")))
+		return
+	}
+
+	on := strings.EqualFold(parts[1], "on")
+	p.setDMs(message.UserID(), on)
+	if on {
+		service.SendMessage(message.Channel(), "Your reminders will be sent by DM, or here if your DMs are closed.")
+		return
+	}
+	service.SendMessage(message.Channel(), "Your reminders will be sent where you set them.")
+}
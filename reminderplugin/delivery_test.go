@@ -0,0 +1,120 @@
+package reminderplugin
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/iopred/bruxism"
+)
+
+// discordService is a discord service that only has a name.
+type discordService struct {
+	bruxism.Service
+}
+
+func (discordService) Name() string {
+	return bruxism.DiscordServiceName
+}
+
+// fakeSender records where messages are sent, channels in fail reject them.
+type fakeSender struct {
+	fail     map[string]error
+	dmFail   error
+	sent     []string
+	messages []*discordgo.MessageSend
+}
+
+func (f *fakeSender) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	if err := f.fail[channelID]; err != nil {
+		return nil, err
+	}
+	f.sent = append(f.sent, channelID)
+	f.messages = append(f.messages, data)
+	return &discordgo.Message{ChannelID: channelID}, nil
+}
+
+func (f *fakeSender) UserChannelCreate(recipientID string, options ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	if f.dmFail != nil {
+		return nil, f.dmFail
+	}
+	return &discordgo.Channel{ID: "dm-" + recipientID}, nil
+}
+
+func restError(status, code int) error {
+	return &discordgo.RESTError{
+		Response: &http.Response{StatusCode: status},
+		Message:  &discordgo.APIErrorMessage{Code: code},
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	cases := []struct {
+		name     string
+		reminder Reminder
+		dms      bool
+		fail     map[string]error
+		dmFail   error
+		sent     string
+		failure  string
+	}{
+		{"channel", Reminder{Requester: "<@1>", Target: "c"}, false, nil, nil, "c", ""},
+		{"dm reminder", Reminder{Requester: "<@1>", Target: "c", DM: true}, false, nil, nil, "dm-1", ""},
+		{"dm preference", Reminder{Requester: "<@1>", Target: "c"}, true, nil, nil, "dm-1", ""},
+		{"others are reminded in the channel", Reminder{Requester: "<@1>", Target: "c", DM: true, Mentions: []string{"2"}}, false, nil, nil, "c", ""},
+		{"dms closed", Reminder{Requester: "<@1>", Target: "c", DM: true}, false, map[string]error{"dm-1": restError(http.StatusForbidden, discordgo.ErrCodeCannotSendMessagesToThisUser)}, nil, "c", ""},
+		{"channel deleted", Reminder{Requester: "<@1>", Target: "c"}, false, map[string]error{"c": restError(http.StatusNotFound, discordgo.ErrCodeUnknownChannel)}, nil, "dm-1", ""},
+		{"nowhere", Reminder{Requester: "<@1>", Target: "c"}, false, map[string]error{"c": restError(http.StatusForbidden, discordgo.ErrCodeMissingAccess)}, errors.New("offline"), "", "channel: the bot can't post there, DM: offline"},
+		{"private reminders stay private", Reminder{Requester: "<@1>", Target: "c", IsPrivate: true}, false, map[string]error{"c": errors.New("gone")}, nil, "", "channel: gone"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, p, _ := newTestPlugin()
+			sender := &fakeSender{fail: c.fail, dmFail: c.dmFail}
+			p.sender = sender
+			if c.dms {
+				p.setDMs("1", true)
+			}
+
+			err := p.deliver(&c.reminder, &discordgo.MessageSend{Content: "hi"})
+			if c.failure != "" {
+				if err == nil || err.Error() != c.failure {
+					t.Fatalf("expected failure '%s' but got %v", c.failure, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(sender.sent) != 1 || sender.sent[0] != c.sent {
+				t.Errorf("expected the reminder to be sent to %s but got %v", c.sent, sender.sent)
+			}
+		})
+	}
+}
+
+func TestDeliveryFailures(t *testing.T) {
+	_, p, _ := newTestPlugin()
+	p.sender = &fakeSender{fail: map[string]error{"c": errors.New("gone")}, dmFail: errors.New("closed")}
+
+	for i := 0; i < maxFailures+2; i++ {
+		p.SendReminder(discordService{}, &Reminder{ID: "abcd", Requester: "<@1>", Target: "c", Message: "stretch"})
+	}
+	if n := p.failureCount("<@1>"); n != maxFailures {
+		t.Fatalf("expected %d failures to be kept but got %d", maxFailures, n)
+	}
+
+	lines := p.takeFailures("<@1>")
+	if len(lines) != maxFailures || !strings.Contains(lines[0], "stretch") || !strings.Contains(lines[0], "channel: gone") {
+		t.Errorf("unexpected failures %v", lines)
+	}
+	if n := p.failureCount("<@1>"); n != 0 {
+		t.Errorf("expected failures to be cleared once seen but %d are left", n)
+	}
+	if len(p.Delivered) != 0 {
+		t.Error("expected failed reminders not to get buttons")
+	}
+}
@@ -0,0 +1,262 @@
+package reminderplugin
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/dustin/go-humanize"
+	"github.com/iopred/bruxism"
+)
+
+// maxChoices is the most autocomplete choices discord accepts.
+const maxChoices = 25
+
+var errNoReminder = errors.New("You don't have a reminder with that ID.")
+
+// withID matches the reminder with the ID if it belongs to requester.
+func withID(requester, id string) func(*Reminder) bool {
+	return func(r *Reminder) bool {
+		return r.Requester == requester && strings.EqualFold(r.ID, id)
+	}
+}
+
+func reminderLine(r *Reminder) string {
+	line := fmt.Sprintf("%s - %s: %s", r.ID, humanize.Time(r.Time), r.Message)
+	if r.Recurrence != nil {
+		line += fmt.Sprintf(" (%s)", r.Recurrence)
+	}
+	return line
+}
+
+// listReminders returns a line for each of the requester's reminders.
+func (p *ReminderPlugin) listReminders(requester string) []string {
+	lines := []string{}
+	for _, r := range p.scheduler.reminders(requestedBy(requester)) {
+		lines = append(lines, reminderLine(r))
+	}
+	return lines
+}
+
+func (p *ReminderPlugin) deleteReminder(requester, id string) (Reminder, error) {
+	r, ok := p.scheduler.remove(withID(requester, id))
+	if !ok {
+		return Reminder{}, errNoReminder
+	}
+	return r, nil
+}
+
+// changeReminder changes the time, and for schedules the recurrence, and the
+// message of a reminder. Either can be left empty to keep it.
+func (p *ReminderPlugin) changeReminder(requester, id string, when []string, what string, now time.Time) (Reminder, error) {
+	var t time.Time
+	var recurrence *Recurrence
+	if len(when) > 0 {
+		var rest []string
+		var err error
+		t, recurrence, rest, err = parseSchedule(when, now)
+		if err == nil && len(rest) > 0 {
+			err = &ParseError{Input: strings.Join(rest, " "), Reason: "expected nothing after the time"}
+		}
+		if err != nil {
+			return Reminder{}, fmt.Errorf("Invalid time, %s.", err)
+		}
+		if err := validTime(t, now); err != nil {
+			return Reminder{}, fmt.Errorf("Invalid time, %s.", err)
+		}
+	}
+	if t.IsZero() && what == "" {
+		return Reminder{}, errors.New("Nothing to change, give a new time or message.")
+	}
+
+	r, ok := p.scheduler.update(withID(requester, id), func(r *Reminder) {
+		if !t.IsZero() {
+			r.Time = t
+			if recurrence != nil {
+				r.Recurrence = recurrence
+			}
+		}
+		if what != "" {
+			r.Message = what
+		}
+	})
+	if !ok {
+		return Reminder{}, errNoReminder
+	}
+	return r, nil
+}
+
+// snoozeReminder moves the next occurrence of a reminder to a later time.
+func (p *ReminderPlugin) snoozeReminder(requester, id string, when []string, now time.Time) (Reminder, error) {
+	t, rest, err := parseWhen(when, now)
+	if err == nil && len(rest) > 0 {
+		err = &ParseError{Input: strings.Join(rest, " "), Reason: "expected nothing after the time"}
+	}
+	if err == nil {
+		err = validTime(t, now)
+	}
+	if err != nil {
+		return Reminder{}, fmt.Errorf("Invalid time, %s.", err)
+	}
+
+	r, ok := p.scheduler.update(withID(requester, id), func(r *Reminder) {
+		r.Time = t
+	})
+	if !ok {
+		return Reminder{}, errNoReminder
+	}
+	return r, nil
+}
+
+// handleManage handles `reminder delete|edit|snooze <id> ...`.
+func (p *ReminderPlugin) handleManage(service bruxism.Service, message bruxism.Message, requester string, parts []string) {
+	if len(parts) < 2 {
+		service.SendMessage(message.Channel(), fmt.Sprintf("Which reminder? eg: reminder %s <id>, see the IDs with reminder list.", parts[0]))
+		return
+	}
+	id, args := parts[1], parts[2:]
+	loc := p.location(message.UserID())
+	now := p.clock.Now().In(loc)
+
+	var r Reminder
+	var err error
+	switch parts[0] {
+	case "delete":
+		r, err = p.deleteReminder(requester, id)
+		if err == nil {
+			service.SendMessage(message.Channel(), fmt.Sprintf("Reminder %s deleted.", r.ID))
+			return
+		}
+
+	case "snooze":
+		r, err = p.snoozeReminder(requester, id, args, now)
+
+	case "edit":
+		// a new time, optionally followed by a new message, or just a message
+		var when []string
+		what := strings.Join(args, " ")
+		if _, _, rest, perr := parseSchedule(args, now); perr == nil {
+			when, what = args[:len(args)-len(rest)], strings.Join(rest, " ")
+		}
+		r, err = p.changeReminder(requester, id, when, what, now)
+	}
+	if err != nil {
+		service.SendMessage(message.Channel(), err.Error())
+		return
+	}
+	p.sendQuiet(service, message.Channel(), fmt.Sprintf("Reminder %s is set for %s: %s", r.ID, formatTime(r.Time, loc), r.Message))
+}
+
+func createRemindersCMD() *discordgo.ApplicationCommand {
+	id := &discordgo.ApplicationCommandOption{Name: "id", Required: true, Autocomplete: true, Type: discordgo.ApplicationCommandOptionString, Description: "Which reminder?"}
+	return &discordgo.ApplicationCommand{
+		Name:        "reminders",
+		Description: "manage your reminders",
+		Options: []*discordgo.ApplicationCommandOption{
+			{Name: "list", Type: discordgo.ApplicationCommandOptionSubCommand, Description: "list your reminders"},
+			{Name: "delete", Type: discordgo.ApplicationCommandOptionSubCommand, Description: "delete a reminder", Options: []*discordgo.ApplicationCommandOption{id}},
+			{Name: "edit", Type: discordgo.ApplicationCommandOptionSubCommand, Description: "change the time or message of a reminder", Options: []*discordgo.ApplicationCommandOption{
+				id,
+				{Name: "when", Type: discordgo.ApplicationCommandOptionString, Description: "in 3h30m, at 5pm, every day at 9am, etc."},
+				{Name: "what", Type: discordgo.ApplicationCommandOptionString, Description: "The new reminder message"},
+			}},
+		},
+	}
+}
+
+func (p *ReminderPlugin) handleRemindersCMD(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	if len(data.Options) == 0 {
+		return
+	}
+	sub := data.Options[0]
+	requester := fmt.Sprintf("<@%s>", userID(i))
+
+	options := map[string]*discordgo.ApplicationCommandInteractionDataOption{}
+	for _, opt := range sub.Options {
+		options[opt.Name] = opt
+	}
+
+	if i.Type == discordgo.InteractionApplicationCommandAutocomplete {
+		if opt, ok := options["id"]; ok && opt.Focused {
+			p.autocompleteReminders(s, i, requester, opt.StringValue())
+		}
+		return
+	}
+
+	id := ""
+	if opt, ok := options["id"]; ok {
+		id = opt.StringValue()
+	}
+
+	switch sub.Name {
+	case "list":
+		text := "You have no reminders."
+		if lines := p.listReminders(requester); len(lines) > 0 {
+			text = fmt.Sprintf("Your reminders:\n%s", strings.Join(lines, "\n"))
+		}
+		if n := p.failureCount(requester); n > 0 {
+			text += fmt.Sprintf("\n%d of your reminders couldn't be delivered, see them with `reminder failures`.", n)
+		}
+		p.sendInteractionResponse(s, i, text)
+
+	case "delete":
+		r, err := p.deleteReminder(requester, id)
+		if err != nil {
+			p.sendInteractionResponse(s, i, err.Error())
+			return
+		}
+		p.sendInteractionResponse(s, i, fmt.Sprintf("Reminder %s deleted.", r.ID))
+
+	case "edit":
+		var when []string
+		what := ""
+		if opt, ok := options["when"]; ok {
+			when = strings.Fields(opt.StringValue())
+		}
+		if opt, ok := options["what"]; ok {
+			what = opt.StringValue()
+		}
+
+		loc := p.location(userID(i))
+		r, err := p.changeReminder(requester, id, when, what, p.clock.Now().In(loc))
+		if err != nil {
+			p.sendInteractionResponse(s, i, err.Error())
+			return
+		}
+		p.sendInteractionResponse(s, i, fmt.Sprintf("Reminder %s is set for %s: %s", r.ID, formatTime(r.Time, loc), r.Message))
+	}
+}
+
+// autocompleteReminders suggests the requester's reminders whose ID or
+// message contains what has been typed so far.
+func (p *ReminderPlugin) autocompleteReminders(s *discordgo.Session, i *discordgo.InteractionCreate, requester, typed string) {
+	typed = strings.ToLower(typed)
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, r := range p.scheduler.reminders(requestedBy(requester)) {
+		if !strings.Contains(r.ID, typed) && !strings.Contains(strings.ToLower(r.Message), typed) {
+			continue
+		}
+		name := []rune(reminderLine(r))
+		if len(name) > 100 {
+			name = append(name[:97], []rune("...")...)
+		}
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: string(name), Value: r.ID})
+		if len(choices) == maxChoices {
+			break
+		}
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+	if err != nil {
+		log.Print("unable to autocomplete reminders: ", err)
+	}
+}
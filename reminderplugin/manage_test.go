@@ -0,0 +1,149 @@
+package reminderplugin
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestPlugin returns a plugin that sends to the returned fake sender,
+// posts announcements and reschedules reminders as they fire, tests set the
+// policies they need.
+func newTestPlugin() (*fakeClock, *ReminderPlugin, *fakeSender) {
+	clock := &fakeClock{now: testNow}
+	sender := &fakeSender{}
+	p := &ReminderPlugin{
+		clock:     clock,
+		scheduler: newScheduler(clock),
+		announcer: newScheduler(clock),
+		paused:    map[string]*Reminder{},
+		sender:    sender,
+		Timezones: map[string]string{},
+		CatchUp:   defaultCatchUp,
+	}
+	p.scheduler.start(func(due []*Reminder) {
+		for _, r := range due {
+			p.reschedule(r)
+		}
+	})
+	p.announcer.start(func(due []*Reminder) {
+		p.fireAnnouncements(due)
+		for _, r := range due {
+			p.reschedule(r)
+		}
+	})
+	return clock, p, sender
+}
+
+func TestReminderIDsAreStable(t *testing.T) {
+	clock, p, _ := newTestPlugin()
+
+	first := &Reminder{Time: testNow.Add(time.Minute), Requester: "a", Message: "first"}
+	second := &Reminder{Time: testNow.Add(time.Hour), Requester: "a", Message: "second"}
+	p.AddReminder(first)
+	p.AddReminder(second)
+
+	if len(first.ID) != idLength || first.ID == second.ID {
+		t.Fatalf("expected two different short IDs but got %s and %s", first.ID, second.ID)
+	}
+
+	clock.advance(2 * time.Minute)
+	reminders := p.scheduler.reminders(requestedBy("a"))
+	if len(reminders) != 1 || reminders[0].ID != second.ID {
+		t.Fatalf("expected %s to keep its ID but got %v", second.ID, reminders)
+	}
+}
+
+func TestChangeReminder(t *testing.T) {
+	_, p, _ := newTestPlugin()
+	r := &Reminder{Time: testNow.Add(time.Minute), Requester: "a", Message: "walk the dog"}
+	p.AddReminder(r)
+
+	changed, err := p.changeReminder("a", strings.ToUpper(r.ID), strings.Fields("at 5pm"), "", testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed.Time.Equal(time.Date(2023, time.March, 15, 17, 0, 0, 0, time.UTC)) || changed.Message != "walk the dog" {
+		t.Errorf("unexpected reminder after changing the time: %+v", changed)
+	}
+
+	changed, err = p.changeReminder("a", r.ID, nil, "feed the cat", testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed.Message != "feed the cat" || !changed.Time.Equal(time.Date(2023, time.March, 15, 17, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected reminder after changing the message: %+v", changed)
+	}
+
+	changed, err = p.changeReminder("a", r.ID, strings.Fields("every day at 9am"), "", testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed.Recurrence == nil || changed.Recurrence.Unit != "day" {
+		t.Errorf("expected the reminder to repeat daily: %+v", changed)
+	}
+
+	if _, err := p.changeReminder("b", r.ID, nil, "mine now", testNow); err != errNoReminder {
+		t.Errorf("expected other users not to be able to edit the reminder, got %v", err)
+	}
+	if _, err := p.changeReminder("a", r.ID, strings.Fields("yesterday"), "", testNow); err == nil {
+		t.Error("expected an invalid time to be rejected")
+	}
+	if _, err := p.changeReminder("a", r.ID, nil, "", testNow); err == nil {
+		t.Error("expected an error when nothing changes")
+	}
+}
+
+func TestSnoozeAndDeleteReminder(t *testing.T) {
+	clock, p, _ := newTestPlugin()
+	r := &Reminder{Time: testNow.Add(time.Minute), Requester: "a", Message: "tea"}
+	p.AddReminder(r)
+
+	snoozed, err := p.snoozeReminder("a", r.ID, []string{"10m"}, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !snoozed.Time.Equal(testNow.Add(10 * time.Minute)) {
+		t.Errorf("expected the reminder to be snoozed 10 minutes but got %s", snoozed.Time)
+	}
+
+	clock.advance(5 * time.Minute)
+	if n := p.scheduler.count(requestedBy("a")); n != 1 {
+		t.Fatalf("expected the snoozed reminder not to fire yet")
+	}
+
+	if _, err := p.deleteReminder("b", r.ID); err != errNoReminder {
+		t.Errorf("expected other users not to be able to delete the reminder, got %v", err)
+	}
+	if _, err := p.deleteReminder("a", r.ID); err != nil {
+		t.Fatal(err)
+	}
+	if n := p.scheduler.count(requestedBy("a")); n != 0 {
+		t.Errorf("expected the reminder to be deleted")
+	}
+}
+
+func TestNewIDSkipsEveryStore(t *testing.T) {
+	_, p, _ := newTestPlugin()
+	p.Delivered = map[string]*Reminder{"aaaa": {ID: "aaaa"}}
+	p.paused["bbbb"] = &Reminder{ID: "bbbb"}
+	p.announcer.add(&Reminder{ID: "cccc", Time: testNow.Add(time.Hour), Announcement: &Announcement{GuildID: "g"}})
+	p.scheduler.add(&Reminder{ID: "dddd", Time: testNow.Add(time.Hour), Requester: "a"})
+
+	ids := []string{"aaaa", "bbbb", "cccc", "dddd", "eeee"}
+	old := randomID
+	randomID = func() string {
+		id := ids[0]
+		ids = ids[1:]
+		return id
+	}
+	defer func() { randomID = old }()
+
+	r := &Reminder{Time: testNow.Add(time.Minute), Requester: "a", Message: "new"}
+	if err := p.AddReminder(r); err != nil {
+		t.Fatal(err)
+	}
+	if r.ID != "eeee" {
+		t.Fatalf("expected an ID that isn't delivered, paused or scheduled but got %s", r.ID)
+	}
+}
@@ -0,0 +1,379 @@
+package reminderplugin
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A ParseError explains which part of a reminder time was not understood.
+type ParseError struct {
+	// Input is the word that could not be parsed, empty when the input ended
+	// early.
+	Input  string
+	Reason string
+}
+
+func (e *ParseError) Error() string {
+	if e.Input == "" {
+		return e.Reason
+	}
+	return fmt.Sprintf("didn't understand '%s', %s", e.Input, e.Reason)
+}
+
+var compactDurationRegexp = regexp.MustCompile(`^(\d+(mo|[ywdhms]))+$`)
+var compactDurationPartRegexp = regexp.MustCompile(`(\d+)(mo|[ywdhms])`)
+
+var compactUnits = map[string]string{
+	"s": "second", "m": "minute", "h": "hour", "d": "day", "w": "week", "mo": "month", "y": "year",
+}
+
+var durationUnits = map[string]string{
+	"s": "second", "sec": "second", "secs": "second", "second": "second", "seconds": "second",
+}
+
+var months = map[string]time.Month{}
+
+func init() {
+	for u, unit := range units {
+		durationUnits[u] = unit
+	}
+	for m := time.January; m <= time.December; m++ {
+		name := strings.ToLower(m.String())
+		months[name] = m
+		months[name[:3]] = m
+	}
+	months["sept"] = time.September
+}
+
+// whenParser holds the state of parsing the words of a reminder time.
+type whenParser struct {
+	words []string
+	pos   int
+	now   time.Time
+}
+
+func (w *whenParser) peek(i int) string {
+	if w.pos+i >= len(w.words) {
+		return ""
+	}
+	return strings.ToLower(strings.Trim(w.words[w.pos+i], ","))
+}
+
+// parseWhen parses a time at the start of words, it returns the time and
+// the words that follow it. eg:
+//
+//	10 minutes, in 3h30m, in an hour and 30 minutes
+//	at 5pm, tomorrow at 9am, today at noon
+//	friday, next monday at 10:30, on tuesday
+//	next week, next month
+//	2023-03-20, march 20 at 5pm, 20 march 2024
+//
+// Days given without a time keep the current time of day.
+func parseWhen(words []string, now time.Time) (time.Time, []string, error) {
+	w := &whenParser{words: words, now: now}
+	t, err := w.parse()
+	if err != nil {
+		return time.Time{}, nil, err
+	}
+	return t, words[w.pos:], nil
+}
+
+func (w *whenParser) parse() (time.Time, error) {
+	word := w.peek(0)
+	if word == "" {
+		return time.Time{}, &ParseError{Reason: "no time given, eg: " + strings.Join(randomTimes, ", ")}
+	}
+
+	switch {
+	case word == "in":
+		w.pos++
+		return w.duration()
+
+	case word == "at":
+		w.pos++
+		hour, min, err := w.clock()
+		if err != nil {
+			return time.Time{}, err
+		}
+		// at 5pm tomorrow, at 5pm on friday
+		if w.isDay() {
+			day, err := w.day()
+			if err != nil {
+				return time.Time{}, err
+			}
+			return setClock(day, hour, min), nil
+		}
+		return atClock(w.now, hour, min), nil
+
+	case word == "next":
+		switch next := w.peek(1); next {
+		case "week", "month", "year":
+			w.pos += 2
+			return addInterval(w.now, 1, next)
+		}
+		if _, ok := parseWeekday(w.peek(1)); ok {
+			w.pos++
+			return w.dayWithClock()
+		}
+		return time.Time{}, &ParseError{Input: w.peek(1), Reason: "expected week, month, year or a weekday after next"}
+
+	case w.isDay():
+		return w.dayWithClock()
+
+	case isClock(word):
+		hour, min, err := w.clock()
+		if err != nil {
+			return time.Time{}, err
+		}
+		return atClock(w.now, hour, min), nil
+	}
+
+	return w.duration()
+}
+
+// isDay reports if the next words name a day.
+func (w *whenParser) isDay() bool {
+	i := 0
+	if w.peek(0) == "on" {
+		i = 1
+	}
+	word := w.peek(i)
+	switch word {
+	case "today", "tomorrow", "tonight":
+		return true
+	}
+	if _, ok := parseWeekday(word); ok {
+		return true
+	}
+	if _, ok := months[word]; ok {
+		return true
+	}
+	if _, err := time.Parse(dateFormat, word); err == nil {
+		return true
+	}
+	// 20 march
+	if _, err := strconv.Atoi(strings.TrimRight(word, "stndrh")); err == nil {
+		_, ok := months[w.peek(i+1)]
+		return ok
+	}
+	return false
+}
+
+// dayWithClock parses a day optionally followed by a time.
+func (w *whenParser) dayWithClock() (time.Time, error) {
+	tonight := w.peek(0) == "tonight"
+	day, err := w.day()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if w.peek(0) == "at" || isClock(w.peek(0)) {
+		if w.peek(0) == "at" {
+			w.pos++
+		}
+		hour, min, err := w.clock()
+		if err != nil {
+			return time.Time{}, err
+		}
+		day = setClock(day, hour, min)
+	} else if tonight {
+		day = setClock(day, 20, 0)
+	}
+	return day, nil
+}
+
+// day parses a day, the time of day is kept from now.
+func (w *whenParser) day() (time.Time, error) {
+	if w.peek(0) == "on" {
+		w.pos++
+	}
+	word := w.peek(0)
+	w.pos++
+
+	switch word {
+	case "today", "tonight":
+		return w.now, nil
+	case "tomorrow":
+		return w.now.AddDate(0, 0, 1), nil
+	}
+
+	if weekday, ok := parseWeekday(word); ok {
+		days := (int(weekday) - int(w.now.Weekday()) + 7) % 7
+		if days == 0 {
+			days = 7
+		}
+		return w.now.AddDate(0, 0, days), nil
+	}
+
+	if d, err := time.ParseInLocation(dateFormat, word, w.now.Location()); err == nil {
+		return setClock(d, w.now.Hour(), w.now.Minute()), nil
+	}
+
+	// march 20 [2024] or 20 march [2024]
+	var month time.Month
+	var dayWord string
+	if m, ok := months[word]; ok {
+		month = m
+		dayWord = w.peek(0)
+	} else {
+		month = months[w.peek(0)]
+		dayWord = word
+	}
+	w.pos++
+
+	dayNum, err := strconv.Atoi(strings.TrimRight(dayWord, "stndrh"))
+	if err != nil {
+		return time.Time{}, &ParseError{Input: dayWord, Reason: "expected a day of the month"}
+	}
+
+	year := w.now.Year()
+	explicitYear := false
+	if y, err := strconv.Atoi(w.peek(0)); err == nil && y >= 1000 {
+		year = y
+		explicitYear = true
+		w.pos++
+	}
+
+	d := time.Date(year, month, dayNum, w.now.Hour(), w.now.Minute(), 0, 0, w.now.Location())
+	if d.Month() != month || dayNum < 1 {
+		return time.Time{}, &ParseError{Input: dayWord, Reason: fmt.Sprintf("%s doesn't have that many days", month)}
+	}
+	if !explicitYear && d.Before(setClock(w.now, 0, 0)) {
+		d = d.AddDate(1, 0, 0)
+	}
+	return d, nil
+}
+
+func isClock(word string) bool {
+	switch word {
+	case "noon", "midnight":
+		return true
+	}
+	if !strings.HasSuffix(word, "am") && !strings.HasSuffix(word, "pm") && !strings.Contains(word, ":") {
+		return false
+	}
+	_, _, err := parseClock(word)
+	return err == nil
+}
+
+// clock parses a time of day, "5 pm" is accepted as well as "5pm".
+func (w *whenParser) clock() (int, int, error) {
+	word := w.peek(0)
+	switch word {
+	case "noon":
+		w.pos++
+		return 12, 0, nil
+	case "midnight":
+		w.pos++
+		return 0, 0, nil
+	case "":
+		return 0, 0, &ParseError{Reason: "expected a time of day, eg: 5pm"}
+	}
+
+	if next := w.peek(1); next == "am" || next == "pm" {
+		word += next
+		w.pos++
+	}
+	w.pos++
+
+	hour, min, err := parseClock(word)
+	if err != nil {
+		return 0, 0, &ParseError{Input: word, Reason: "expected a time of day, eg: 5pm or 17:30"}
+	}
+	return hour, min, nil
+}
+
+// duration parses one or more amounts of time, eg: 3h30m, 2 hours, an hour
+// and 30 minutes.
+func (w *whenParser) duration() (time.Time, error) {
+	t := w.now
+	parsed := false
+	var err error
+	for {
+		word := w.peek(0)
+		if parsed && word == "and" {
+			if !w.isDurationAt(1) {
+				break
+			}
+			w.pos++
+			word = w.peek(0)
+		}
+
+		if compactDurationRegexp.MatchString(word) {
+			for _, m := range compactDurationPartRegexp.FindAllStringSubmatch(word, -1) {
+				n, _ := strconv.Atoi(m[1])
+				if t, err = addDuration(t, n, compactUnits[m[2]]); err != nil {
+					return time.Time{}, err
+				}
+			}
+			w.pos++
+			parsed = true
+			continue
+		}
+
+		n, err := strconv.Atoi(word)
+		if word == "a" || word == "an" {
+			n, err = 1, nil
+		}
+		unit, ok := durationUnits[w.peek(1)]
+		if err != nil || !ok {
+			if parsed {
+				break
+			}
+			if word == "" {
+				return time.Time{}, &ParseError{Reason: "expected an amount of time, eg: in 10 minutes"}
+			}
+			if err == nil {
+				return time.Time{}, &ParseError{Input: w.peek(1), Reason: "expected a unit like minutes, hours or days"}
+			}
+			return time.Time{}, &ParseError{Input: word, Reason: "expected a time like " + strings.Join(randomTimes, ", ")}
+		}
+		if n < 1 {
+			return time.Time{}, &ParseError{Input: word, Reason: "expected a positive amount"}
+		}
+		if t, err = addDuration(t, n, unit); err != nil {
+			return time.Time{}, err
+		}
+		w.pos += 2
+		parsed = true
+	}
+	return t, nil
+}
+
+func (w *whenParser) isDurationAt(i int) bool {
+	word := w.peek(i)
+	if compactDurationRegexp.MatchString(word) {
+		return true
+	}
+	_, err := strconv.Atoi(word)
+	_, ok := durationUnits[w.peek(i+1)]
+	return (err == nil || word == "a" || word == "an") && ok
+}
+
+func addDuration(t time.Time, n int, unit string) (time.Time, error) {
+	if unit == "second" {
+		return t.Add(time.Duration(n) * time.Second), nil
+	}
+	return addInterval(t, n, unit)
+}
+
+func setClock(t time.Time, hour, min int) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), hour, min, 0, 0, t.Location())
+}
+
+// parseSchedule parses the time of a reminder and, for recurring reminders,
+// its schedule. The words that follow are returned as the message.
+func parseSchedule(words []string, now time.Time) (time.Time, *Recurrence, []string, error) {
+	if len(words) > 0 {
+		switch strings.ToLower(words[0]) {
+		case "every", "cron":
+			return parseRecurrence(words, now)
+		}
+	}
+
+	t, rest, err := parseWhen(words, now)
+	return t, nil, rest, err
+}
@@ -0,0 +1,126 @@
+package reminderplugin
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseWhen(t *testing.T) {
+	cases := []struct {
+		input string
+		when  time.Time
+		rest  string
+	}{
+		{"10 minutes check the oven", testNow.Add(10 * time.Minute), "check the oven"},
+		{"1 min tea", testNow.Add(time.Minute), "tea"},
+		{"in 2 hours call mum", testNow.Add(2 * time.Hour), "call mum"},
+		{"in 3h30m leave", testNow.Add(3*time.Hour + 30*time.Minute), "leave"},
+		{"90s stir", testNow.Add(90 * time.Second), "stir"},
+		{"in an hour and 30 minutes go", testNow.Add(90 * time.Minute), "go"},
+		{"2 days and a bit", testNow.AddDate(0, 0, 2), "and a bit"},
+		{"at 5pm dinner", time.Date(2023, time.March, 15, 17, 0, 0, 0, time.UTC), "dinner"},
+		{"at 9am standup", time.Date(2023, time.March, 16, 9, 0, 0, 0, time.UTC), "standup"},
+		{"at 5 pm dinner", time.Date(2023, time.March, 15, 17, 0, 0, 0, time.UTC), "dinner"},
+		{"at 17:45 train", time.Date(2023, time.March, 15, 17, 45, 0, 0, time.UTC), "train"},
+		{"at noon lunch", time.Date(2023, time.March, 16, 12, 0, 0, 0, time.UTC), "lunch"},
+		{"at 9am tomorrow standup", time.Date(2023, time.March, 16, 9, 0, 0, 0, time.UTC), "standup"},
+		{"tomorrow bins", time.Date(2023, time.March, 16, 14, 30, 0, 0, time.UTC), "bins"},
+		{"tomorrow at 8:15am bins", time.Date(2023, time.March, 16, 8, 15, 0, 0, time.UTC), "bins"},
+		{"tonight movie", time.Date(2023, time.March, 15, 20, 0, 0, 0, time.UTC), "movie"},
+		{"today at 6pm gym", time.Date(2023, time.March, 15, 18, 0, 0, 0, time.UTC), "gym"},
+		{"friday at 9am demo", time.Date(2023, time.March, 17, 9, 0, 0, 0, time.UTC), "demo"},
+		{"on monday laundry", time.Date(2023, time.March, 20, 14, 30, 0, 0, time.UTC), "laundry"},
+		{"wednesday review", time.Date(2023, time.March, 22, 14, 30, 0, 0, time.UTC), "review"},
+		{"next tue 10:30 dentist", time.Date(2023, time.March, 21, 10, 30, 0, 0, time.UTC), "dentist"},
+		{"next week plan", testNow.AddDate(0, 0, 7), "plan"},
+		{"next month rent", testNow.AddDate(0, 1, 0), "rent"},
+		{"2023-04-01 pranks", time.Date(2023, time.April, 1, 14, 30, 0, 0, time.UTC), "pranks"},
+		{"2023-04-01 at 9am pranks", time.Date(2023, time.April, 1, 9, 0, 0, 0, time.UTC), "pranks"},
+		{"march 20 at 5pm party", time.Date(2023, time.March, 20, 17, 0, 0, 0, time.UTC), "party"},
+		{"20th march party", time.Date(2023, time.March, 20, 14, 30, 0, 0, time.UTC), "party"},
+		{"jan 2 taxes", time.Date(2024, time.January, 2, 14, 30, 0, 0, time.UTC), "taxes"},
+		{"on 1 june 2024 at noon trip", time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC), "trip"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			when, rest, err := parseWhen(strings.Fields(c.input), testNow)
+			if err != nil {
+				t.Fatalf("unable to parse '%s': %+v", c.input, err)
+			}
+			if !when.Equal(c.when) {
+				t.Errorf("expected %s but got %s", c.when, when)
+			}
+			if r := strings.Join(rest, " "); r != c.rest {
+				t.Errorf("expected rest '%s' but got '%s'", c.rest, r)
+			}
+		})
+	}
+}
+
+func TestParseWhenErrors(t *testing.T) {
+	cases := []struct {
+		input string
+		word  string
+	}{
+		{"", ""},
+		{"soon", "soon"},
+		{"in", ""},
+		{"10 potatoes", "potatoes"},
+		{"0 minutes", "0"},
+		{"at 25pm", "25pm"},
+		{"at", ""},
+		{"next soon", "soon"},
+		{"february 30 skip", "30"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			_, _, err := parseWhen(strings.Fields(c.input), testNow)
+			if err == nil {
+				t.Fatalf("expected an error parsing '%s'", c.input)
+			}
+			perr, ok := err.(*ParseError)
+			if !ok {
+				t.Fatalf("expected a *ParseError but got %T", err)
+			}
+			if perr.Input != c.word {
+				t.Errorf("expected error on '%s' but got '%s': %s", c.word, perr.Input, perr)
+			}
+		})
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	when, rec, rest, err := parseSchedule(strings.Fields("every day at 9am stretch"), testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec == nil || rec.Unit != "day" {
+		t.Fatalf("expected a daily recurrence but got %+v", rec)
+	}
+	if !when.Equal(time.Date(2023, time.March, 16, 9, 0, 0, 0, time.UTC)) || strings.Join(rest, " ") != "stretch" {
+		t.Errorf("unexpected schedule %s, %v", when, rest)
+	}
+
+	when, rec, rest, err = parseSchedule(strings.Fields("in 5 minutes stretch"), testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec != nil || !when.Equal(testNow.Add(5*time.Minute)) || strings.Join(rest, " ") != "stretch" {
+		t.Errorf("unexpected schedule %s, %+v, %v", when, rec, rest)
+	}
+}
+
+func TestValidTime(t *testing.T) {
+	if err := validTime(testNow.Add(-time.Minute), testNow); err == nil {
+		t.Error("expected times in the past to be invalid")
+	}
+	if err := validTime(testNow.AddDate(2, 0, 0), testNow); err == nil {
+		t.Error("expected times years away to be invalid")
+	}
+	if err := validTime(testNow.Add(time.Hour), testNow); err != nil {
+		t.Error(err)
+	}
+}
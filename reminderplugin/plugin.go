@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -14,37 +13,101 @@ import (
 	"github.com/bwmarrin/discordgo"
 	"github.com/dustin/go-humanize"
 	"github.com/iopred/bruxism"
-	"github.com/tj/go-naturaldate"
 )
 
 // A Reminder holds data about a specific reminder.
 type Reminder struct {
+	// ID is a short name for the reminder that doesn't change until it is
+	// deleted.
+	ID        string
 	StartTime time.Time
 	Time      time.Time
 	Requester string
 	Target    string
 	Message   string
 	IsPrivate bool
+	// Recurrence is set for reminders that repeat.
+	Recurrence *Recurrence
+	// Mentions and Roles are the ids of other users and roles that are
+	// reminded along with the requester.
+	Mentions []string
+	Roles    []string
+	// DM asks for the reminder to be sent to the requester by DM.
+	DM bool
+	// Announcement is set for posts scheduled by server admins.
+	Announcement *Announcement
+
+	// index is the position of the reminder in the scheduler queue.
+	index int
+}
+
+// copy returns a copy of the reminder that doesn't share its recurrence.
+func (r *Reminder) copy() Reminder {
+	c := *r
+	if r.Recurrence != nil {
+		rec := *r.Recurrence
+		c.Recurrence = &rec
+	}
+	if r.Announcement != nil {
+		a := *r.Announcement
+		c.Announcement = &a
+	}
+	return c
 }
 
 // ReminderPlugin is a plugin that reminds users.
 type ReminderPlugin struct {
 	sync.RWMutex
-	bot            *bruxism.Bot
-	discord        *bruxism.Discord
+	bot       *bruxism.Bot
+	discord   *bruxism.Discord
+	clock     Clock
+	scheduler *scheduler
+	// Reminders is only used to save and load the reminders, the scheduler
+	// holds them while the bot runs.
 	Reminders      []*Reminder
 	TotalReminders int
+	// Timezones holds the zone names users have set, by user id.
+	Timezones map[string]string
+	// Delivered holds sent reminders whose buttons still work, by reminder id.
+	Delivered map[string]*Reminder
+	// Consents holds who users let set reminders for them, by user id.
+	Consents map[string]*Consent
+	// DMs holds the users who want their reminders by DM, by user id.
+	DMs map[string]bool
+	// Failures holds reminders that couldn't be delivered, by requester.
+	Failures map[string][]*Failure
+	// CatchUp is what happens to reminders that were due while the bot was
+	// down.
+	CatchUp CatchUp
+	// Announcements is only used to save and load announcements, the
+	// announcer holds them while the bot runs and paused holds the paused
+	// ones by id.
+	Announcements []*Reminder
+	announcer     *scheduler
+	paused        map[string]*Reminder
+	// sender replaces the discord session in tests.
+	sender messageSender
 }
 
 var randomTimes = []string{
 	"1 minute",
 	"10 minutes",
-	"1 hour",
+	"in 3h30m",
 	"4 hours",
+	"at 5pm",
 	"tomorrow",
+	"friday at 9am",
 	"next week",
 }
 
+var randomSchedules = []string{
+	"every day at 9am",
+	"every monday",
+	"every 2 weeks",
+	"every month for 6 times",
+	"cron 0 9 * * 1-5",
+}
+
 var randomMessages = []string{
 	"walk the dog",
 	"take pizza out of the oven",
@@ -66,70 +129,67 @@ func (p *ReminderPlugin) randomReminder(service bruxism.Service) string {
 	return fmt.Sprintf("%s%sreminder %s %s%s", ticks, service.CommandPrefix(), p.random(randomTimes), p.random(randomMessages), ticks)
 }
 
+func (p *ReminderPlugin) randomRecurringReminder(service bruxism.Service) string {
+	ticks := ""
+	if service.Name() == bruxism.DiscordServiceName {
+		ticks = "`"
+	}
+
+	return fmt.Sprintf("%s%sreminder %s %s%s", ticks, service.CommandPrefix(), p.random(randomSchedules), p.random(randomMessages), ticks)
+}
+
 // Help returns a list of help strings that are printed when the user requests them.
 func (p *ReminderPlugin) Help(bot *bruxism.Bot, service bruxism.Service, message bruxism.Message, detailed bool) []string {
 	help := []string{
 		bruxism.CommandHelp(service, "reminder", "<time> <reminder>", "Sets a reminder that is sent after the provided time.")[0],
-		bruxism.CommandHelp(service, "reminderlist", "", "List all active reminders.")[0],
-		bruxism.CommandHelp(service, "reminderdelete", "<index>", "Deletes a reminder by index. eg: reminderdelete 0")[0],
+		bruxism.CommandHelp(service, "reminder", "<every ...|cron ...> [until YYYY-MM-DD|for <n> times] <reminder>", "Sets a recurring reminder.")[0],
+		bruxism.CommandHelp(service, "reminder", "list", "List all active reminders and their IDs.")[0],
+		bruxism.CommandHelp(service, "reminder", "delete <id>", "Deletes a reminder. eg: reminder delete k3p9")[0],
+		bruxism.CommandHelp(service, "reminder", "edit <id> <time|message>", "Changes the time or message of a reminder. eg: reminder edit k3p9 at 6pm")[0],
+		bruxism.CommandHelp(service, "reminder", "snooze <id> <time>", "Moves a reminder later. eg: reminder snooze k3p9 10m")[0],
+		bruxism.CommandHelp(service, "reminder", "<@user|@role> <time> <reminder>", "Sets a reminder for someone else, they need to allow you first. Roles need a server admin.")[0],
+		bruxism.CommandHelp(service, "reminder", "allow|block <@user|everyone>", "Chooses who can set reminders for you.")[0],
+		bruxism.CommandHelp(service, "reminder", "dm <time> <reminder>", "Sets a reminder that is sent to you by DM.")[0],
+		bruxism.CommandHelp(service, "reminder", "dm on|off", "Chooses if all your reminders are sent by DM.")[0],
+		bruxism.CommandHelp(service, "reminder", "failures", "Shows reminders that couldn't be delivered.")[0],
+		bruxism.CommandHelp(service, "reminder", "catchup [<max late>|forever] [batch on|off]", "Shows or sets how reminders missed while the bot was down are sent.")[0],
+		bruxism.CommandHelp(service, "reminder", "tz [zone]", "Shows or sets your timezone. eg: reminder tz America/Toronto")[0],
+		bruxism.CommandHelp(service, "announce", "<#channel> <time|every ...> <message> [| title | description | #color | image link]", "Schedules a post in a channel, server admins only. Use - for no message.")[0],
+		bruxism.CommandHelp(service, "announce", "list|preview <id>|pause <id>|resume <id> [time]|delete <id>", "Manages this server's announcements.")[0],
 	}
 	if detailed {
 		help = append(help, []string{
 			"Examples: ",
 			p.randomReminder(service),
 			p.randomReminder(service),
+			p.randomRecurringReminder(service),
 		}...)
 	}
 	return help
 }
 
-func (p *ReminderPlugin) parseReminder(parts []string) (time.Time, string, error) {
-	if parts[0] == "me" {
-		parts = parts[1:]
+// validTime checks that a reminder is in the future, but not too far.
+func validTime(t, now time.Time) error {
+	if t.Before(now) {
+		return errors.New("that's in the past")
 	}
-	if len(parts) < 2 {
-		return time.Time{}, "", fmt.Errorf("too few parts to parse: %+v", parts)
-	}
-	if parts[0] == "tomorrow" {
-		return time.Now().Add(1 * time.Hour * 24), strings.Join(parts[1:], " "), nil
-	}
-
-	if parts[0] == "next" {
-		switch parts[1] {
-		case "week":
-			return time.Now().Add(1 * time.Hour * 24 * 7), strings.Join(parts[2:], " "), nil
-		case "month":
-			return time.Now().Add(1 * time.Hour * 24 * 7 * 4), strings.Join(parts[2:], " "), nil
-		case "year":
-			return time.Now().Add(1 * time.Hour * 24 * 365), strings.Join(parts[2:], " "), nil
-		default:
-			return time.Time{}, "", errors.New("Invalid next.")
-		}
+	if t.After(now.Add(time.Hour*24*365 + time.Hour)) {
+		return errors.New("that's more than a year away")
 	}
+	return nil
+}
 
-	i, err := strconv.Atoi(parts[0])
-	if err != nil {
-		return time.Time{}, "", err
-	}
-
-	switch {
-	case strings.HasPrefix(parts[1], "sec"):
-		return time.Now().Add(time.Duration(i) * time.Second), strings.Join(parts[2:], " "), nil
-	case strings.HasPrefix(parts[1], "min"):
-		return time.Now().Add(time.Duration(i) * time.Minute), strings.Join(parts[2:], " "), nil
-	case strings.HasPrefix(parts[1], "hour"):
-		return time.Now().Add(time.Duration(i) * time.Hour), strings.Join(parts[2:], " "), nil
-	case strings.HasPrefix(parts[1], "day"):
-		return time.Now().Add(time.Duration(i) * time.Hour * 24), strings.Join(parts[2:], " "), nil
-	case strings.HasPrefix(parts[1], "week"):
-		return time.Now().Add(time.Duration(i) * time.Hour * 24 * 7), strings.Join(parts[2:], " "), nil
-	case strings.HasPrefix(parts[1], "month"):
-		return time.Now().Add(time.Duration(i) * time.Hour * 24 * 31), strings.Join(parts[2:], " "), nil
-	case strings.HasPrefix(parts[1], "year"):
-		return time.Now().Add(time.Duration(i) * time.Hour * 24 * 365), strings.Join(parts[2:], " "), nil
-	}
-
-	return time.Time{}, "", errors.New("Invalid string.")
+// newID returns a short ID that no reminder, announcement, paused
+// announcement or delivered reminder has, they are all looked up by it. The
+// caller must hold the lock.
+func (p *ReminderPlugin) newID() string {
+	for {
+		id := randomID()
+		withID := func(r *Reminder) bool { return r.ID == id }
+		if p.scheduler.count(withID) == 0 && p.announcer.count(withID) == 0 && p.paused[id] == nil && p.Delivered[id] == nil {
+			return id
+		}
+	}
 }
 
 // AddReminder adds a reminder.
@@ -137,32 +197,25 @@ func (p *ReminderPlugin) AddReminder(reminder *Reminder) error {
 	p.Lock()
 	defer p.Unlock()
 
-	i := 0
-	for _, r := range p.Reminders {
-		if r.Requester == reminder.Requester {
-			i++
-			if i > 20 {
-				return errors.New("You have too many reminders already.")
-			}
-		}
+	if p.scheduler.count(requestedBy(reminder.Requester)) > 20 {
+		return errors.New("You have too many reminders already.")
 	}
 
-	i = 0
-	for _, r := range p.Reminders {
-		if r.Time.After(reminder.Time) {
-			break
-		}
-		i++
+	if reminder.ID == "" {
+		reminder.ID = p.newID()
 	}
-
-	p.Reminders = append(p.Reminders, reminder)
-	copy(p.Reminders[i+1:], p.Reminders[i:])
-	p.Reminders[i] = reminder
+	p.scheduler.add(reminder)
 	p.TotalReminders++
 
 	return nil
 }
 
+func requestedBy(requester string) func(*Reminder) bool {
+	return func(r *Reminder) bool {
+		return r.Requester == requester
+	}
+}
+
 func (p *ReminderPlugin) Message(bot *bruxism.Bot, service bruxism.Service, message bruxism.Message) {
 	defer bruxism.MessageRecover()
 
@@ -176,51 +229,18 @@ func (p *ReminderPlugin) Message(bot *bruxism.Bot, service bruxism.Service, mess
 	}
 
 	if bruxism.MatchesCommand(service, "remindlist", message) || bruxism.MatchesCommand(service, "reminderlist", message) {
-		reminders := []string{}
-		i := 0
-		for _, r := range p.Reminders {
-			if r.Requester == requester {
-				reminders = append(reminders, fmt.Sprintf("%d - %s: %s", i, humanize.Time(r.Time), r.Message))
-				i++
-			}
-		}
-		if len(reminders) > 0 {
-			if service.SupportsMultiline() {
-				service.SendMessage(message.Channel(), fmt.Sprintf("Your reminders:\n%s", strings.Join(reminders, "\n")))
-			} else {
-				service.SendMessage(message.Channel(), fmt.Sprintf("Your reminders: %s", strings.Join(reminders, ". ")))
-			}
-		} else {
-			service.SendMessage(message.Channel(), "You have no reminders.")
-		}
+		p.sendReminderList(service, message, requester)
 		return
 	}
 
 	if bruxism.MatchesCommand(service, "reminddelete", message) || bruxism.MatchesCommand(service, "reminderdelete", message) {
-		index := 0
-		indexString, parts := bruxism.ParseCommand(service, message)
-		var err error
-		if len(parts) > 0 {
-			index, err = strconv.Atoi(indexString)
-			if err != nil {
-				service.SendMessage(message.Channel(), "Invalid reminder.")
-				return
-			}
-		}
+		_, parts := bruxism.ParseCommand(service, message)
+		p.handleManage(service, message, requester, append([]string{"delete"}, parts...))
+		return
+	}
 
-		j := 0
-		for i, r := range p.Reminders {
-			if r.Requester == requester {
-				if j == index {
-					p.Lock()
-					p.Reminders = append(p.Reminders[:i], p.Reminders[i+1:]...)
-					p.Unlock()
-					service.SendMessage(message.Channel(), "Reminder deleted.")
-					return
-				}
-				j++
-			}
-		}
+	if bruxism.MatchesCommand(service, "announce", message) {
+		p.handleAnnounce(service, message, requester)
 		return
 	}
 
@@ -228,100 +248,221 @@ func (p *ReminderPlugin) Message(bot *bruxism.Bot, service bruxism.Service, mess
 		return
 	}
 
-	_, parts := bruxism.ParseCommand(service, message)
+	parts := rawParts(service, message, "remind", "reminder")
+
+	if len(parts) > 0 && (parts[0] == "tz" || parts[0] == "timezone") {
+		if len(parts) < 2 {
+			service.SendMessage(message.Channel(), fmt.Sprintf("Your timezone is %s. eg: %s", p.location(message.UserID()), "reminder tz America/Toronto"))
+			return
+		}
+		zone := parts[1]
+		if strings.EqualFold(zone, "reset") {
+			zone = ""
+		}
+		loc, err := p.setTimezone(message.UserID(), zone)
+		if err != nil {
+			service.SendMessage(message.Channel(), err.Error())
+			return
+		}
+		service.SendMessage(message.Channel(), fmt.Sprintf("Your timezone is now %s, it's %s there.", loc, p.clock.Now().In(loc).Format("3:04pm Mon Jan 2")))
+		return
+	}
+
+	if len(parts) > 0 {
+		switch parts[0] {
+		case "list":
+			p.sendReminderList(service, message, requester)
+			return
+		case "delete", "edit", "snooze":
+			p.handleManage(service, message, requester, parts)
+			return
+		case "allow", "block", "consent":
+			p.handleConsent(service, message, parts)
+			return
+		case "failures":
+			p.handleDelivery(service, message, requester, parts)
+			return
+		case "catchup":
+			p.handleCatchUp(service, message, parts)
+			return
+		case "dm":
+			if len(parts) == 2 && (strings.EqualFold(parts[1], "on") || strings.EqualFold(parts[1], "off")) {
+				p.handleDelivery(service, message, requester, parts)
+				return
+			}
+		}
+	}
+
+	dm := false
+	if len(parts) > 0 && parts[0] == "dm" {
+		dm = true
+		parts = parts[1:]
+	}
 
 	if len(parts) < 2 {
 		service.SendMessage(message.Channel(), fmt.Sprintf("Invalid reminder, no time or message. eg: %s", p.randomReminder(service)))
 		return
 	}
 
-	t, r, err := p.parseReminder(parts)
+	loc := p.location(message.UserID())
+	now := p.clock.Now().In(loc)
 
-	now := time.Now()
+	if parts[0] == "me" {
+		parts = parts[1:]
+	}
 
-	if err != nil || t.Before(now) || t.After(now.Add(time.Hour*24*365+time.Hour)) {
-		service.SendMessage(message.Channel(), fmt.Sprintf("Invalid time. eg: %s", strings.Join(randomTimes, ", ")))
+	users, roles, parts := parseTargets(parts)
+	users = without(users, message.UserID())
+	if reason := p.checkTargets(service, message, users, roles); reason != "" {
+		p.sendQuiet(service, message.Channel(), reason)
 		return
 	}
 
-	if r == "" {
-		service.SendMessage(message.Channel(), fmt.Sprintf("Invalid reminder, no message. eg: %s", p.randomReminder(service)))
+	t, recurrence, rest, err := parseSchedule(parts, now)
+	if err != nil {
+		service.SendMessage(message.Channel(), fmt.Sprintf("Invalid time, %s.", err))
 		return
 	}
+	if err := validTime(t, now); err != nil {
+		service.SendMessage(message.Channel(), fmt.Sprintf("Invalid time, %s. eg: %s", err, strings.Join(randomTimes, ", ")))
+		return
+	}
+	r := strings.Join(rest, " ")
 
-	if service.Name() == bruxism.DiscordServiceName {
-		if strings.Index(r, "<@") != -1 || strings.Index(strings.ToLower(r), "@everyone") != -1 || strings.Index(strings.ToLower(r), "@here") != -1 {
-			service.SendMessage(message.Channel(), "Invalid reminder, no mentions, sorry.")
-			return
-		}
+	if r == "" {
+		service.SendMessage(message.Channel(), fmt.Sprintf("Invalid reminder, no message. eg: %s", p.randomReminder(service)))
+		return
 	}
 
 	t = t.Add(500 * time.Millisecond)
 
-	err = p.AddReminder(&Reminder{
-		StartTime: now,
-		Time:      t,
-		Requester: requester,
-		Target:    message.Channel(),
-		Message:   r,
-		IsPrivate: service.IsPrivate(message),
-	})
+	reminder := &Reminder{
+		StartTime:  now,
+		Time:       t,
+		Requester:  requester,
+		Target:     message.Channel(),
+		Message:    r,
+		IsPrivate:  service.IsPrivate(message),
+		Recurrence: recurrence,
+		Mentions:   users,
+		Roles:      roles,
+		DM:         dm,
+	}
+	err = p.AddReminder(reminder)
 	if err != nil {
 		service.SendMessage(message.Channel(), err.Error())
 		return
 	}
 
-	service.SendMessage(message.Channel(), fmt.Sprintf("Reminder set for %s.", humanize.Time(t)))
+	if recurrence != nil {
+		service.SendMessage(message.Channel(), fmt.Sprintf("Reminder %s set for %s, repeating %s.", reminder.ID, formatTime(t, loc), recurrence))
+		return
+	}
+	service.SendMessage(message.Channel(), fmt.Sprintf("Reminder %s set for %s.", reminder.ID, formatTime(t, loc)))
+}
+
+func (p *ReminderPlugin) sendReminderList(service bruxism.Service, message bruxism.Message, requester string) {
+	reminders := p.listReminders(requester)
+	if len(reminders) > 0 {
+		if service.SupportsMultiline() {
+			p.sendQuiet(service, message.Channel(), fmt.Sprintf("Your reminders:\n%s", strings.Join(reminders, "\n")))
+		} else {
+			p.sendQuiet(service, message.Channel(), fmt.Sprintf("Your reminders: %s", strings.Join(reminders, ". ")))
+		}
+	} else {
+		service.SendMessage(message.Channel(), "You have no reminders.")
+	}
+	if n := p.failureCount(requester); n > 0 {
+		service.SendMessage(message.Channel(), fmt.Sprintf("%d of your reminders couldn't be delivered, see them with `reminder failures`.", n))
+	}
 }
 
 // SendReminder sends a reminder.
 func (p *ReminderPlugin) SendReminder(service bruxism.Service, reminder *Reminder) {
-	if strings.Index(reminder.Message, "<@") != -1 || strings.Index(strings.ToLower(reminder.Message), "@everyone") != -1 || strings.Index(strings.ToLower(reminder.Message), "@here") != -1 {
+	var text string
+	if reminder.IsPrivate {
+		text = fmt.Sprintf("%s you set a reminder: %s", humanize.Time(reminder.StartTime), reminder.Message)
+	} else {
+		text = fmt.Sprintf("%s %s set a reminder: %s", humanize.Time(reminder.StartTime), reminder.Requester, reminder.Message)
+	}
+	if len(reminder.Mentions) > 0 || len(reminder.Roles) > 0 {
+		targets := []string{}
+		for _, u := range reminder.Mentions {
+			targets = append(targets, fmt.Sprintf("<@%s>", u))
+		}
+		for _, r := range reminder.Roles {
+			targets = append(targets, fmt.Sprintf("<@&%s>", r))
+		}
+		text = strings.Join(targets, " ") + " " + text
+	}
+	if now := p.clock.Now(); now.Sub(reminder.Time) > lateAfter {
+		text += fmt.Sprintf("\n_This was due %s._", humanize.RelTime(reminder.Time, now, "ago", "from now"))
+	}
+
+	err := p.post(service, reminder, &discordgo.MessageSend{
+		Content:         text,
+		Components:      reminderButtons(reminder.ID),
+		AllowedMentions: p.allowedMentions(reminder),
+	})
+	if err != nil {
+		p.recordFailure(reminder, err.Error())
 		return
 	}
+	if service.Name() == bruxism.DiscordServiceName {
+		p.delivered(reminder)
+	}
+}
 
-	if reminder.IsPrivate {
-		service.SendMessage(reminder.Target, fmt.Sprintf("%s you set a reminder: %s", humanize.Time(reminder.StartTime), reminder.Message))
-	} else {
-		service.SendMessage(reminder.Target, fmt.Sprintf("%s %s set a reminder: %s", humanize.Time(reminder.StartTime), reminder.Requester, reminder.Message))
+// post sends a message where a reminder is delivered.
+func (p *ReminderPlugin) post(service bruxism.Service, reminder *Reminder, send *discordgo.MessageSend) error {
+	if service.Name() != bruxism.DiscordServiceName || (p.discord == nil && p.sender == nil) {
+		err := service.SendMessage(reminder.Target, send.Content)
+		if err != nil {
+			log.Println("Error sending reminder", err)
+		}
+		return err
 	}
+	return p.deliver(reminder, send)
 }
 
-// Run will block until a reminder needs to be fired and then fire it.
+// Run starts firing reminders as they become due.
 func (p *ReminderPlugin) Run(bot *bruxism.Bot, service bruxism.Service) {
-	for {
-		p.RLock()
-
-		if len(p.Reminders) > 0 {
-			reminder := p.Reminders[0]
-			if time.Now().After(reminder.Time) {
-				p.RUnlock()
-				if time.Now().Before(reminder.Time.Add(48 * time.Hour)) {
-					p.SendReminder(service, reminder)
-				}
-				p.Lock()
-				p.Reminders = p.Reminders[1:]
-				p.Unlock()
-
-				continue
-			}
+	p.scheduler.start(func(due []*Reminder) {
+		p.fire(service, due)
+		for _, r := range due {
+			p.reschedule(r)
+		}
+	})
+	p.announcer.start(func(due []*Reminder) {
+		p.fireAnnouncements(due)
+		for _, r := range due {
+			p.reschedule(r)
 		}
+	})
+}
 
-		p.RUnlock()
-		time.Sleep(500 * time.Millisecond)
+// reschedule puts a recurring reminder back with its next occurrence, unless
+// it was deleted while it fired.
+func (p *ReminderPlugin) reschedule(reminder *Reminder) {
+	if reminder.Recurrence == nil {
+		return
+	}
+	reminder.Recurrence.Fired++
+	next, ok := reminder.Recurrence.Next(reminder.Time, p.clock.Now())
+	if !ok {
+		return
 	}
+	reminder.Time = next
+	if reminder.Announcement != nil {
+		p.announcer.requeue(reminder)
+		return
+	}
+	p.scheduler.requeue(reminder)
 }
 
 // Load will load plugin state from a byte array.
 func (p *ReminderPlugin) Load(bot *bruxism.Bot, service bruxism.Service, data []byte) error {
-	if data != nil {
-		if err := json.Unmarshal(data, p); err != nil {
-			log.Println("Error loading data", err)
-		}
-	}
-	if len(p.Reminders) > p.TotalReminders {
-		p.TotalReminders = len(p.Reminders)
-	}
+	p.load(data)
 
 	for _, s := range p.discord.Sessions {
 		for _, guild := range s.State.Guilds {
@@ -331,31 +472,89 @@ func (p *ReminderPlugin) Load(bot *bruxism.Bot, service bruxism.Service, data []
 				continue
 			}
 			log.Print("created remindme command:", cmd.ApplicationID, "for guild:", guild.Name)
-		}
-		p.discord.Session.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-			if i.ApplicationCommandData().Name == "remindme" {
-				p.handleCreateReminderCMD(s, i)
+
+			cmd, err = p.discord.Session.ApplicationCommandCreate(p.discord.Session.State.User.ID, guild.ID, createRemindersCMD())
+			if err != nil {
+				log.Print("unable to create command:", err)
+				continue
 			}
-		})
+			log.Print("created reminders command:", cmd.ApplicationID, "for guild:", guild.Name)
+		}
+		p.discord.Session.AddHandler(p.handleInteraction)
 	}
-	go p.Run(bot, service)
+	p.Run(bot, service)
 	return nil
 }
 
+// load restores saved reminders into the scheduler.
+func (p *ReminderPlugin) load(data []byte) {
+	if data != nil {
+		if err := json.Unmarshal(data, p); err != nil {
+			log.Println("Error loading data", err)
+		}
+	}
+	if len(p.Reminders) > p.TotalReminders {
+		p.TotalReminders = len(p.Reminders)
+	}
+	for _, r := range p.Reminders {
+		p.scheduler.add(r)
+	}
+	p.Reminders = nil
+
+	if p.paused == nil {
+		p.paused = map[string]*Reminder{}
+	}
+	for _, r := range p.Announcements {
+		if r.Announcement == nil {
+			continue
+		}
+		if r.Announcement.Paused {
+			p.paused[r.ID] = r
+		} else {
+			p.announcer.add(r)
+		}
+	}
+	p.Announcements = nil
+}
+
+func (p *ReminderPlugin) handleInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type == discordgo.InteractionMessageComponent {
+		if strings.HasPrefix(i.MessageComponentData().CustomID, buttonPrefix) {
+			p.handleReminderButton(s, i)
+		}
+		return
+	}
+	if i.Type != discordgo.InteractionApplicationCommand && i.Type != discordgo.InteractionApplicationCommandAutocomplete {
+		return
+	}
+	switch i.ApplicationCommandData().Name {
+	case "remindme":
+		if i.Type == discordgo.InteractionApplicationCommand {
+			p.handleCreateReminderCMD(s, i)
+		}
+	case "reminders":
+		p.handleRemindersCMD(s, i)
+	}
+}
+
 func createReminderCMD() *discordgo.ApplicationCommand {
 	return &discordgo.ApplicationCommand{
 		ID:          "remdind-me-nalak",
 		Name:        "remindme",
 		Description: "create a reminder",
 		Options: []*discordgo.ApplicationCommandOption{
-			{Name: "when", Required: true, Type: discordgo.ApplicationCommandOptionString, Description: "2 days, 1 hour, etc."},
 			{Name: "what", Required: true, Type: discordgo.ApplicationCommandOptionString, Description: "What is the reminder message?"},
+			{Name: "when", Required: false, Type: discordgo.ApplicationCommandOptionString, Description: "in 3h30m, at 5pm, tomorrow at 9am, friday, march 20, etc."},
+			{Name: "repeat", Required: false, Type: discordgo.ApplicationCommandOptionString, Description: "every day at 9am, every monday until 2024-01-01, cron 0 9 * * 1-5, etc."},
+			{Name: "dm", Required: false, Type: discordgo.ApplicationCommandOptionBoolean, Description: "Send the reminder to you by DM"},
 		},
 	}
 }
 func (p *ReminderPlugin) handleCreateReminderCMD(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	what := ""
 	when := ""
+	repeat := ""
+	dm := false
 	for _, opt := range i.ApplicationCommandData().Options {
 		if opt.Name == "when" {
 			when = opt.StringValue()
@@ -363,32 +562,65 @@ func (p *ReminderPlugin) handleCreateReminderCMD(s *discordgo.Session, i *discor
 		if opt.Name == "what" {
 			what = opt.StringValue()
 		}
+		if opt.Name == "repeat" {
+			repeat = opt.StringValue()
+		}
+		if opt.Name == "dm" {
+			dm = opt.BoolValue()
+		}
 	}
-	trigger, err := naturaldate.Parse(when, time.Now(), naturaldate.WithDirection(naturaldate.Future))
-	if err != nil {
-		p.sendInteractionResponse(s, i, fmt.Sprintf("unable to parse time: '%s'", when))
-		return
+	loc := p.location(userID(i))
+	now := p.clock.Now().In(loc)
+
+	var trigger time.Time
+	var recurrence *Recurrence
+	if repeat != "" {
+		first, rec, rest, err := parseRecurrence(strings.Fields(repeat), now)
+		if err == nil && len(rest) > 0 {
+			err = fmt.Errorf("didn't understand '%s'", strings.Join(rest, " "))
+		}
+		if err != nil {
+			p.sendInteractionResponse(s, i, fmt.Sprintf("unable to parse repeat: %s", err))
+			return
+		}
+		trigger, recurrence = first, rec
+	}
+	if when != "" || recurrence == nil {
+		t, rest, err := parseWhen(strings.Fields(when), now)
+		if err == nil && len(rest) > 0 {
+			err = &ParseError{Input: strings.Join(rest, " "), Reason: "expected nothing after the time"}
+		}
+		if err != nil {
+			p.sendInteractionResponse(s, i, fmt.Sprintf("unable to parse time: %s", err))
+			return
+		}
+		trigger = t
 	}
-	now := time.Now()
-	if trigger.Before(now) || trigger.After(now.Add(time.Hour*24*365+time.Hour)) {
-		fmt.Println("Invalid time", humanize.Time(trigger))
-		p.sendInteractionResponse(s, i, fmt.Sprintf("Invalid time. eg: %s", strings.Join(randomTimes, ", ")))
+	if err := validTime(trigger, now); err != nil {
+		p.sendInteractionResponse(s, i, fmt.Sprintf("Invalid time, %s. eg: %s", err, strings.Join(randomTimes, ", ")))
 		return
 	}
 
-	err = p.AddReminder(&Reminder{
-		StartTime: now,
-		Time:      trigger,
-		Requester: fmt.Sprintf("<@%s>", userID(i)),
-		Target:    i.ChannelID,
-		Message:   what,
-		IsPrivate: false,
-	})
+	reminder := &Reminder{
+		StartTime:  now,
+		Time:       trigger,
+		Requester:  fmt.Sprintf("<@%s>", userID(i)),
+		Target:     i.ChannelID,
+		Message:    what,
+		IsPrivate:  false,
+		Recurrence: recurrence,
+		DM:         dm,
+	}
+	err := p.AddReminder(reminder)
 	if err != nil {
 		p.sendInteractionResponse(s, i, fmt.Sprintf("error adding reminder: %s", err.Error()))
 		return
 	}
-	p.sendInteractionResponse(s, i, fmt.Sprintf("Added reminder for %s", humanize.Time(trigger)))
+	if recurrence != nil {
+		p.sendInteractionResponse(s, i, fmt.Sprintf("Added reminder %s for %s, repeating %s", reminder.ID, formatTime(trigger, loc), recurrence))
+		return
+	}
+	p.sendInteractionResponse(s, i, fmt.Sprintf("Added reminder %s for %s", reminder.ID, formatTime(trigger, loc)))
 }
 func userID(i *discordgo.InteractionCreate) string {
 	userID := ""
@@ -405,7 +637,8 @@ func (p *ReminderPlugin) sendInteractionResponse(s *discordgo.Session, i *discor
 	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
-			Content: msg,
+			Content:         msg,
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
 		},
 	})
 	if err != nil {
@@ -417,11 +650,26 @@ func (p *ReminderPlugin) sendInteractionResponse(s *discordgo.Session, i *discor
 
 // Save will save plugin state to a byte array.
 func (p *ReminderPlugin) Save() ([]byte, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.Reminders = p.scheduler.reminders(nil)
+	p.Announcements = p.announcer.reminders(nil)
+	for _, r := range p.paused {
+		p.Announcements = append(p.Announcements, r)
+	}
+	defer func() {
+		p.Reminders = nil
+		p.Announcements = nil
+	}()
 	return json.Marshal(p)
 }
 
 // Stats will return the stats for a plugin.
 func (p *ReminderPlugin) Stats(bot *bruxism.Bot, service bruxism.Service, message bruxism.Message) []string {
+	p.RLock()
+	defer p.RUnlock()
+
 	return []string{fmt.Sprintf("Reminders: \t%s\n", humanize.Comma(int64(p.TotalReminders)))}
 }
 
@@ -433,7 +681,16 @@ func (p *ReminderPlugin) Name() string {
 // New will create a new Reminder plugin.
 func New(discord *bruxism.Discord) bruxism.Plugin {
 	return &ReminderPlugin{
-		Reminders: []*Reminder{},
+		Timezones: map[string]string{},
+		Delivered: map[string]*Reminder{},
+		Consents:  map[string]*Consent{},
+		DMs:       map[string]bool{},
+		Failures:  map[string][]*Failure{},
+		CatchUp:   defaultCatchUp,
 		discord:   discord,
+		clock:     realClock{},
+		scheduler: newScheduler(realClock{}),
+		announcer: newScheduler(realClock{}),
+		paused:    map[string]*Reminder{},
 	}
 }
@@ -0,0 +1,362 @@
+package reminderplugin
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minRecurrenceInterval is the shortest time allowed between two occurrences
+// of a recurring reminder.
+const minRecurrenceInterval = 10 * time.Minute
+
+// maxCount is the largest number of occurrences a reminder can be limited to.
+const maxCount = 1000
+
+// A Recurrence describes how a reminder repeats after it fires.
+type Recurrence struct {
+	// Text is the schedule as the user wrote it, eg: every day at 9am.
+	Text string
+	// Every and Unit are set for interval schedules, eg: every 2 weeks.
+	Every int
+	Unit  string
+	// Day is the day of the month monthly and yearly schedules fall on,
+	// months without it use their last day.
+	Day int
+	// Cron is set for cron schedules, eg: 0 9 * * 1-5.
+	Cron string
+	// Location is the zone the schedule is in, so that 9am stays 9am across
+	// daylight saving changes.
+	Location string
+	// Until and Count optionally end the recurrence, Fired counts the
+	// occurrences so far.
+	Until time.Time
+	Count int
+	Fired int
+}
+
+// Next returns the first occurrence after now following the one at prev. It
+// returns false when the recurrence has ended.
+func (r *Recurrence) Next(prev, now time.Time) (time.Time, bool) {
+	if r.Count > 0 && r.Fired >= r.Count {
+		return time.Time{}, false
+	}
+
+	if r.Location != "" {
+		if loc, err := time.LoadLocation(r.Location); err == nil {
+			prev, now = prev.In(loc), now.In(loc)
+		}
+	}
+
+	var next time.Time
+	switch {
+	case r.Cron != "":
+		c, err := parseCron(r.Cron)
+		if err != nil {
+			return time.Time{}, false
+		}
+		next, err = c.next(maxTime(prev, now))
+		if err != nil {
+			return time.Time{}, false
+		}
+	case r.Every > 0:
+		var err error
+		next = prev
+		for !next.After(now) {
+			if next, err = r.step(next); err != nil {
+				log.Println("Error repeating reminder", err)
+				return time.Time{}, false
+			}
+		}
+	default:
+		return time.Time{}, false
+	}
+
+	if !r.Until.IsZero() && next.After(r.Until) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+func (r *Recurrence) String() string {
+	s := r.Text
+	if !r.Until.IsZero() {
+		s += " until " + r.Until.Format(dateFormat)
+	}
+	if r.Count > 0 {
+		s += fmt.Sprintf(", %d of %d", r.Fired+1, r.Count)
+	}
+	return s
+}
+
+// step returns the occurrence after t. Monthly and yearly schedules are kept
+// on their day so that the 31st doesn't move to the 3rd after February.
+func (r *Recurrence) step(t time.Time) (time.Time, error) {
+	if r.Day > 0 {
+		switch r.Unit {
+		case "month":
+			return addMonths(t, r.Every, r.Day), nil
+		case "year":
+			return addMonths(t, 12*r.Every, r.Day), nil
+		}
+	}
+	return addInterval(t, r.Every, r.Unit)
+}
+
+func addInterval(t time.Time, every int, unit string) (time.Time, error) {
+	switch unit {
+	case "minute":
+		return t.Add(time.Duration(every) * time.Minute), nil
+	case "hour":
+		return t.Add(time.Duration(every) * time.Hour), nil
+	case "day":
+		return t.AddDate(0, 0, every), nil
+	case "week":
+		return t.AddDate(0, 0, 7*every), nil
+	case "month":
+		return addMonths(t, every, t.Day()), nil
+	case "year":
+		return addMonths(t, 12*every, t.Day()), nil
+	}
+	return time.Time{}, fmt.Errorf("unknown interval unit: %s", unit)
+}
+
+// addMonths adds months to t, landing on day or the last day of shorter
+// months.
+func addMonths(t time.Time, months, day int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, 0, 0, 0, 0, t.Location())
+	if last := first.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+	return time.Date(first.Year(), first.Month(), day, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+const dateFormat = "2006-01-02"
+
+var units = map[string]string{
+	"min": "minute", "mins": "minute", "minute": "minute", "minutes": "minute",
+	"hr": "hour", "hrs": "hour", "hour": "hour", "hours": "hour",
+	"day": "day", "days": "day",
+	"week": "week", "weeks": "week",
+	"month": "month", "months": "month",
+	"year": "year", "years": "year",
+}
+
+func parseWeekday(s string) (time.Weekday, bool) {
+	s = strings.TrimSuffix(strings.ToLower(s), "s")
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := strings.ToLower(d.String())
+		if s == name || (len(s) >= 3 && strings.HasPrefix(name, s)) {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// parseClock parses a time of day like 9am, 9:30pm or 17:00.
+func parseClock(s string) (hour, min int, err error) {
+	s = strings.ToLower(s)
+	meridiem := ""
+	if strings.HasSuffix(s, "am") || strings.HasSuffix(s, "pm") {
+		meridiem = s[len(s)-2:]
+		s = s[:len(s)-2]
+	}
+
+	hm := strings.SplitN(s, ":", 2)
+	hour, err = strconv.Atoi(hm[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid time of day: %s", s)
+	}
+	if len(hm) == 2 {
+		min, err = strconv.Atoi(hm[1])
+		if err != nil || min < 0 || min > 59 {
+			return 0, 0, fmt.Errorf("invalid minutes: %s", s)
+		}
+	}
+
+	switch meridiem {
+	case "":
+		if hour < 0 || hour > 23 {
+			return 0, 0, fmt.Errorf("invalid hour: %d", hour)
+		}
+	default:
+		if hour < 1 || hour > 12 {
+			return 0, 0, fmt.Errorf("invalid hour: %d%s", hour, meridiem)
+		}
+		hour = hour % 12
+		if meridiem == "pm" {
+			hour += 12
+		}
+	}
+	return hour, min, nil
+}
+
+// atClock returns the first time at hour:min that is after now.
+func atClock(now time.Time, hour, min int) time.Time {
+	t := time.Date(now.Year(), now.Month(), now.Day(), hour, min, 0, 0, now.Location())
+	if !t.After(now) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t
+}
+
+// parseRecurrence parses a schedule at the start of parts, it returns the
+// first occurrence, the recurrence and the words that were not part of the
+// schedule. eg:
+//
+//	every day at 9am
+//	every 2 weeks
+//	every monday at 5pm until 2023-01-01
+//	every month for 6 times
+//	cron 0 9 * * 1-5
+func parseRecurrence(parts []string, now time.Time) (time.Time, *Recurrence, []string, error) {
+	if len(parts) == 0 {
+		return time.Time{}, nil, nil, errors.New("no schedule")
+	}
+
+	var first time.Time
+	rec := &Recurrence{Location: now.Location().String()}
+	rest := parts
+
+	switch strings.ToLower(parts[0]) {
+	case "cron":
+		if len(parts) < 6 {
+			return time.Time{}, nil, nil, errors.New("cron schedules need 5 fields, eg: cron 0 9 * * 1-5")
+		}
+		rec.Cron = strings.Join(parts[1:6], " ")
+		rec.Text = "cron " + rec.Cron
+		c, err := parseCron(rec.Cron)
+		if err != nil {
+			return time.Time{}, nil, nil, err
+		}
+		first, err = c.next(now)
+		if err != nil {
+			return time.Time{}, nil, nil, err
+		}
+		rest = parts[6:]
+
+	case "every":
+		rest = parts[1:]
+		rec.Every = 1
+		if len(rest) > 0 {
+			if n, err := strconv.Atoi(rest[0]); err == nil {
+				if n < 1 {
+					return time.Time{}, nil, nil, fmt.Errorf("invalid interval: %d", n)
+				}
+				rec.Every = n
+				rest = rest[1:]
+			}
+		}
+		if len(rest) == 0 {
+			return time.Time{}, nil, nil, errors.New("missing interval, eg: every day")
+		}
+
+		weekday, isWeekday := parseWeekday(rest[0])
+		unit, isUnit := units[strings.ToLower(rest[0])]
+		if !isUnit && !isWeekday {
+			return time.Time{}, nil, nil, fmt.Errorf("unknown interval: %s", rest[0])
+		}
+		if isWeekday && rec.Every != 1 {
+			return time.Time{}, nil, nil, fmt.Errorf("can't repeat every %d %s", rec.Every, rest[0])
+		}
+		rest = rest[1:]
+
+		hour, min, at := now.Hour(), now.Minute(), false
+		if len(rest) > 1 && strings.ToLower(rest[0]) == "at" {
+			var err error
+			hour, min, err = parseClock(rest[1])
+			if err != nil {
+				return time.Time{}, nil, nil, err
+			}
+			at = true
+			rest = rest[2:]
+		}
+
+		switch {
+		case isWeekday:
+			rec.Unit = "week"
+			rec.Text = "every " + strings.ToLower(weekday.String())
+			first = time.Date(now.Year(), now.Month(), now.Day(), hour, min, 0, 0, now.Location())
+			first = first.AddDate(0, 0, (int(weekday)-int(now.Weekday())+7)%7)
+			if !first.After(now) {
+				first = first.AddDate(0, 0, 7)
+			}
+		case at && unit != "minute" && unit != "hour":
+			rec.Unit = unit
+			rec.Text = intervalText(rec.Every, unit)
+			first = atClock(now, hour, min)
+		default:
+			rec.Unit = unit
+			rec.Text = intervalText(rec.Every, unit)
+			var err error
+			if first, err = addInterval(now, rec.Every, unit); err != nil {
+				return time.Time{}, nil, nil, err
+			}
+		}
+		if rec.Unit == "month" || rec.Unit == "year" {
+			rec.Day = first.Day()
+		}
+		if at {
+			rec.Text += fmt.Sprintf(" at %02d:%02d", hour, min)
+		}
+
+	default:
+		return time.Time{}, nil, nil, fmt.Errorf("schedules start with every or cron, not: %s", parts[0])
+	}
+
+	// optional end of the recurrence
+	if len(rest) > 1 && strings.ToLower(rest[0]) == "until" {
+		until, err := time.ParseInLocation(dateFormat, rest[1], now.Location())
+		if err != nil {
+			return time.Time{}, nil, nil, fmt.Errorf("invalid end date, use YYYY-MM-DD: %s", rest[1])
+		}
+		// the whole end day is included
+		rec.Until = until.AddDate(0, 0, 1).Add(-time.Second)
+		rest = rest[2:]
+	} else if len(rest) > 2 && strings.ToLower(rest[0]) == "for" && strings.HasPrefix(strings.ToLower(rest[2]), "time") {
+		count, err := strconv.Atoi(rest[1])
+		if err != nil || count < 1 || count > maxCount {
+			return time.Time{}, nil, nil, fmt.Errorf("invalid number of times: %s", rest[1])
+		}
+		rec.Count = count
+		rest = rest[3:]
+	}
+
+	if err := rec.validate(first); err != nil {
+		return time.Time{}, nil, nil, err
+	}
+	return first, rec, rest, nil
+}
+
+// validate checks that the recurrence doesn't repeat too often.
+func (r *Recurrence) validate(first time.Time) error {
+	probe := *r
+	second, ok := probe.Next(first, first)
+	if !ok {
+		if !r.Until.IsZero() && first.After(r.Until) {
+			return errors.New("the end date is before the first reminder")
+		}
+		return nil
+	}
+	if second.Sub(first) < minRecurrenceInterval {
+		return fmt.Errorf("reminders can't repeat more often than every %s", minRecurrenceInterval)
+	}
+	return nil
+}
+
+func intervalText(every int, unit string) string {
+	if every == 1 {
+		return "every " + unit
+	}
+	return fmt.Sprintf("every %d %ss", every, unit)
+}
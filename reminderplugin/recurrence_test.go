@@ -0,0 +1,172 @@
+package reminderplugin
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// a wednesday afternoon
+var testNow = time.Date(2023, time.March, 15, 14, 30, 0, 0, time.UTC)
+
+func TestParseRecurrence(t *testing.T) {
+	cases := []struct {
+		schedule string
+		first    time.Time
+		second   time.Time
+		rest     string
+		text     string
+	}{
+		{"every day at 9am walk the dog", time.Date(2023, time.March, 16, 9, 0, 0, 0, time.UTC), time.Date(2023, time.March, 17, 9, 0, 0, 0, time.UTC), "walk the dog", "every day at 09:00"},
+		{"every day at 5pm feed the cat", time.Date(2023, time.March, 15, 17, 0, 0, 0, time.UTC), time.Date(2023, time.March, 16, 17, 0, 0, 0, time.UTC), "feed the cat", "every day at 17:00"},
+		{"every monday standup", time.Date(2023, time.March, 20, 14, 30, 0, 0, time.UTC), time.Date(2023, time.March, 27, 14, 30, 0, 0, time.UTC), "standup", "every monday"},
+		{"every wednesday at 9:15am review", time.Date(2023, time.March, 22, 9, 15, 0, 0, time.UTC), time.Date(2023, time.March, 29, 9, 15, 0, 0, time.UTC), "review", "every wednesday at 09:15"},
+		{"every 2 weeks water plants", time.Date(2023, time.March, 29, 14, 30, 0, 0, time.UTC), time.Date(2023, time.April, 12, 14, 30, 0, 0, time.UTC), "water plants", "every 2 weeks"},
+		{"every 3 hours stretch", time.Date(2023, time.March, 15, 17, 30, 0, 0, time.UTC), time.Date(2023, time.March, 15, 20, 30, 0, 0, time.UTC), "stretch", "every 3 hours"},
+		{"every month pay rent", time.Date(2023, time.April, 15, 14, 30, 0, 0, time.UTC), time.Date(2023, time.May, 15, 14, 30, 0, 0, time.UTC), "pay rent", "every month"},
+		{"cron 0 9 * * 1-5 standup", time.Date(2023, time.March, 16, 9, 0, 0, 0, time.UTC), time.Date(2023, time.March, 17, 9, 0, 0, 0, time.UTC), "standup", "cron 0 9 * * 1-5"},
+		{"cron 30 8 1 * * invoices", time.Date(2023, time.April, 1, 8, 30, 0, 0, time.UTC), time.Date(2023, time.May, 1, 8, 30, 0, 0, time.UTC), "invoices", "cron 30 8 1 * *"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.schedule, func(t *testing.T) {
+			first, rec, rest, err := parseRecurrence(strings.Fields(c.schedule), testNow)
+			if err != nil {
+				t.Fatalf("unable to parse '%s': %+v", c.schedule, err)
+			}
+			if !first.Equal(c.first) {
+				t.Fatalf("expected first occurrence %s but got %s", c.first, first)
+			}
+			second, ok := rec.Next(first, first)
+			if !ok || !second.Equal(c.second) {
+				t.Fatalf("expected second occurrence %s but got %s", c.second, second)
+			}
+			if strings.Join(rest, " ") != c.rest {
+				t.Fatalf("expected message '%s' but got '%s'", c.rest, strings.Join(rest, " "))
+			}
+			if rec.Text != c.text {
+				t.Fatalf("expected text '%s' but got '%s'", c.text, rec.Text)
+			}
+		})
+	}
+}
+
+func TestParseRecurrenceErrors(t *testing.T) {
+	cases := []string{
+		"every",
+		"every fortnight",
+		"every 0 days",
+		"every 2 mondays",
+		"every day at 25:00",
+		"every 5 minutes",
+		"cron * * * * *",
+		"cron 0 9 * *",
+		"cron 0 24 * * *",
+		"every day until tomorrow",
+		"every day for 0 times",
+	}
+
+	for _, c := range cases {
+		t.Run(c, func(t *testing.T) {
+			if _, _, _, err := parseRecurrence(strings.Fields(c), testNow); err == nil {
+				t.Fatalf("expected '%s' to fail to parse", c)
+			}
+		})
+	}
+}
+
+func TestRecurrenceEnds(t *testing.T) {
+	first, rec, _, err := parseRecurrence(strings.Fields("every day for 2 times drink water"), testNow)
+	if err != nil {
+		t.Fatalf("unable to parse: %+v", err)
+	}
+	rec.Fired++
+	second, ok := rec.Next(first, first)
+	if !ok {
+		t.Fatal("expected a second occurrence")
+	}
+	rec.Fired++
+	if _, ok := rec.Next(second, second); ok {
+		t.Fatal("expected the recurrence to end after 2 times")
+	}
+
+	first, rec, _, err = parseRecurrence(strings.Fields("every day until 2023-03-17 drink water"), testNow)
+	if err != nil {
+		t.Fatalf("unable to parse: %+v", err)
+	}
+	second, ok = rec.Next(first, first)
+	if !ok {
+		t.Fatal("expected an occurrence on the end date")
+	}
+	if _, ok := rec.Next(second, second); ok {
+		t.Fatal("expected the recurrence to end after the end date")
+	}
+}
+
+func TestRecurrenceSkipsMissedOccurrences(t *testing.T) {
+	rec := &Recurrence{Text: "every day", Every: 1, Unit: "day"}
+	prev := testNow.AddDate(0, 0, -3)
+
+	next, ok := rec.Next(prev, testNow)
+	if !ok || !next.Equal(testNow.AddDate(0, 0, 1)) {
+		t.Fatalf("expected next occurrence to be after now, got %s", next)
+	}
+}
+
+func TestRecurrenceAcrossDST(t *testing.T) {
+	toronto, err := time.LoadLocation("America/Toronto")
+	if err != nil {
+		t.Skip("timezone data not available")
+	}
+	// the day before clocks spring forward
+	now := time.Date(2023, time.March, 11, 12, 0, 0, 0, toronto)
+
+	first, rec, _, err := parseRecurrence(strings.Fields("every day at 9am"), now)
+	if err != nil {
+		t.Fatalf("unable to parse: %+v", err)
+	}
+
+	// stored reminders lose their zone when saved as json
+	second, ok := rec.Next(first.UTC(), first.UTC())
+	if !ok {
+		t.Fatal("expected a second occurrence")
+	}
+	if second.In(toronto).Hour() != 9 {
+		t.Fatalf("expected 9am after the DST change, got %s", second.In(toronto))
+	}
+}
+
+func TestRecurrenceEndOfMonth(t *testing.T) {
+	now := time.Date(2023, time.January, 31, 8, 0, 0, 0, time.UTC)
+	first, rec, _, err := parseRecurrence(strings.Fields("every month at 9am pay rent"), now)
+	if err != nil {
+		t.Fatalf("unable to parse: %+v", err)
+	}
+
+	expected := []time.Time{
+		time.Date(2023, time.January, 31, 9, 0, 0, 0, time.UTC),
+		time.Date(2023, time.February, 28, 9, 0, 0, 0, time.UTC),
+		time.Date(2023, time.March, 31, 9, 0, 0, 0, time.UTC),
+		time.Date(2023, time.April, 30, 9, 0, 0, 0, time.UTC),
+		time.Date(2023, time.May, 31, 9, 0, 0, 0, time.UTC),
+	}
+	next := first
+	for i, e := range expected {
+		if !next.Equal(e) {
+			t.Fatalf("expected occurrence %d on %s but got %s", i+1, e, next)
+		}
+		var ok bool
+		if next, ok = rec.Next(next, next); !ok {
+			t.Fatalf("expected an occurrence after %s", e)
+		}
+	}
+}
+
+func TestRecurrenceUnknownUnit(t *testing.T) {
+	// eg: a reminder edited by hand in the saved state
+	rec := &Recurrence{Text: "every fortnight", Every: 1, Unit: "fortnight"}
+
+	if _, ok := rec.Next(testNow, testNow); ok {
+		t.Fatal("expected an unknown unit to end the recurrence")
+	}
+}
@@ -0,0 +1,296 @@
+package reminderplugin
+
+import (
+	"container/heap"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock tells the time and runs timers, so that tests can control both.
+type Clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a timer started by a Clock.
+type Timer interface {
+	Stop() bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// reminderHeap is a priority queue of reminders, the next one to fire first.
+type reminderHeap []*Reminder
+
+func (h reminderHeap) Len() int { return len(h) }
+
+func (h reminderHeap) Less(i, j int) bool { return h[i].Time.Before(h[j].Time) }
+
+func (h reminderHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *reminderHeap) Push(x interface{}) {
+	r := x.(*Reminder)
+	r.index = len(*h)
+	*h = append(*h, r)
+}
+
+func (h *reminderHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	r := old[n-1]
+	old[n-1] = nil
+	r.index = -1
+	*h = old[:n-1]
+	return r
+}
+
+// scheduler fires reminders when they are due, with a single timer set for
+// the earliest one.
+type scheduler struct {
+	sync.Mutex
+	clock Clock
+	queue reminderHeap
+	timer Timer
+	// fire is called outside of the lock with the reminders that are due, in
+	// time order, nil until the scheduler is started.
+	fire func([]*Reminder)
+	// firing holds the reminders passed to fire until it returns, they can
+	// be removed in the meantime so that they aren't queued again.
+	firing map[*Reminder]bool
+}
+
+func newScheduler(clock Clock) *scheduler {
+	return &scheduler{
+		clock:  clock,
+		firing: map[*Reminder]bool{},
+	}
+}
+
+// start begins firing reminders, reminders that are already due fire
+// straight away.
+func (s *scheduler) start(fire func([]*Reminder)) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.fire = fire
+	s.reset()
+}
+
+// stop stops firing reminders.
+func (s *scheduler) stop() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.fire = nil
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+}
+
+// add queues a reminder, giving it an ID if it doesn't have one yet.
+func (s *scheduler) add(r *Reminder) {
+	s.Lock()
+	defer s.Unlock()
+
+	if r.ID == "" {
+		r.ID = s.newID()
+	}
+	heap.Push(&s.queue, r)
+	if r.index == 0 {
+		s.reset()
+	}
+}
+
+// remove removes the first reminder, in time order, that match returns true
+// for and returns a copy of it.
+func (s *scheduler) remove(match func(*Reminder) bool) (Reminder, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, r := range s.sorted() {
+		if match(r) {
+			first := r.index == 0
+			heap.Remove(&s.queue, r.index)
+			if first {
+				s.reset()
+			}
+			return r.copy(), true
+		}
+	}
+	for r := range s.firing {
+		if match(r) {
+			delete(s.firing, r)
+			return r.copy(), true
+		}
+	}
+	return Reminder{}, false
+}
+
+// requeue queues a reminder that fired again, unless it was removed while
+// it fired.
+func (s *scheduler) requeue(r *Reminder) {
+	s.Lock()
+	if !s.firing[r] {
+		s.Unlock()
+		return
+	}
+	delete(s.firing, r)
+	s.Unlock()
+
+	s.add(r)
+}
+
+// update calls f on the first reminder, in time order, that match returns
+// true for and returns a copy of the updated reminder.
+func (s *scheduler) update(match func(*Reminder) bool, f func(*Reminder)) (Reminder, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, r := range s.sorted() {
+		if match(r) {
+			f(r)
+			heap.Fix(&s.queue, r.index)
+			s.reset()
+			return r.copy(), true
+		}
+	}
+	return Reminder{}, false
+}
+
+// count returns how many reminders match.
+func (s *scheduler) count(match func(*Reminder) bool) int {
+	s.Lock()
+	defer s.Unlock()
+
+	n := 0
+	for _, r := range s.queue {
+		if match(r) {
+			n++
+		}
+	}
+	return n
+}
+
+// reminders returns copies of the reminders that match, in time order, they
+// are safe to read while reminders fire.
+func (s *scheduler) reminders(match func(*Reminder) bool) []*Reminder {
+	s.Lock()
+	defer s.Unlock()
+
+	reminders := []*Reminder{}
+	for _, r := range s.sorted() {
+		if match == nil || match(r) {
+			c := r.copy()
+			reminders = append(reminders, &c)
+		}
+	}
+	return reminders
+}
+
+// idChars leaves out characters that are easily mistaken for each other.
+const idChars = "abcdefghjkmnpqrstuvwxyz23456789"
+
+const idLength = 4
+
+// randomID returns a random short ID, tests replace it to make IDs collide.
+var randomID = func() string {
+	b := make([]byte, idLength)
+	for i := range b {
+		b[i] = idChars[rand.Intn(len(idChars))]
+	}
+	return string(b)
+}
+
+// newID returns a short ID that no queued reminder has, the caller must hold
+// the lock.
+func (s *scheduler) newID() string {
+	for {
+		id := randomID()
+		if !s.has(id) {
+			return id
+		}
+	}
+}
+
+// has returns whether a queued reminder has the ID, the caller must hold the
+// lock.
+func (s *scheduler) has(id string) bool {
+	for _, r := range s.queue {
+		if r.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// sorted returns the queued reminders in time order, the caller must hold the
+// lock.
+func (s *scheduler) sorted() []*Reminder {
+	sorted := append([]*Reminder{}, s.queue...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time.Before(sorted[j].Time)
+	})
+	return sorted
+}
+
+// reset sets the timer for the earliest reminder, the caller must hold the
+// lock.
+func (s *scheduler) reset() {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if s.fire == nil || len(s.queue) == 0 {
+		return
+	}
+
+	d := s.queue[0].Time.Sub(s.clock.Now())
+	if d < 0 {
+		d = 0
+	}
+	s.timer = s.clock.AfterFunc(d, s.run)
+}
+
+// run fires every reminder that is due and sets the timer for the next one.
+func (s *scheduler) run() {
+	s.Lock()
+	fire := s.fire
+	if fire == nil {
+		s.Unlock()
+		return
+	}
+	now := s.clock.Now()
+	due := []*Reminder{}
+	for len(s.queue) > 0 && !s.queue[0].Time.After(now) {
+		r := heap.Pop(&s.queue).(*Reminder)
+		s.firing[r] = true
+		due = append(due, r)
+	}
+	s.reset()
+	s.Unlock()
+
+	if len(due) > 0 {
+		fire(due)
+	}
+
+	s.Lock()
+	for _, r := range due {
+		delete(s.firing, r)
+	}
+	s.Unlock()
+}
@@ -0,0 +1,251 @@
+package reminderplugin
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock only moves when advanced, firing the timers that are due.
+type fakeClock struct {
+	sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock   *fakeClock
+	when    time.Time
+	f       func()
+	stopped bool
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.Lock()
+	defer c.Unlock()
+	t := &fakeTimer{clock: c, when: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.Lock()
+	defer t.clock.Unlock()
+	active := !t.stopped
+	t.stopped = true
+	return active
+}
+
+// active returns how many timers are waiting to fire.
+func (c *fakeClock) active() int {
+	c.Lock()
+	defer c.Unlock()
+	n := 0
+	for _, t := range c.timers {
+		if !t.stopped {
+			n++
+		}
+	}
+	return n
+}
+
+// advance moves the clock forward, running timers in order as they become
+// due.
+func (c *fakeClock) advance(d time.Duration) {
+	c.Lock()
+	end := c.now.Add(d)
+	c.Unlock()
+
+	for {
+		c.Lock()
+		sort.SliceStable(c.timers, func(i, j int) bool { return c.timers[i].when.Before(c.timers[j].when) })
+		var next *fakeTimer
+		for _, t := range c.timers {
+			if !t.stopped && !t.when.After(end) {
+				next = t
+				break
+			}
+		}
+		if next == nil {
+			c.now = end
+			c.Unlock()
+			return
+		}
+		next.stopped = true
+		if next.when.After(c.now) {
+			c.now = next.when
+		}
+		c.Unlock()
+		next.f()
+	}
+}
+
+func newTestScheduler() (*fakeClock, *scheduler, *[]string) {
+	clock := &fakeClock{now: testNow}
+	s := newScheduler(clock)
+	fired := &[]string{}
+	s.start(func(due []*Reminder) {
+		for _, r := range due {
+			*fired = append(*fired, r.Message)
+		}
+	})
+	return clock, s, fired
+}
+
+func TestSchedulerFiresInOrder(t *testing.T) {
+	clock, s, fired := newTestScheduler()
+
+	s.add(&Reminder{Time: testNow.Add(3 * time.Minute), Message: "third"})
+	s.add(&Reminder{Time: testNow.Add(1 * time.Minute), Message: "first"})
+	s.add(&Reminder{Time: testNow.Add(2 * time.Minute), Message: "second"})
+	s.add(&Reminder{Time: testNow.Add(time.Hour), Message: "later"})
+
+	if n := clock.active(); n != 1 {
+		t.Fatalf("expected a single timer but got %d", n)
+	}
+
+	clock.advance(90 * time.Second)
+	if len(*fired) != 1 || (*fired)[0] != "first" {
+		t.Fatalf("expected only the first reminder to fire but got %v", *fired)
+	}
+
+	clock.advance(2 * time.Minute)
+	expected := []string{"first", "second", "third"}
+	if len(*fired) != len(expected) {
+		t.Fatalf("expected %v but got %v", expected, *fired)
+	}
+	for i := range expected {
+		if (*fired)[i] != expected[i] {
+			t.Fatalf("expected %v but got %v", expected, *fired)
+		}
+	}
+
+	if n := s.count(func(*Reminder) bool { return true }); n != 1 {
+		t.Errorf("expected 1 reminder left but got %d", n)
+	}
+}
+
+func TestSchedulerRemove(t *testing.T) {
+	clock, s, fired := newTestScheduler()
+
+	s.add(&Reminder{Time: testNow.Add(time.Minute), Requester: "a", Message: "one"})
+	s.add(&Reminder{Time: testNow.Add(2 * time.Minute), Requester: "b", Message: "two"})
+	s.add(&Reminder{Time: testNow.Add(3 * time.Minute), Requester: "a", Message: "three"})
+
+	r, ok := s.remove(requestedBy("a"))
+	if !ok || r.Message != "one" {
+		t.Fatalf("expected to remove the earliest reminder of a but got %v %v", r.Message, ok)
+	}
+	if _, ok := s.remove(func(r *Reminder) bool { return r.Message == "missing" }); ok {
+		t.Fatal("expected nothing to be removed")
+	}
+
+	clock.advance(time.Minute)
+	if len(*fired) != 0 {
+		t.Fatalf("expected the removed reminder not to fire but got %v", *fired)
+	}
+	clock.advance(5 * time.Minute)
+	if len(*fired) != 2 || (*fired)[0] != "two" || (*fired)[1] != "three" {
+		t.Fatalf("expected two and three to fire but got %v", *fired)
+	}
+	if n := clock.active(); n != 0 {
+		t.Errorf("expected no timers once empty but got %d", n)
+	}
+}
+
+func TestSchedulerOverdue(t *testing.T) {
+	clock := &fakeClock{now: testNow}
+	s := newScheduler(clock)
+	s.add(&Reminder{Time: testNow.Add(-time.Hour), Message: "overdue"})
+
+	if n := clock.active(); n != 0 {
+		t.Fatalf("expected no timer before starting but got %d", n)
+	}
+
+	fired := []string{}
+	s.start(func(due []*Reminder) {
+		for _, r := range due {
+			fired = append(fired, r.Message)
+		}
+	})
+	clock.advance(0)
+	if len(fired) != 1 {
+		t.Fatalf("expected overdue reminders to fire on start but got %v", fired)
+	}
+}
+
+func TestRecurringReminderReschedules(t *testing.T) {
+	clock, p, _ := newTestPlugin()
+
+	_, rec, _, err := parseRecurrence([]string{"every", "day", "for", "2", "times"}, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fired := 0
+	p.scheduler.start(func(due []*Reminder) {
+		for _, r := range due {
+			fired++
+			p.reschedule(r)
+		}
+	})
+	if err := p.AddReminder(&Reminder{Time: testNow.Add(time.Hour), Requester: "a", Message: "stretch", Recurrence: rec}); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.advance(49 * time.Hour)
+	if fired != 2 {
+		t.Errorf("expected the reminder to fire twice but got %d", fired)
+	}
+	if n := p.scheduler.count(requestedBy("a")); n != 0 {
+		t.Errorf("expected the reminder to end but %d are left", n)
+	}
+}
+
+func TestReminderDeletedWhileFiring(t *testing.T) {
+	clock, p, _ := newTestPlugin()
+
+	_, rec, _, err := parseRecurrence([]string{"every", "day"}, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &Reminder{Time: testNow.Add(time.Hour), Requester: "a", Message: "stretch", Recurrence: rec}
+	p.scheduler.start(func(due []*Reminder) {
+		for _, d := range due {
+			if _, err := p.deleteReminder("a", d.ID); err != nil {
+				t.Errorf("expected a firing reminder to be deleted but got %v", err)
+			}
+			p.reschedule(d)
+		}
+	})
+	p.AddReminder(r)
+
+	clock.advance(2 * time.Hour)
+	if n := p.scheduler.count(requestedBy("a")); n != 0 {
+		t.Errorf("expected the deleted reminder not to come back but %d are queued", n)
+	}
+}
+
+func TestSaveLoadReminders(t *testing.T) {
+	clock, p, _ := newTestPlugin()
+	p.AddReminder(&Reminder{Time: testNow.Add(time.Hour), Requester: "a", Message: "one"})
+	p.AddReminder(&Reminder{Time: testNow.Add(time.Minute), Requester: "a", Message: "two"})
+
+	data, err := p.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := &ReminderPlugin{clock: clock, scheduler: newScheduler(clock), announcer: newScheduler(clock)}
+	loaded.load(data)
+	reminders := loaded.scheduler.reminders(nil)
+	if len(reminders) != 2 || reminders[0].Message != "two" || reminders[1].Message != "one" {
+		t.Fatalf("unexpected reminders after load: %v", reminders)
+	}
+}
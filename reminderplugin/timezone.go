@@ -0,0 +1,75 @@
+package reminderplugin
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// location returns the timezone the user has set, or the bot's own zone.
+func (p *ReminderPlugin) location(userID string) *time.Location {
+	p.RLock()
+	name, ok := p.Timezones[userID]
+	p.RUnlock()
+	if !ok {
+		return time.Local
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// setTimezone validates and stores the timezone for a user, an empty name
+// resets it to the bot's zone.
+func (p *ReminderPlugin) setTimezone(userID, name string) (*time.Location, error) {
+	if name == "" {
+		p.Lock()
+		delete(p.Timezones, userID)
+		p.Unlock()
+		return time.Local, nil
+	}
+
+	// time.LoadLocation is case sensitive but users aren't
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		loc, err = time.LoadLocation(canonicalZone(name))
+	}
+	if err != nil || strings.EqualFold(name, "local") {
+		return nil, fmt.Errorf("Unknown timezone '%s', use a name like America/Toronto or Europe/Berlin.", name)
+	}
+
+	p.Lock()
+	if p.Timezones == nil {
+		p.Timezones = map[string]string{}
+	}
+	p.Timezones[userID] = loc.String()
+	p.Unlock()
+	return loc, nil
+}
+
+// canonicalZone capitalizes zone names, eg: america/new_york -> America/New_York.
+func canonicalZone(name string) string {
+	if strings.EqualFold(name, "utc") {
+		return "UTC"
+	}
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		words := strings.Split(part, "_")
+		for j, w := range words {
+			if len(w) > 0 {
+				words[j] = strings.ToUpper(w[:1]) + strings.ToLower(w[1:])
+			}
+		}
+		parts[i] = strings.Join(words, "_")
+	}
+	return strings.Join(parts, "/")
+}
+
+// formatTime shows t in the user's zone along with a discord timestamp that
+// every reader sees in their own zone.
+func formatTime(t time.Time, loc *time.Location) string {
+	return fmt.Sprintf("%s (<t:%d:R>)", t.In(loc).Format("Mon Jan 2 2006 3:04pm MST"), t.Unix())
+}
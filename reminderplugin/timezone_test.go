@@ -0,0 +1,35 @@
+package reminderplugin
+
+import "testing"
+
+func TestSetTimezone(t *testing.T) {
+	cases := []struct {
+		zone     string
+		expected string
+	}{
+		{"America/Toronto", "America/Toronto"},
+		{"america/new_york", "America/New_York"},
+		{"utc", "UTC"},
+		{"Mars/Olympus_Mons", ""},
+		{"local", ""},
+	}
+
+	p := &ReminderPlugin{}
+	for _, c := range cases {
+		t.Run(c.zone, func(t *testing.T) {
+			loc, err := p.setTimezone("1234", c.zone)
+			if c.expected == "" {
+				if err == nil {
+					t.Fatalf("expected '%s' to be rejected", c.zone)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unable to set timezone '%s': %+v", c.zone, err)
+			}
+			if loc.String() != c.expected || p.location("1234").String() != c.expected {
+				t.Fatalf("expected timezone %s but got %s", c.expected, loc)
+			}
+		})
+	}
+}
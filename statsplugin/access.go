@@ -0,0 +1,272 @@
+package statsplugin
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// roleCacheTTL is how long a guild's roles are used before they are
+	// fetched again.
+	roleCacheTTL  = 10 * time.Minute
+	defaultDenial = "You don't have access to stats on this server."
+	maxDenial     = 500
+)
+
+// permissions that access rules can ask for, by the option's value.
+var accessPermissions = map[string]int64{
+	"manage_server":    discordgo.PermissionManageServer,
+	"manage_channels":  discordgo.PermissionManageChannels,
+	"manage_messages":  discordgo.PermissionManageMessages,
+	"moderate_members": discordgo.PermissionModerateMembers,
+	"view_audit_log":   discordgo.PermissionViewAuditLogs,
+	"none":             0,
+}
+
+// An AccessRule limits /stats in a guild to admins, members with one of the
+// roles and members with all of the permission bits.
+type AccessRule struct {
+	RoleIDs     []string
+	Permissions int64
+	// Denial is sent to members that aren't allowed, instead of the default.
+	Denial string
+}
+
+// allows returns whether a member passes the rule.
+func (r *AccessRule) allows(member *discordgo.Member) bool {
+	if member == nil {
+		return false
+	}
+	if member.Permissions&(discordgo.PermissionAdministrator|discordgo.PermissionManageServer) != 0 {
+		return true
+	}
+	if r.Permissions != 0 && member.Permissions&r.Permissions == r.Permissions {
+		return true
+	}
+	for _, roleID := range member.Roles {
+		for _, allowed := range r.RoleIDs {
+			if roleID == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r *AccessRule) denial() string {
+	if r == nil || r.Denial == "" {
+		return defaultDenial
+	}
+	return r.Denial
+}
+
+type cachedRoles struct {
+	roles   map[string]*discordgo.Role
+	fetched time.Time
+}
+
+// roleCache keeps the roles of each guild for a while so that checking and
+// showing rules doesn't fetch them every time.
+type roleCache struct {
+	sync.Mutex
+	clock  Clock
+	fetch  func(guildID string) ([]*discordgo.Role, error)
+	guilds map[string]*cachedRoles
+}
+
+func newRoleCache(clock Clock, fetch func(guildID string) ([]*discordgo.Role, error)) *roleCache {
+	return &roleCache{
+		clock:  clock,
+		fetch:  fetch,
+		guilds: map[string]*cachedRoles{},
+	}
+}
+
+// roles returns a guild's roles by id.
+func (c *roleCache) roles(guildID string) (map[string]*discordgo.Role, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	now := c.clock.Now()
+	if cached, ok := c.guilds[guildID]; ok && now.Sub(cached.fetched) < roleCacheTTL {
+		return cached.roles, nil
+	}
+	guildRoles, err := c.fetch(guildID)
+	if err != nil {
+		return nil, err
+	}
+	roles := map[string]*discordgo.Role{}
+	for _, role := range guildRoles {
+		roles[role.ID] = role
+	}
+	c.guilds[guildID] = &cachedRoles{roles: roles, fetched: now}
+	return roles, nil
+}
+
+// accessRule returns a guild's rule, nil when anyone can use /stats. Guilds
+// configured with role names get a rule with the roles' ids the first time
+// they are looked up.
+func (w *StatsPlugin) accessRule(guildID string) *AccessRule {
+	w.Lock()
+	rule, ok := w.AccessRules[guildID]
+	names := w.allowedRoles[guildID]
+	w.Unlock()
+	if ok || len(names) == 0 {
+		return rule
+	}
+
+	rule = &AccessRule{}
+	roles, err := w.roles.roles(guildID)
+	if err != nil {
+		log.Println("unable to get guild roles for guild:", guildID, err)
+		return rule
+	}
+	for _, name := range names {
+		for _, role := range roles {
+			if role.Name == name {
+				rule.RoleIDs = append(rule.RoleIDs, role.ID)
+			}
+		}
+	}
+	sort.Strings(rule.RoleIDs)
+
+	w.Lock()
+	defer w.Unlock()
+	if existing, ok := w.AccessRules[guildID]; ok {
+		return existing
+	}
+	w.AccessRules[guildID] = rule
+	return rule
+}
+
+func (w *StatsPlugin) isAllowed(i *discordgo.InteractionCreate) bool {
+	rule := w.accessRule(i.GuildID)
+	return rule == nil || rule.allows(i.Member)
+}
+
+// denyAccess tells the member they can't use /stats, only they see it.
+func (w *StatsPlugin) denyAccess(s *discordgo.Session, i *discordgo.InteractionCreate, userID string) {
+	log.Printf("unauthorized user: '%s' requested stats on guild: '%s'", userID, i.GuildID)
+	w.respondEphemeral(s, i, w.accessRule(i.GuildID).denial())
+}
+
+// accessText describes a guild's rule.
+func (w *StatsPlugin) accessText(guildID string) string {
+	rule := w.accessRule(guildID)
+	if rule == nil {
+		return "Everyone can use /stats on this server."
+	}
+	allowed := []string{"admins"}
+	roles, err := w.roles.roles(guildID)
+	if err != nil {
+		log.Println("unable to get guild roles for guild:", guildID, err)
+	}
+	for _, roleID := range rule.RoleIDs {
+		if _, ok := roles[roleID]; roles != nil && !ok {
+			allowed = append(allowed, fmt.Sprintf("deleted role %s", roleID))
+			continue
+		}
+		allowed = append(allowed, fmt.Sprintf("<@&%s>", roleID))
+	}
+	for name, bits := range accessPermissions {
+		if bits != 0 && rule.Permissions == bits {
+			allowed = append(allowed, "members with "+strings.ReplaceAll(name, "_", " "))
+		}
+	}
+	return fmt.Sprintf("Only %s can use /stats on this server.\nOthers are told: %s", strings.Join(allowed, ", "), rule.denial())
+}
+
+// updateAccessRule changes a copy of a guild's rule, creating it if there
+// isn't one, and replaces the rule with it. Rules are never changed in place
+// so they can be read without the lock.
+func (w *StatsPlugin) updateAccessRule(guildID string, update func(rule *AccessRule)) {
+	w.accessRule(guildID)
+
+	w.Lock()
+	defer w.Unlock()
+	rule := &AccessRule{}
+	if existing := w.AccessRules[guildID]; existing != nil {
+		*rule = *existing
+		rule.RoleIDs = append([]string{}, existing.RoleIDs...)
+	}
+	update(rule)
+	w.AccessRules[guildID] = rule
+}
+
+// resetAccessRule goes back to the role names from the bot's config, guilds
+// without any are open to everyone.
+func (w *StatsPlugin) resetAccessRule(guildID string) {
+	w.Lock()
+	defer w.Unlock()
+	delete(w.AccessRules, guildID)
+}
+
+// handleAccessCommand shows a guild's rule, admins can change it.
+func (w *StatsPlugin) handleAccessCommand(s *discordgo.Session, i *discordgo.InteractionCreate, userID string, options []*discordgo.ApplicationCommandInteractionDataOption) {
+	if !isAdmin(i) && userID != w.discord.OwnerUserID {
+		log.Printf("unauthorized user: '%s' tried to change stats access on guild: '%s'", userID, i.GuildID)
+		w.respondEphemeral(s, i, "You need the Manage Server permission to change who can use stats.")
+		return
+	}
+
+	for _, opt := range options {
+		if opt.Name == "reset" && opt.BoolValue() {
+			w.resetAccessRule(i.GuildID)
+			w.respondEphemeral(s, i, w.accessText(i.GuildID))
+			return
+		}
+	}
+	roleID, remove := "", false
+	permission, denial := "", ""
+	for _, opt := range options {
+		switch opt.Name {
+		case "role":
+			roleID = opt.RoleValue(nil, "").ID
+		case "remove":
+			remove = opt.BoolValue()
+		case "permission":
+			permission = opt.StringValue()
+		case "denial":
+			denial = strings.TrimSpace(opt.StringValue())
+		}
+	}
+	if len(denial) > maxDenial {
+		w.respondEphemeral(s, i, fmt.Sprintf("The denial message can be at most %d characters.", maxDenial))
+		return
+	}
+	if roleID != "" || permission != "" || denial != "" {
+		w.updateAccessRule(i.GuildID, func(rule *AccessRule) {
+			if roleID != "" {
+				rule.RoleIDs = editRoles(rule.RoleIDs, roleID, remove)
+			}
+			if bits, ok := accessPermissions[permission]; ok {
+				rule.Permissions = bits
+			}
+			if denial != "" {
+				rule.Denial = denial
+			}
+		})
+	}
+	w.respondEphemeral(s, i, w.accessText(i.GuildID))
+}
+
+// editRoles adds or removes a role, keeping the ids sorted.
+func editRoles(roleIDs []string, roleID string, remove bool) []string {
+	edited := []string{}
+	for _, id := range roleIDs {
+		if id != roleID {
+			edited = append(edited, id)
+		}
+	}
+	if !remove {
+		edited = append(edited, roleID)
+	}
+	sort.Strings(edited)
+	return edited
+}
@@ -0,0 +1,113 @@
+package statsplugin
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessRuleAllows(t *testing.T) {
+	rule := &AccessRule{RoleIDs: []string{"mods"}, Permissions: discordgo.PermissionManageMessages}
+
+	tests := []struct {
+		name   string
+		member *discordgo.Member
+		want   bool
+	}{
+		{"no member", nil, false},
+		{"no roles", &discordgo.Member{}, false},
+		{"allowed role", &discordgo.Member{Roles: []string{"fans", "mods"}}, true},
+		{"other role", &discordgo.Member{Roles: []string{"fans"}}, false},
+		{"permission", &discordgo.Member{Permissions: discordgo.PermissionManageMessages | discordgo.PermissionSendMessages}, true},
+		{"admin", &discordgo.Member{Permissions: discordgo.PermissionManageServer}, true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, rule.allows(tt.member), tt.name)
+	}
+
+	adminsOnly := &AccessRule{}
+	assert.False(t, adminsOnly.allows(&discordgo.Member{Permissions: discordgo.PermissionManageMessages}))
+	assert.Equal(t, defaultDenial, adminsOnly.denial())
+	assert.Equal(t, defaultDenial, (*AccessRule)(nil).denial())
+}
+
+func TestRoleCache(t *testing.T) {
+	clock := &fixedClock{now: dayAfterDST}
+	fetches := 0
+	fail := false
+	cache := newRoleCache(clock, func(guildID string) ([]*discordgo.Role, error) {
+		fetches++
+		if fail {
+			return nil, errors.New("offline")
+		}
+		return []*discordgo.Role{{ID: "1", Name: "Moderator"}}, nil
+	})
+
+	roles, err := cache.roles("g")
+	assert.Nil(t, err)
+	assert.Equal(t, "Moderator", roles["1"].Name)
+	clock.now = clock.now.Add(roleCacheTTL - time.Second)
+	_, err = cache.roles("g")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, fetches, "roles are cached")
+
+	clock.now = clock.now.Add(time.Second)
+	fail = true
+	_, err = cache.roles("g")
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, fetches, "roles are fetched again once they expire")
+}
+
+func TestAccessRuleFromRoleNames(t *testing.T) {
+	w := newTestStatsPlugin(dayAfterDST)
+	w.allowedRoles = map[string][]string{"g": {"Moderator", "Engineer", "Gone"}}
+	fail := true
+	w.roles = newRoleCache(w.clock, func(guildID string) ([]*discordgo.Role, error) {
+		if fail {
+			return nil, errors.New("offline")
+		}
+		return []*discordgo.Role{{ID: "2", Name: "Engineer"}, {ID: "1", Name: "Moderator"}, {ID: "3", Name: "Member"}}, nil
+	})
+
+	assert.Nil(t, w.accessRule("open"), "guilds without rules are open")
+	assert.Equal(t, &AccessRule{}, w.accessRule("g"), "only admins until the roles are known")
+	assert.Empty(t, w.AccessRules)
+
+	fail = false
+	assert.Equal(t, &AccessRule{RoleIDs: []string{"1", "2"}}, w.accessRule("g"))
+	assert.Equal(t, &AccessRule{RoleIDs: []string{"1", "2"}}, w.AccessRules["g"])
+
+	w.updateAccessRule("g", func(rule *AccessRule) {
+		rule.RoleIDs = editRoles(rule.RoleIDs, "1", true)
+		rule.RoleIDs = editRoles(rule.RoleIDs, "3", false)
+	})
+	assert.Equal(t, []string{"2", "3"}, w.accessRule("g").RoleIDs)
+	assert.Contains(t, w.accessText("g"), "<@&2>, <@&3>")
+
+	w.resetAccessRule("g")
+	assert.Equal(t, &AccessRule{RoleIDs: []string{"1", "2"}}, w.accessRule("g"), "a reset guild goes back to the role names")
+
+	w.updateAccessRule("open", func(rule *AccessRule) {
+		rule.RoleIDs = editRoles(rule.RoleIDs, "1", false)
+	})
+	w.resetAccessRule("open")
+	assert.Equal(t, "Everyone can use /stats on this server.", w.accessText("open"))
+}
+
+func TestUpdateAccessRuleReplacesRule(t *testing.T) {
+	w := newTestStatsPlugin(dayAfterDST)
+	w.updateAccessRule("g", func(rule *AccessRule) {
+		rule.RoleIDs = editRoles(rule.RoleIDs, "1", false)
+	})
+	before := w.accessRule("g")
+
+	w.updateAccessRule("g", func(rule *AccessRule) {
+		rule.RoleIDs[0] = "2"
+		rule.Denial = "no"
+	})
+	assert.Equal(t, &AccessRule{RoleIDs: []string{"1"}}, before, "rules that were looked up don't change")
+	assert.Equal(t, &AccessRule{RoleIDs: []string{"2"}, Denial: "no"}, w.accessRule("g"))
+}
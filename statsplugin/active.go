@@ -0,0 +1,179 @@
+package statsplugin
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/RoaringBitmap/roaring/roaring64"
+	"github.com/pkg/errors"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/plotutil"
+	"gonum.org/v1/plot/vg"
+)
+
+const (
+	periodActive = "active"
+	activeDays   = 60
+	cohortWeeks  = 4
+)
+
+// activeCounts is how many users were active on a day and in the week and
+// month up to it.
+type activeCounts struct {
+	Day time.Time
+	DAU uint64
+	WAU uint64
+	MAU uint64
+}
+
+// A cohort is the users active in a week and how many of them were also
+// active the week after.
+type cohort struct {
+	Week     time.Time
+	Users    uint64
+	Retained uint64
+}
+
+// usersBetween unions the users of the days from from until, but not
+// including, to.
+func (h *History) usersBetween(from, to time.Time) *roaring64.Bitmap {
+	users := roaring64.New()
+	fromKey, toKey := from.Format(bsDateFormat), to.Format(bsDateFormat)
+	for _, a := range h.Daily {
+		if a.Start >= fromKey && a.Start < toKey && a.Users.Bitmap != nil {
+			users.Or(a.Users.Bitmap)
+		}
+	}
+	return users
+}
+
+// weekUsers returns the users of the week starting on start.
+func (h *History) weekUsers(start time.Time) *roaring64.Bitmap {
+	key := start.Format(bsDateFormat)
+	for _, a := range h.Weekly {
+		if a.Start == key && a.Users.Bitmap != nil {
+			return a.Users.Bitmap
+		}
+	}
+	return roaring64.New()
+}
+
+// Active returns the daily, weekly and monthly active users of the last days,
+// oldest first.
+func (h *History) Active(now time.Time, days int) []activeCounts {
+	counts := []activeCounts{}
+	day := dayStart(now).AddDate(0, 0, -(days - 1))
+	for i := 0; i < days; i++ {
+		next := day.AddDate(0, 0, 1)
+		counts = append(counts, activeCounts{
+			Day: day,
+			DAU: h.usersBetween(day, next).GetCardinality(),
+			WAU: h.usersBetween(next.AddDate(0, 0, -7), next).GetCardinality(),
+			MAU: h.usersBetween(next.AddDate(0, 0, -30), next).GetCardinality(),
+		})
+		day = next
+	}
+	return counts
+}
+
+// Retention returns the cohorts of the last weeks, oldest first. The last
+// one is last week's users and how many of them are back this week.
+func (h *History) Retention(now time.Time, weeks int) []cohort {
+	cohorts := []cohort{}
+	start := weekStart(now).AddDate(0, 0, -7*weeks)
+	for i := 0; i < weeks; i++ {
+		users := h.weekUsers(start)
+		next := start.AddDate(0, 0, 7)
+		cohorts = append(cohorts, cohort{
+			Week:     start,
+			Users:    users.GetCardinality(),
+			Retained: users.AndCardinality(h.weekUsers(next)),
+		})
+		start = next
+	}
+	return cohorts
+}
+
+// NewAndReturning splits the users of the week now is in into those that
+// weren't seen in any earlier week that is still kept and those that were.
+func (h *History) NewAndReturning(now time.Time) (uint64, uint64) {
+	start := weekStart(now)
+	users := h.weekUsers(start)
+	seen := roaring64.New()
+	key := start.Format(bsDateFormat)
+	for _, a := range h.Weekly {
+		if a.Start < key && a.Users.Bitmap != nil {
+			seen.Or(a.Users.Bitmap)
+		}
+	}
+	returning := users.AndCardinality(seen)
+	return users.GetCardinality() - returning, returning
+}
+
+func percent(part, whole uint64) string {
+	if whole == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f%%", float64(part)/float64(whole)*100)
+}
+
+// activeText summarizes active users, retention and new users.
+func (h *History) activeText(now time.Time) string {
+	counts := h.Active(now, 1)[0]
+	lines := []string{
+		fmt.Sprintf("Active users today: %d, this week: %d, this month: %d (DAU/MAU %s)", counts.DAU, counts.WAU, counts.MAU, percent(counts.DAU, counts.MAU)),
+	}
+	newUsers, returning := h.NewAndReturning(now)
+	lines = append(lines, fmt.Sprintf("This week: %d new and %d returning users", newUsers, returning))
+	lines = append(lines, "Users that came back the week after:")
+	for _, c := range h.Retention(now, cohortWeeks) {
+		lines = append(lines, fmt.Sprintf("Week of %s: %d of %d (%s)", c.Week.Format("2 Jan"), c.Retained, c.Users, percent(c.Retained, c.Users)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// plotActive draws daily, weekly and monthly active users over time.
+func plotActive(counts []activeCounts, opts chartOptions) (io.Reader, error) {
+	dau := make(plotter.XYs, len(counts))
+	wau := make(plotter.XYs, len(counts))
+	mau := make(plotter.XYs, len(counts))
+	labels := make([]string, len(counts))
+	for i, c := range counts {
+		dau[i] = plotter.XY{X: float64(i), Y: float64(c.DAU)}
+		wau[i] = plotter.XY{X: float64(i), Y: float64(c.WAU)}
+		mau[i] = plotter.XY{X: float64(i), Y: float64(c.MAU)}
+		if i%7 == 0 {
+			labels[i] = c.Day.Format("2-Jan")
+		}
+	}
+
+	pt := plot.New()
+	pt.Title.Text = "Active Users"
+	pt.X.Tick.Marker = ticks(labels)
+	pt.Y.Min = 0
+	if err := plotutil.AddLines(pt, "DAU", dau, "WAU", wau, "MAU", mau); err != nil {
+		return nil, errors.Wrap(err, "unable to add lines")
+	}
+	pt.Legend.Top = true
+	pt.Legend.Left = true
+	return render(pt, 10*vg.Inch, 5*vg.Inch, opts)
+}
+
+func (w *StatsPlugin) activeReport(guildID string, opts chartOptions) (string, io.Reader, error) {
+	w.Lock()
+	defer w.Unlock()
+
+	h, ok := w.History[guildID]
+	if !ok {
+		return "", nil, errors.New("no history for this server yet")
+	}
+	now := w.clock.Now().UTC()
+	img, err := plotActive(h.Active(now, activeDays), opts)
+	if err != nil {
+		return "", nil, err
+	}
+	return h.activeText(now), img, nil
+}
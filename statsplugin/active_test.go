@@ -0,0 +1,68 @@
+package statsplugin
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActiveUsers(t *testing.T) {
+	now := time.Date(2022, time.November, 16, 9, 0, 0, 0, timeZone) // a Wednesday
+	h := &History{}
+	// user 1 is active every day, user 2 every week on Monday and user 3
+	// only today
+	for day := 0; day < 40; day++ {
+		when := now.AddDate(0, 0, -day)
+		h.Add(when, 1, 1)
+		if when.Weekday() == time.Monday {
+			h.Add(when, 2, 1)
+		}
+	}
+	h.Add(now, 3, 1)
+
+	counts := h.Active(now, 10)
+	assert.Equal(t, 10, len(counts))
+	today := counts[9]
+	assert.Equal(t, uint64(2), today.DAU)
+	assert.Equal(t, uint64(3), today.WAU)
+	assert.Equal(t, uint64(3), today.MAU)
+	assert.Equal(t, uint64(1), counts[8].DAU, "tuesday only has user 1")
+	assert.Equal(t, uint64(2), counts[7].DAU, "monday has users 1 and 2")
+}
+
+func TestRetentionAndNewUsers(t *testing.T) {
+	now := time.Date(2022, time.November, 16, 9, 0, 0, 0, timeZone)
+	h := &History{}
+	lastWeek := now.AddDate(0, 0, -7)
+	for _, u := range []uint64{1, 2, 3, 4} {
+		h.Add(lastWeek, u, 1)
+	}
+	for _, u := range []uint64{1, 2, 5} {
+		h.Add(now, u, 1)
+	}
+
+	cohorts := h.Retention(now, 2)
+	assert.Equal(t, 2, len(cohorts))
+	last := cohorts[1]
+	assert.Equal(t, weekStart(lastWeek), last.Week)
+	assert.Equal(t, uint64(4), last.Users)
+	assert.Equal(t, uint64(2), last.Retained)
+
+	newUsers, returning := h.NewAndReturning(now)
+	assert.Equal(t, uint64(1), newUsers)
+	assert.Equal(t, uint64(2), returning)
+}
+
+func TestPlotActive(t *testing.T) {
+	h := &History{}
+	now := time.Date(2022, time.November, 16, 9, 0, 0, 0, timeZone)
+	h.Add(now, 1, 1)
+
+	img, err := plotActive(h.Active(now, activeDays), defaultChart)
+	assert.Nil(t, err)
+	data, err := io.ReadAll(img)
+	assert.Nil(t, err)
+	assert.Equal(t, "\x89PNG", string(data[:4]))
+}
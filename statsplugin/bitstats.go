@@ -2,6 +2,7 @@ package statsplugin
 
 import (
 	"log"
+	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -16,6 +17,12 @@ const bsHourlyFormat = "15"
 const bsDateFormat = "2006-01-02"
 
 func (w *StatsPlugin) recordMessage(guildID, channelID, userID string, typ bruxism.MessageType) {
+	w.recordEvent(guildID, channelID, userID, string(typ), w.clock.Now())
+}
+
+// recordEvent records that a user did something in the hour t is in, in the
+// guild and in the channel when there is one. Days and hours are in UTC.
+func (w *StatsPlugin) recordEvent(guildID, channelID, userID, event string, t time.Time) {
 	usrID, err := parseUserID(userID)
 	if err != nil {
 		log.Println(err)
@@ -28,12 +35,17 @@ func (w *StatsPlugin) recordMessage(guildID, channelID, userID string, typ bruxi
 		stats = bitstats.New()
 		w.GuildStats[guildID] = stats
 	}
-	now := w.clock.Now()
-	day := now.Format(bsDateFormat)
-	hour := now.Format(bsHourlyFormat)
-	stats.Add(day, string(typ)+":"+hour, usrID)
+	day := t.UTC().Format(bsDateFormat)
+	hour := t.UTC().Format(bsHourlyFormat)
+	stats.Add(day, event+":"+hour, usrID)
+	if channelID != "" {
+		stats.Add(day, channelEventPrefix(channelID, event)+hour, usrID)
+	}
+	trimPartitions(stats)
+}
 
-	// clean up extra days
+// trimPartitions removes the oldest days so only the last few are kept.
+func trimPartitions(stats *bitstats.Stats) {
 	for stats.PartitionsCount() >= 10 {
 		name, ok := stats.RemoveMinPartition()
 		if ok {
@@ -42,54 +54,125 @@ func (w *StatsPlugin) recordMessage(guildID, channelID, userID string, typ bruxi
 	}
 }
 
-func (w *StatsPlugin) statsToMatrix(guildID, eventPrefix string, fn func(*roaring64.Bitmap) int) (*WeekMsgCountMatrix, error) {
-	matrix := [7][24]int{}
+// statsToMatrix applies fn to the users of each hour of the last week, with
+// the days and hours in loc. When daylight saving time ends two hours fall in
+// the same local hour and their users are combined.
+func (w *StatsPlugin) statsToMatrix(guildID, eventPrefix string, loc *time.Location, fn func(*roaring64.Bitmap) int) (*WeekMsgCountMatrix, error) {
+	w.Lock()
+	defer w.Unlock()
+
 	stats, ok := w.GuildStats[guildID]
-	now := w.clock.Now()
+	now := w.clock.Now().In(loc)
 	if !ok {
 		return nil, errors.Errorf("Guild Stats not found for %s", guildID)
 	}
+	cells := [7][24]*roaring64.Bitmap{}
 	for _, part := range stats.Partitions() {
 		events, ok := stats.EventsByPrefix(part, eventPrefix)
 		if !ok {
-			break
+			continue
 		}
 		partDay, err := time.Parse(bsDateFormat, part)
 		if err != nil {
 			log.Printf("Unable to parse partition name: %s, ignoring", part)
 			continue
 		}
-		dayIndex := 7 - int(now.Sub(partDay).Hours()/24)
-		if dayIndex < 0 || dayIndex >= 7 {
-			log.Printf("Day index for %s is out of bounds [0, 6]: %d", part, dayIndex)
-			continue
-		}
 		for _, event := range events {
+			hour, err := eventHour(event)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			t := partDay.Add(time.Duration(hour) * time.Hour).In(loc)
+			dayIndex := 6 - daysBetween(t, now)
+			if dayIndex < 0 || dayIndex >= 7 {
+				continue
+			}
 			vals, ok := stats.ValuesSet(part, event)
 			if !ok {
 				log.Printf("Values Set not found for partition %s, event %s", part, event)
 				continue
 			}
-			parts := strings.SplitN(event, ":", 2)
-			if len(parts) < 2 {
-				log.Printf("event %s doesn't have 2 parts: %+v", event, parts)
-				continue
+			if cells[dayIndex][t.Hour()] == nil {
+				cells[dayIndex][t.Hour()] = roaring64.New()
 			}
-			hourIndex, err := strconv.Atoi(parts[1])
-			if err != nil {
-				log.Printf("unable to parse %s into hour", parts[1])
-				continue
+			cells[dayIndex][t.Hour()].Or(vals)
+		}
+	}
+	matrix := [7][24]int{}
+	for day := range cells {
+		for hour, users := range cells[day] {
+			if users != nil {
+				matrix[day][hour] = fn(users)
 			}
-			matrix[dayIndex][hourIndex] = fn(vals)
 		}
 	}
-	weekDate := w.clock.Now().Add(-6 * 24 * time.Hour)
 	return &WeekMsgCountMatrix{
 		matrix:    matrix,
-		startDate: weekDate,
+		startDate: now.AddDate(0, 0, -6),
 	}, nil
 }
 
+// toUTC moves stats recorded with days and hours in loc to UTC.
+func toUTC(stats *bitstats.Stats, loc *time.Location) *bitstats.Stats {
+	converted := bitstats.New()
+	for _, part := range stats.Partitions() {
+		partDay, err := time.ParseInLocation(bsDateFormat, part, loc)
+		if err != nil {
+			log.Printf("Unable to parse partition name: %s, ignoring", part)
+			continue
+		}
+		events, ok := stats.EventsByPrefix(part, "")
+		if !ok {
+			continue
+		}
+		for _, event := range events {
+			hour, err := eventHour(event)
+			if err != nil {
+				continue
+			}
+			vals, ok := stats.ValuesSet(part, event)
+			if !ok {
+				continue
+			}
+			t := time.Date(partDay.Year(), partDay.Month(), partDay.Day(), hour, 0, 0, 0, loc).UTC()
+			prefix := event[:strings.LastIndex(event, ":")+1]
+			for _, v := range vals.ToArray() {
+				converted.Add(t.Format(bsDateFormat), prefix+t.Format(bsHourlyFormat), v)
+			}
+		}
+	}
+	trimPartitions(converted)
+	return converted
+}
+
+// daysBetween returns how many calendar days from is before to.
+func daysBetween(from, to time.Time) int {
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, to.Location())
+	to = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, to.Location())
+	return int(math.Round(to.Sub(from).Hours() / 24))
+}
+
+// channelEventPrefix is the prefix of the events recorded for a channel,
+// followed by the hour like the guild wide events.
+func channelEventPrefix(channelID, eventType string) string {
+	return "channel:" + channelID + ":" + eventType + ":"
+}
+
+// eventHour returns the hour an event was recorded in, it is always the
+// last part of the event.
+func eventHour(event string) (int, error) {
+	i := strings.LastIndex(event, ":")
+	if i < 0 {
+		return 0, errors.Errorf("event %s doesn't have an hour", event)
+	}
+	hour, err := strconv.Atoi(event[i+1:])
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, errors.Errorf("unable to parse %s into hour", event[i+1:])
+	}
+	return hour, nil
+}
+
 func parseUserID(userID string) (uint64, error) {
 	usrID, err := strconv.ParseUint(userID, 10, 64)
 	if err != nil {
@@ -0,0 +1,134 @@
+package statsplugin
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/RoaringBitmap/roaring/roaring64"
+	"github.com/iopred/bruxism"
+)
+
+const topChannelsCount = 5
+
+// channelActivity is how active a channel was over the last week.
+type channelActivity struct {
+	ChannelID string
+	Messages  int
+	Users     uint64
+}
+
+func (w *StatsPlugin) recordChannelMessage(guildID, channelID string, t time.Time) {
+	if channelID == "" {
+		return
+	}
+	w.Lock()
+	defer w.Unlock()
+
+	channels, ok := w.ChannelStats[guildID]
+	if !ok {
+		channels = map[string]*StatsRecorder{}
+		w.ChannelStats[guildID] = channels
+	}
+	s, ok := channels[channelID]
+	if !ok {
+		s = NewStatsRecorder(localClock(time.UTC), 10)
+		channels[channelID] = s
+	}
+	s.Increment(t)
+}
+
+// channelMatrix is the weekly message count heatmap for a channel, in loc.
+func (w *StatsPlugin) channelMatrix(guildID, channelID string, loc *time.Location) (*WeekMsgCountMatrix, error) {
+	w.Lock()
+	defer w.Unlock()
+
+	s, ok := w.ChannelStats[guildID][channelID]
+	if !ok {
+		return nil, fmt.Errorf("no messages have been recorded in <#%s>", channelID)
+	}
+	return s.WeekMatrixIn(loc), nil
+}
+
+// channelUsers returns the users that sent messages in each of a guild's
+// channels over the last days.
+func (w *StatsPlugin) channelUsers(guildID string, days int) map[string]*roaring64.Bitmap {
+	users := map[string]*roaring64.Bitmap{}
+	stats, ok := w.GuildStats[guildID]
+	if !ok {
+		return users
+	}
+	now := w.clock.Now().UTC()
+	for _, part := range stats.Partitions() {
+		partDay, err := time.Parse(bsDateFormat, part)
+		if err != nil || daysBetween(partDay, now) >= days {
+			continue
+		}
+		events, ok := stats.EventsByPrefix(part, "channel:")
+		if !ok {
+			continue
+		}
+		for _, event := range events {
+			fields := strings.Split(event, ":")
+			if len(fields) != 4 || fields[2] != string(bruxism.MessageTypeCreate) {
+				continue
+			}
+			vals, ok := stats.ValuesSet(part, event)
+			if !ok {
+				log.Printf("Values Set not found for partition %s, event %s", part, event)
+				continue
+			}
+			if _, ok := users[fields[1]]; !ok {
+				users[fields[1]] = roaring64.New()
+			}
+			users[fields[1]].Or(vals)
+		}
+	}
+	return users
+}
+
+// topChannels ranks a guild's channels by the messages sent in them over the
+// last week, the number of users that sent them breaks ties.
+func (w *StatsPlugin) topChannels(guildID string, n int) []channelActivity {
+	w.Lock()
+	defer w.Unlock()
+
+	users := w.channelUsers(guildID, 7)
+	ranking := []channelActivity{}
+	for channelID, s := range w.ChannelStats[guildID] {
+		activity := channelActivity{ChannelID: channelID, Messages: s.Week()}
+		if u, ok := users[channelID]; ok {
+			activity.Users = u.GetCardinality()
+		}
+		if activity.Messages == 0 {
+			continue
+		}
+		ranking = append(ranking, activity)
+	}
+	sort.Slice(ranking, func(i, j int) bool {
+		if ranking[i].Messages != ranking[j].Messages {
+			return ranking[i].Messages > ranking[j].Messages
+		}
+		if ranking[i].Users != ranking[j].Users {
+			return ranking[i].Users > ranking[j].Users
+		}
+		return ranking[i].ChannelID < ranking[j].ChannelID
+	})
+	if len(ranking) > n {
+		ranking = ranking[:n]
+	}
+	return ranking
+}
+
+func channelRankingText(ranking []channelActivity) string {
+	if len(ranking) == 0 {
+		return "No channels have been active this week."
+	}
+	lines := []string{"Most active channels this week:"}
+	for i, c := range ranking {
+		lines = append(lines, fmt.Sprintf("%d. <#%s> %d messages from %d users", i+1, c.ChannelID, c.Messages, c.Users))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,107 @@
+package statsplugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RoaringBitmap/roaring/roaring64"
+	"github.com/iopred/bruxism"
+	"github.com/stretchr/testify/assert"
+	"github.com/voldyman/bitstats"
+)
+
+type fixedClock struct {
+	now time.Time
+}
+
+func (c *fixedClock) Now() time.Time {
+	return c.now
+}
+
+func newTestStatsPlugin(now time.Time) *StatsPlugin {
+	return &StatsPlugin{
+		clock:               &fixedClock{now: now},
+		MessageStats:        map[string]*StatsRecorder{},
+		GuildStats:          map[string]*bitstats.Stats{},
+		ChannelStats:        map[string]map[string]*StatsRecorder{},
+		History:             map[string]*History{},
+		MemberCounts:        map[string][]*MemberDay{},
+		LeaderboardOptOut:   map[string]map[string]bool{},
+		AccessRules:         map[string]*AccessRule{},
+		Digests:             map[string]*Digest{},
+		VoiceMinutes:        map[string]*StatsRecorder{},
+		ChannelVoiceMinutes: map[string]map[string]*StatsRecorder{},
+		voiceSessions:       map[string]*voiceSession{},
+	}
+}
+
+func TestChannelEvents(t *testing.T) {
+	now := time.Date(2022, time.October, 5, 15, 30, 0, 0, timeZone)
+	w := newTestStatsPlugin(now)
+
+	w.recordMessage("g", "general", "1", bruxism.MessageTypeCreate)
+	w.recordMessage("g", "general", "2", bruxism.MessageTypeCreate)
+	w.recordMessage("g", "events", "1", bruxism.MessageTypeCreate)
+
+	count := func(b *roaring64.Bitmap) int { return int(b.GetCardinality()) }
+	guild, err := w.statsToMatrix("g", string(bruxism.MessageTypeCreate), timeZone, count)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, guild.matrix[6][15], "guild events should count every user today")
+
+	general, err := w.statsToMatrix("g", channelEventPrefix("general", string(bruxism.MessageTypeCreate)), timeZone, count)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, general.matrix[6][15])
+
+	events, err := w.statsToMatrix("g", channelEventPrefix("events", string(bruxism.MessageTypeCreate)), timeZone, count)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, events.matrix[6][15])
+}
+
+func TestTopChannels(t *testing.T) {
+	now := testClock.Now()
+	w := newTestStatsPlugin(now)
+
+	messages := []struct {
+		channelID string
+		userID    string
+		count     int
+	}{
+		{"general", "1", 5},
+		{"general", "2", 5},
+		{"events", "1", 3},
+		{"memes", "1", 10},
+		{"quiet", "3", 1},
+	}
+	for _, m := range messages {
+		for i := 0; i < m.count; i++ {
+			w.recordMessage("g", m.channelID, m.userID, bruxism.MessageTypeCreate)
+			w.recordChannelMessage("g", m.channelID, now)
+		}
+	}
+
+	ranking := w.topChannels("g", 3)
+	assert.Equal(t, []channelActivity{
+		{ChannelID: "general", Messages: 10, Users: 2},
+		{ChannelID: "memes", Messages: 10, Users: 1},
+		{ChannelID: "events", Messages: 3, Users: 1},
+	}, ranking)
+
+	_, err := w.channelMatrix("g", "unknown", timeZone)
+	assert.NotNil(t, err)
+	matrix, err := w.channelMatrix("g", "memes", timeZone)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, sumDay(matrix.matrix[6]))
+}
+
+func TestEventHour(t *testing.T) {
+	hour, err := eventHour("create:07")
+	assert.Nil(t, err)
+	assert.Equal(t, 7, hour)
+
+	hour, err = eventHour(channelEventPrefix("123", "create") + "23")
+	assert.Nil(t, err)
+	assert.Equal(t, 23, hour)
+
+	_, err = eventHour("create")
+	assert.NotNil(t, err)
+}
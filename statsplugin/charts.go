@@ -0,0 +1,275 @@
+package statsplugin
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/iopred/bruxism"
+	"github.com/pkg/errors"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/plotutil"
+	"gonum.org/v1/plot/vg"
+)
+
+// chart types /stats can draw.
+const (
+	chartHeatmap = "heatmap"
+	chartDaily   = "daily"
+	chartHourly  = "hourly"
+	chartWeekday = "weekday"
+	chartOverlap = "overlap"
+)
+
+const (
+	defaultChartWeeks = 4
+	// maxChartWeeks fits in the daily history.
+	maxChartWeeks = dailyRetention / 7
+)
+
+// minChartWeeks is a variable so the weeks option can point to it.
+var minChartWeeks = 1.0
+
+var chartSizes = map[string]float64{
+	"small":  0.6,
+	"medium": 1,
+	"large":  1.5,
+}
+
+// chartOptions is how a chart is rendered.
+type chartOptions struct {
+	// Scale multiplies the chart's usual size.
+	Scale float64
+	// Format is png or svg.
+	Format string
+}
+
+var defaultChart = chartOptions{Scale: 1, Format: "png"}
+
+func (o chartOptions) fileName(name string) string {
+	return name + "." + o.Format
+}
+
+func (o chartOptions) contentType() string {
+	if o.Format == "svg" {
+		return "image/svg+xml"
+	}
+	return "image/png"
+}
+
+// render draws a plot at its usual size scaled by the options.
+func render(pt *plot.Plot, width, height vg.Length, opts chartOptions) (io.Reader, error) {
+	if opts.Scale <= 0 {
+		opts.Scale = 1
+	}
+	wt, err := pt.WriterTo(width*vg.Length(opts.Scale), height*vg.Length(opts.Scale), opts.Format)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create plot writer")
+	}
+	buf := bytes.Buffer{}
+	_, err = wt.WriteTo(&buf)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to writer plot to buffer")
+	}
+	return &buf, nil
+}
+
+// hourly calls fn with the messages sent in each hour from from until, but
+// not including, to. The hours are passed in from's zone.
+func (h *History) hourly(from, to time.Time, fn func(t time.Time, messages int)) {
+	fromKey := dayStart(from.UTC()).Format(bsDateFormat)
+	for _, a := range h.Daily {
+		if a.Start < fromKey {
+			continue
+		}
+		day, err := time.Parse(bsDateFormat, a.Start)
+		if err != nil {
+			continue
+		}
+		for hour, c := range a.Hourly {
+			t := day.Add(time.Duration(hour) * time.Hour).In(from.Location())
+			if c > 0 && !t.Before(from) && t.Before(to) {
+				fn(t, c)
+			}
+		}
+	}
+}
+
+// DailyTotals returns the messages sent on each of the last days, oldest
+// first, with the days in now's zone. Users aren't counted as they are only
+// kept by UTC day.
+func (h *History) DailyTotals(now time.Time, days int) []Summary {
+	totals := []Summary{}
+	from := dayStart(now).AddDate(0, 0, -(days - 1))
+	for day := from; len(totals) < days; day = day.AddDate(0, 0, 1) {
+		totals = append(totals, Summary{From: day, To: day.AddDate(0, 0, 1)})
+	}
+	h.hourly(from, totals[days-1].To, func(t time.Time, messages int) {
+		totals[daysBetween(from, t)].Messages += messages
+	})
+	return totals
+}
+
+// HourOfDay returns the average messages sent in each hour over the last
+// weeks, in now's zone.
+func (h *History) HourOfDay(now time.Time, weeks int) [24]float64 {
+	avg := [24]float64{}
+	to := dayStart(now).AddDate(0, 0, 1)
+	h.hourly(to.AddDate(0, 0, -7*weeks), to, func(t time.Time, messages int) {
+		avg[t.Hour()] += float64(messages)
+	})
+	for hour := range avg {
+		avg[hour] /= float64(7 * weeks)
+	}
+	return avg
+}
+
+// DayOfWeek returns the average messages sent on each day of the week, from
+// Monday, over the last weeks, in now's zone.
+func (h *History) DayOfWeek(now time.Time, weeks int) [7]float64 {
+	avg := [7]float64{}
+	to := dayStart(now).AddDate(0, 0, 1)
+	h.hourly(to.AddDate(0, 0, -7*weeks), to, func(t time.Time, messages int) {
+		avg[(int(t.Weekday())+6)%7] += float64(messages)
+	})
+	for day := range avg {
+		avg[day] /= float64(weeks)
+	}
+	return avg
+}
+
+// userOverlap counts the hours in the recorded days that only the first
+// user, both users or only the second user sent messages in.
+func (w *StatsPlugin) userOverlap(guildID string, first, second uint64) ([3]int, error) {
+	overlap := [3]int{}
+	stats, ok := w.GuildStats[guildID]
+	if !ok {
+		return overlap, errors.Errorf("Guild Stats not found for %s", guildID)
+	}
+	for _, part := range stats.Partitions() {
+		events, ok := stats.EventsByPrefix(part, string(bruxism.MessageTypeCreate))
+		if !ok {
+			continue
+		}
+		for _, event := range events {
+			vals, ok := stats.ValuesSet(part, event)
+			if !ok {
+				continue
+			}
+			a, b := vals.Contains(first), vals.Contains(second)
+			switch {
+			case a && b:
+				overlap[1]++
+			case a:
+				overlap[0]++
+			case b:
+				overlap[2]++
+			}
+		}
+	}
+	return overlap, nil
+}
+
+func plotLine(title string, labels []string, values []float64, opts chartOptions) (io.Reader, error) {
+	xys := make(plotter.XYs, len(values))
+	for i, v := range values {
+		xys[i] = plotter.XY{X: float64(i), Y: v}
+	}
+	pt := plot.New()
+	pt.Title.Text = title
+	pt.X.Tick.Marker = ticks(labels)
+	pt.Y.Min = 0
+	if err := plotutil.AddLinePoints(pt, xys); err != nil {
+		return nil, errors.Wrap(err, "unable to add line")
+	}
+	return render(pt, 10*vg.Inch, 5*vg.Inch, opts)
+}
+
+func plotBars(title string, labels []string, values []float64, opts chartOptions) (io.Reader, error) {
+	bars, err := plotter.NewBarChart(plotter.Values(values), vg.Points(20*float64(opts.Scale)))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create bars")
+	}
+	bars.Color = plotutil.Color(0)
+	bars.LineStyle.Width = 0
+	pt := plot.New()
+	pt.Title.Text = title
+	pt.Add(bars)
+	pt.NominalX(labels...)
+	return render(pt, 8*vg.Inch, 5*vg.Inch, opts)
+}
+
+// chart draws one of the charts other than the heatmap, with the days and
+// hours in loc.
+func (w *StatsPlugin) chart(guildID, chart string, weeks int, users [2]uint64, loc *time.Location, opts chartOptions) (io.Reader, error) {
+	w.Lock()
+	defer w.Unlock()
+
+	if chart == chartOverlap {
+		if users[0] == 0 || users[1] == 0 {
+			return nil, errors.New("the overlap chart needs user and user2")
+		}
+		overlap, err := w.userOverlap(guildID, users[0], users[1])
+		if err != nil {
+			return nil, err
+		}
+		return plotBars("Hours Active", []string{"First user only", "Both", "Second user only"}, []float64{float64(overlap[0]), float64(overlap[1]), float64(overlap[2])}, opts)
+	}
+
+	h, ok := w.History[guildID]
+	if !ok {
+		return nil, errors.New("no history for this server yet")
+	}
+	now := w.clock.Now().In(loc)
+	switch chart {
+	case chartDaily:
+		totals := h.DailyTotals(now, 7*weeks)
+		labels := make([]string, len(totals))
+		values := make([]float64, len(totals))
+		for i, t := range totals {
+			values[i] = float64(t.Messages)
+			if i%7 == 0 {
+				labels[i] = t.From.Format("2-Jan")
+			}
+		}
+		return plotLine("Messages per Day", labels, values, opts)
+	case chartHourly:
+		avg := h.HourOfDay(now, weeks)
+		return plotBars(fmt.Sprintf("Messages per Hour, %s", weeksText(weeks)), genHours(), avg[:], opts)
+	case chartWeekday:
+		avg := h.DayOfWeek(now, weeks)
+		return plotBars(fmt.Sprintf("Messages per Weekday, %s", weeksText(weeks)), []string{"Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"}, avg[:], opts)
+	}
+	return nil, errors.Errorf("unknown chart %s", chart)
+}
+
+func weeksText(weeks int) string {
+	if weeks == 1 {
+		return "last week"
+	}
+	return fmt.Sprintf("average of %d weeks", weeks)
+}
+
+// parseChartOptions reads the chart, weeks, size and format options.
+func parseChartOptions(chart string, weeks int64, size, format string) (string, int, chartOptions) {
+	if chart == "" {
+		chart = chartHeatmap
+	}
+	if weeks <= 0 {
+		weeks = defaultChartWeeks
+	}
+	if weeks > maxChartWeeks {
+		weeks = maxChartWeeks
+	}
+	opts := defaultChart
+	if scale, ok := chartSizes[size]; ok {
+		opts.Scale = scale
+	}
+	if strings.EqualFold(format, "svg") {
+		opts.Format = "svg"
+	}
+	return chart, int(weeks), opts
+}
@@ -0,0 +1,87 @@
+package statsplugin
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iopred/bruxism"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChartData(t *testing.T) {
+	now := time.Date(2022, time.November, 16, 9, 0, 0, 0, timeZone) // a Wednesday
+	h := &History{}
+	for day := 0; day < 28; day++ {
+		when := now.AddDate(0, 0, -day)
+		h.Add(time.Date(when.Year(), when.Month(), when.Day(), 10, 0, 0, 0, timeZone), 1, 2)
+		if when.Weekday() == time.Saturday {
+			h.Add(time.Date(when.Year(), when.Month(), when.Day(), 22, 0, 0, 0, timeZone), 1, 7)
+		}
+	}
+
+	totals := h.DailyTotals(now, 7)
+	assert.Equal(t, 7, len(totals))
+	assert.Equal(t, 2, totals[6].Messages)
+	assert.Equal(t, 9, totals[2].Messages, "saturday has the extra messages")
+
+	hourly := h.HourOfDay(now, 4)
+	assert.Equal(t, 2.0, hourly[10])
+	assert.Equal(t, 1.0, hourly[22])
+	assert.Equal(t, 0.0, hourly[3])
+
+	weekdays := h.DayOfWeek(now, 4)
+	assert.Equal(t, 2.0, weekdays[0])
+	assert.Equal(t, 9.0, weekdays[5])
+}
+
+func TestUserOverlap(t *testing.T) {
+	now := time.Date(2022, time.November, 16, 9, 0, 0, 0, timeZone)
+	w := newTestStatsPlugin(now)
+	w.recordMessage("g", "c", "1", bruxism.MessageTypeCreate)
+	w.recordMessage("g", "c", "2", bruxism.MessageTypeCreate)
+	w.clock = &fixedClock{now: now.Add(time.Hour)}
+	w.recordMessage("g", "c", "1", bruxism.MessageTypeCreate)
+	w.clock = &fixedClock{now: now.Add(2 * time.Hour)}
+	w.recordMessage("g", "c", "3", bruxism.MessageTypeCreate)
+
+	overlap, err := w.userOverlap("g", 1, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, [3]int{1, 1, 0}, overlap)
+
+	_, err = w.chart("g", chartOverlap, 1, [2]uint64{1, 0}, timeZone, defaultChart)
+	assert.NotNil(t, err, "the overlap chart needs two users")
+}
+
+func TestRenderFormats(t *testing.T) {
+	now := time.Date(2022, time.November, 16, 9, 0, 0, 0, timeZone)
+	w := newTestStatsPlugin(now)
+	w.History["g"] = &History{}
+	w.History["g"].Add(now, 1, 1)
+
+	for _, chart := range []string{chartDaily, chartHourly, chartWeekday} {
+		img, err := w.chart("g", chart, 2, [2]uint64{}, timeZone, defaultChart)
+		assert.Nil(t, err)
+		data, _ := io.ReadAll(img)
+		assert.Equal(t, "\x89PNG", string(data[:4]), chart)
+	}
+
+	_, _, opts := parseChartOptions("", 0, "large", "svg")
+	img, err := w.chart("g", chartDaily, 1, [2]uint64{}, timeZone, opts)
+	assert.Nil(t, err)
+	data, _ := io.ReadAll(img)
+	assert.True(t, strings.Contains(string(data[:200]), "<svg"))
+	assert.Equal(t, "activity_stats.svg", opts.fileName("activity_stats"))
+}
+
+func TestParseChartOptions(t *testing.T) {
+	chart, weeks, opts := parseChartOptions("", 0, "", "")
+	assert.Equal(t, chartHeatmap, chart)
+	assert.Equal(t, defaultChartWeeks, weeks)
+	assert.Equal(t, defaultChart, opts)
+
+	_, weeks, opts = parseChartOptions(chartHourly, 100, "small", "png")
+	assert.Equal(t, maxChartWeeks, weeks)
+	assert.Equal(t, 0.6, opts.Scale)
+}
@@ -0,0 +1,311 @@
+package statsplugin
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/dustin/go-humanize"
+	"github.com/pkg/errors"
+)
+
+// how often a digest is posted.
+const (
+	digestDaily  = "daily"
+	digestWeekly = "weekly"
+	digestOff    = "off"
+
+	defaultDigestHour = 9
+)
+
+// minDigestHour is a variable so the hour option can point to it.
+var minDigestHour = 0.0
+
+var digestWeekdays = map[string]time.Weekday{
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+	"sunday":    time.Sunday,
+}
+
+// A Digest posts a summary of the last day or week to a channel, at an hour
+// of the guild's time zone.
+type Digest struct {
+	ChannelID string
+	Frequency string
+	Hour      int
+	// Weekday is the day weekly digests are posted on.
+	Weekday time.Weekday
+	// LastSent is the date the digest was last posted on, in the guild's
+	// zone, so it isn't posted twice.
+	LastSent string
+}
+
+// due returns whether the digest should be posted at now, which is in the
+// guild's zone, and the date to remember it by.
+func (d *Digest) due(now time.Time) (bool, string) {
+	if d.ChannelID == "" || (d.Frequency != digestDaily && d.Frequency != digestWeekly) {
+		return false, ""
+	}
+	if d.Frequency == digestWeekly && now.Weekday() != d.Weekday {
+		return false, ""
+	}
+	key := now.Format(bsDateFormat)
+	if now.Hour() < d.Hour || d.LastSent == key {
+		return false, ""
+	}
+	return true, key
+}
+
+func (d *Digest) days() int {
+	if d.Frequency == digestWeekly {
+		return 7
+	}
+	return 1
+}
+
+// dueDigests returns the guilds whose digest should be posted at now, with
+// the date to mark them sent with once they are posted.
+func (w *StatsPlugin) dueDigests(now time.Time) map[string]string {
+	w.Lock()
+	guildIDs := []string{}
+	for guildID := range w.Digests {
+		guildIDs = append(guildIDs, guildID)
+	}
+	w.Unlock()
+
+	due := map[string]string{}
+	for _, guildID := range guildIDs {
+		local := now.In(w.zone(guildID))
+		w.Lock()
+		if d, ok := w.Digests[guildID]; ok {
+			if send, key := d.due(local); send {
+				due[guildID] = key
+			}
+		}
+		w.Unlock()
+	}
+	return due
+}
+
+// digestSent marks a guild's digest as posted on the date key, so it isn't
+// posted again that day.
+func (w *StatsPlugin) digestSent(guildID, key string) {
+	w.Lock()
+	defer w.Unlock()
+
+	if d, ok := w.Digests[guildID]; ok {
+		d.LastSent = key
+	}
+}
+
+// runDigests posts digests as they become due, one that fails to post is
+// tried again on the next tick.
+func (w *StatsPlugin) runDigests() {
+	for now := range time.Tick(1 * time.Minute) {
+		for guildID, key := range w.dueDigests(now) {
+			if err := w.postDigest(guildID); err != nil {
+				log.Printf("unable to post the stats digest for guild %s: %+v", guildID, err)
+				continue
+			}
+			w.digestSent(guildID, key)
+		}
+	}
+}
+
+func (w *StatsPlugin) postDigest(guildID string) error {
+	w.Lock()
+	d, ok := w.Digests[guildID]
+	if !ok {
+		w.Unlock()
+		return nil
+	}
+	channelID, days := d.ChannelID, d.days()
+	w.Unlock()
+
+	text, img, err := w.digestReport(guildID, days, w.clock.Now())
+	if err != nil {
+		return errors.Wrap(err, "unable to make the digest")
+	}
+	_, err = w.discord.Session.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content: text,
+		Files: []*discordgo.File{
+			{Name: defaultChart.fileName("activity_stats"), ContentType: defaultChart.contentType(), Reader: img},
+		},
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	return errors.Wrapf(err, "unable to post in %s", channelID)
+}
+
+// digestReport summarizes the last days before today in the guild's zone,
+// with the heatmap of the last week.
+func (w *StatsPlugin) digestReport(guildID string, days int, now time.Time) (string, io.Reader, error) {
+	loc := w.zone(guildID)
+	ranking := w.topChannels(guildID, topChannelsCount)
+
+	w.Lock()
+	defer w.Unlock()
+
+	h, ok := w.History[guildID]
+	if !ok {
+		return "", nil, errors.New("no history for this server yet")
+	}
+	recorder, ok := w.MessageStats[guildID]
+	if !ok {
+		return "", nil, errors.New("stats not found for guild")
+	}
+	end := dayStart(now.In(loc))
+	from := end.AddDate(0, 0, -days)
+
+	totals := h.DailyTotals(end.AddDate(0, 0, -1), 2*days)
+	prev, cur := 0, 0
+	for i, t := range totals {
+		if i < days {
+			prev += t.Messages
+		} else {
+			cur += t.Messages
+		}
+	}
+
+	hours := [24]int{}
+	h.hourly(from, end, func(t time.Time, messages int) {
+		hours[t.Hour()] += messages
+	})
+	busiestHour := 0
+	for hour, c := range hours {
+		if c > hours[busiestHour] {
+			busiestHour = hour
+		}
+	}
+
+	// active users are kept by UTC day, use the days with the same dates
+	year, month, day := end.AddDate(0, 0, -1).Date()
+	active := h.Active(time.Date(year, month, day, 12, 0, 0, 0, time.UTC), days)
+	last := active[len(active)-1]
+	activeUsers := fmt.Sprintf("Active users: %d that day, %d in the last 7 days (UTC days)", last.DAU, last.WAU)
+	if days > 1 {
+		dau := uint64(0)
+		for _, a := range active {
+			dau += a.DAU
+		}
+		activeUsers = fmt.Sprintf("Active users: %.1f a day on average, %d over the week (UTC days)", float64(dau)/float64(days), last.WAU)
+	}
+
+	title := fmt.Sprintf("**Daily stats digest** for %s", from.Format("Monday 2 Jan"))
+	previous := "the day before"
+	if days > 1 {
+		title = fmt.Sprintf("**Weekly stats digest** for %s to %s", from.Format("2 Jan"), end.AddDate(0, 0, -1).Format("2 Jan"))
+		previous = "the week before"
+	}
+	lines := []string{
+		title,
+		fmt.Sprintf("Messages: %s (%s vs %s)", humanize.Comma(int64(cur)), change(cur, prev), previous),
+	}
+	if cur > 0 {
+		busiest := fmt.Sprintf("Busiest hour: %02d:00", busiestHour)
+		if days > 1 {
+			busiestDay := totals[days]
+			for _, t := range totals[days:] {
+				if t.Messages > busiestDay.Messages {
+					busiestDay = t
+				}
+			}
+			busiest += ", busiest day: " + busiestDay.From.Format("Monday 2 Jan")
+		}
+		lines = append(lines, busiest)
+	}
+	lines = append(lines,
+		activeUsers,
+		channelRankingText(ranking),
+		fmt.Sprintf("_Times are in %s._", loc),
+	)
+
+	img, err := recorder.WeekMatrixIn(loc).Render(defaultChart)
+	if err != nil {
+		return "", nil, err
+	}
+	return strings.Join(lines, "\n"), img, nil
+}
+
+func (w *StatsPlugin) digestText(guildID string) string {
+	loc := w.zone(guildID)
+
+	w.Lock()
+	defer w.Unlock()
+	d, ok := w.Digests[guildID]
+	if !ok || d.ChannelID == "" || d.Frequency == digestOff || d.Frequency == "" {
+		return "No stats digest is posted on this server."
+	}
+	when := "every day"
+	if d.Frequency == digestWeekly {
+		when = "every " + d.Weekday.String()
+	}
+	return fmt.Sprintf("A %s stats digest is posted in <#%s> %s at %02d:00 %s.", d.Frequency, d.ChannelID, when, d.Hour, loc)
+}
+
+// handleDigestCommand shows the guild's digest, admins can change it or
+// preview it.
+func (w *StatsPlugin) handleDigestCommand(s *discordgo.Session, i *discordgo.InteractionCreate, userID string, options []*discordgo.ApplicationCommandInteractionDataOption) {
+	if len(options) > 0 && !isAdmin(i) && userID != w.discord.OwnerUserID {
+		log.Printf("unauthorized user: '%s' tried to change the stats digest on guild: '%s'", userID, i.GuildID)
+		w.respondEphemeral(s, i, "You need the Manage Server permission to change the stats digest.")
+		return
+	}
+
+	preview := false
+	w.Lock()
+	d, ok := w.Digests[i.GuildID]
+	if !ok {
+		d = &Digest{Frequency: digestWeekly, Hour: defaultDigestHour, Weekday: time.Monday}
+	}
+	for _, opt := range options {
+		switch opt.Name {
+		case "channel":
+			d.ChannelID = opt.ChannelValue(nil).ID
+		case "frequency":
+			d.Frequency = opt.StringValue()
+		case "hour":
+			d.Hour = int(opt.IntValue())
+		case "weekday":
+			if day, ok := digestWeekdays[opt.StringValue()]; ok {
+				d.Weekday = day
+			}
+		case "preview":
+			preview = opt.BoolValue()
+		}
+	}
+	if d.ChannelID != "" {
+		w.Digests[i.GuildID] = d
+	}
+	days := d.days()
+	w.Unlock()
+
+	if !preview {
+		w.respondEphemeral(s, i, w.digestText(i.GuildID))
+		return
+	}
+	text, img, err := w.digestReport(i.GuildID, days, w.clock.Now())
+	if err != nil {
+		w.respondEphemeral(s, i, "unable to make the stats digest: "+err.Error())
+		return
+	}
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: text,
+			Files: []*discordgo.File{
+				{Name: defaultChart.fileName("activity_stats"), ContentType: defaultChart.contentType(), Reader: img},
+			},
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Print("unable to respond")
+	}
+}
@@ -0,0 +1,93 @@
+package statsplugin
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDigestDue(t *testing.T) {
+	monday := time.Date(2022, time.November, 14, 9, 5, 0, 0, time.UTC)
+	weekly := Digest{ChannelID: "c", Frequency: digestWeekly, Hour: 9, Weekday: time.Monday}
+	daily := Digest{ChannelID: "c", Frequency: digestDaily, Hour: 18}
+
+	tests := []struct {
+		name   string
+		digest Digest
+		now    time.Time
+		want   bool
+	}{
+		{"weekly on the hour", weekly, monday, true},
+		{"weekly later that day", weekly, monday.Add(5 * time.Hour), true},
+		{"weekly before the hour", weekly, monday.Add(-time.Hour), false},
+		{"weekly on another day", weekly, monday.AddDate(0, 0, 1), false},
+		{"weekly already sent", Digest{ChannelID: "c", Frequency: digestWeekly, Hour: 9, Weekday: time.Monday, LastSent: "2022-11-14"}, monday, false},
+		{"daily before the hour", daily, monday, false},
+		{"daily on the hour", daily, monday.Add(9 * time.Hour), true},
+		{"off", Digest{ChannelID: "c", Frequency: digestOff}, monday, false},
+		{"no channel", Digest{Frequency: digestDaily}, monday, false},
+	}
+	for _, tt := range tests {
+		due, _ := tt.digest.due(tt.now)
+		assert.Equal(t, tt.want, due, tt.name)
+	}
+}
+
+func TestDueDigests(t *testing.T) {
+	w := newTestStatsPlugin(dayAfterDST)
+	w.TimeZones = map[string]string{"berlin": "Europe/Berlin"}
+	w.Digests = map[string]*Digest{
+		"berlin":    {ChannelID: "c", Frequency: digestWeekly, Hour: 9, Weekday: time.Monday},
+		"vancouver": {ChannelID: "c", Frequency: digestWeekly, Hour: 9, Weekday: time.Monday},
+	}
+
+	monday := time.Date(2022, time.November, 14, 7, 30, 0, 0, time.UTC)
+	assert.Empty(t, w.dueDigests(monday), "08:30 in Berlin")
+	assert.Equal(t, map[string]string{"berlin": "2022-11-14"}, w.dueDigests(monday.Add(30*time.Minute)))
+	assert.Equal(t, map[string]string{"berlin": "2022-11-14"}, w.dueDigests(monday.Add(31*time.Minute)), "digests that failed to post are tried again")
+	w.digestSent("berlin", "2022-11-14")
+	assert.Empty(t, w.dueDigests(monday.Add(time.Hour)), "digests are only posted once")
+	assert.Equal(t, "2022-11-14", w.Digests["berlin"].LastSent)
+	assert.Equal(t, map[string]string{"vancouver": "2022-11-14"}, w.dueDigests(monday.Add(10*time.Hour)))
+}
+
+func TestDigestReport(t *testing.T) {
+	now := time.Date(2022, time.November, 14, 9, 0, 0, 0, timeZone) // a Monday
+	w := newTestStatsPlugin(now)
+	h := &History{}
+	w.History["g"] = h
+	w.MessageStats["g"] = NewStatsRecorder(w.clock, 10)
+
+	// the week before last had 10 messages, last week 15, mostly on Friday
+	h.Add(time.Date(2022, time.November, 1, 12, 0, 0, 0, timeZone), 1, 10)
+	h.Add(time.Date(2022, time.November, 9, 20, 0, 0, 0, timeZone), 1, 5)
+	h.Add(time.Date(2022, time.November, 11, 20, 0, 0, 0, timeZone), 2, 10)
+	h.Add(now, 3, 100)
+	w.ChannelStats["g"] = map[string]*StatsRecorder{"general": NewStatsRecorder(w.clock, 10)}
+	for i := 0; i < 3; i++ {
+		w.recordChannelMessage("g", "general", now)
+	}
+
+	text, img, err := w.digestReport("g", 7, now)
+	assert.Nil(t, err)
+	lines := strings.Split(text, "\n")
+	assert.Equal(t, "**Weekly stats digest** for 7 Nov to 13 Nov", lines[0])
+	assert.Equal(t, "Messages: 15 (+50% vs the week before)", lines[1])
+	assert.Equal(t, "Busiest hour: 20:00, busiest day: Friday 11 Nov", lines[2])
+	// two users on different days of the week
+	assert.Equal(t, "Active users: 0.3 a day on average, 2 over the week (UTC days)", lines[3])
+	assert.Contains(t, text, "1. <#general> 3 messages")
+	assert.Contains(t, text, "America/Vancouver")
+	data, _ := io.ReadAll(img)
+	assert.Equal(t, "\x89PNG", string(data[:4]))
+
+	text, _, err = w.digestReport("g", 1, now)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(text, "**Daily stats digest** for Sunday 13 Nov\nMessages: 0 (no change vs the day before)\nActive users: 0 that day, 2 in the last 7 days (UTC days)"))
+
+	_, _, err = w.digestReport("other", 7, now)
+	assert.NotNil(t, err)
+}
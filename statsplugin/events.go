@@ -0,0 +1,162 @@
+package statsplugin
+
+import (
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/iopred/bruxism"
+	"github.com/pkg/errors"
+)
+
+// event types recorded besides the bruxism message types. Each is recorded
+// as its own prefix, followed by the hour.
+const (
+	eventMessage  = string(bruxism.MessageTypeCreate)
+	eventReaction = "reaction"
+	eventVoice    = "voice"
+	eventJoin     = "join"
+	eventLeave    = "leave"
+	eventThread   = "thread"
+)
+
+// eventTitles names the events /stats can plot.
+var eventTitles = map[string]string{
+	eventMessage:  "Messages",
+	eventReaction: "Reactions",
+	eventVoice:    "Time in Voice",
+	eventJoin:     "Members Joining",
+	eventLeave:    "Members Leaving",
+	eventThread:   "Threads",
+}
+
+// maxVoiceSession is how much of a voice session is recorded, older hours
+// would be outside of the heatmap anyway.
+const maxVoiceSession = 7 * 24 * time.Hour
+
+// A voiceSession is when a user joined the voice channel they are in. They
+// are only kept in memory, sessions open during a restart are not recorded.
+type voiceSession struct {
+	ChannelID string
+	Start     time.Time
+}
+
+func (w *StatsPlugin) reactionAdd(s *discordgo.Session, evt *discordgo.MessageReactionAdd) {
+	if evt.MessageReaction == nil || evt.GuildID == "" {
+		return
+	}
+	w.recordEvent(evt.GuildID, evt.ChannelID, evt.UserID, eventReaction, w.clock.Now())
+}
+
+func (w *StatsPlugin) memberAdd(s *discordgo.Session, evt *discordgo.GuildMemberAdd) {
+	if evt.Member == nil || evt.User == nil {
+		return
+	}
+	w.recordEvent(evt.GuildID, "", evt.User.ID, eventJoin, w.clock.Now())
+}
+
+func (w *StatsPlugin) memberRemove(s *discordgo.Session, evt *discordgo.GuildMemberRemove) {
+	if evt.Member == nil || evt.User == nil {
+		return
+	}
+	w.recordEvent(evt.GuildID, "", evt.User.ID, eventLeave, w.clock.Now())
+}
+
+// threadCreate records new threads by who started them, in the channel they
+// were started from.
+func (w *StatsPlugin) threadCreate(s *discordgo.Session, evt *discordgo.ThreadCreate) {
+	if evt.Channel == nil || !evt.NewlyCreated {
+		return
+	}
+	w.recordEvent(evt.GuildID, evt.ParentID, evt.OwnerID, eventThread, w.clock.Now())
+}
+
+// voiceStateUpdate records a voice session once the user leaves or moves to
+// another channel, mute and deafen changes keep the session going.
+func (w *StatsPlugin) voiceStateUpdate(s *discordgo.Session, evt *discordgo.VoiceStateUpdate) {
+	if evt.VoiceState == nil || evt.GuildID == "" {
+		return
+	}
+	now := w.clock.Now()
+	key := evt.GuildID + ":" + evt.UserID
+
+	w.Lock()
+	session, ok := w.voiceSessions[key]
+	if ok && session.ChannelID == evt.ChannelID {
+		w.Unlock()
+		return
+	}
+	if evt.ChannelID == "" {
+		delete(w.voiceSessions, key)
+	} else {
+		w.voiceSessions[key] = &voiceSession{ChannelID: evt.ChannelID, Start: now}
+	}
+	w.Unlock()
+
+	if ok {
+		w.recordVoice(evt.GuildID, session.ChannelID, evt.UserID, session.Start, now)
+	}
+}
+
+// recordVoice adds the minutes the user spent in voice to every hour from
+// start to end, and marks the user in voice in those hours.
+func (w *StatsPlugin) recordVoice(guildID, channelID, userID string, start, end time.Time) {
+	if end.Sub(start) > maxVoiceSession {
+		start = end.Add(-maxVoiceSession)
+	}
+	for t := start.Truncate(time.Hour); !t.After(end); t = t.Add(time.Hour) {
+		w.recordEvent(guildID, channelID, userID, eventVoice, t.In(end.Location()))
+		from, to := t, t.Add(time.Hour)
+		if from.Before(start) {
+			from = start
+		}
+		if to.After(end) {
+			to = end
+		}
+		w.recordVoiceMinutes(guildID, channelID, from, int(to.Sub(from)/time.Minute))
+	}
+}
+
+// recordVoiceMinutes adds minutes spent in voice to the hour t is in, in the
+// guild and in the channel.
+func (w *StatsPlugin) recordVoiceMinutes(guildID, channelID string, t time.Time, minutes int) {
+	if minutes <= 0 {
+		return
+	}
+	w.Lock()
+	defer w.Unlock()
+
+	s, ok := w.VoiceMinutes[guildID]
+	if !ok {
+		s = NewStatsRecorder(localClock(time.UTC), 10)
+		w.VoiceMinutes[guildID] = s
+	}
+	s.add(t, minutes)
+
+	channels, ok := w.ChannelVoiceMinutes[guildID]
+	if !ok {
+		channels = map[string]*StatsRecorder{}
+		w.ChannelVoiceMinutes[guildID] = channels
+	}
+	s, ok = channels[channelID]
+	if !ok {
+		s = NewStatsRecorder(localClock(time.UTC), 10)
+		channels[channelID] = s
+	}
+	s.add(t, minutes)
+}
+
+// voiceMatrix is the weekly heatmap of minutes spent in voice, in the guild
+// or in a channel when channelID is set, in loc.
+func (w *StatsPlugin) voiceMatrix(guildID, channelID string, loc *time.Location) (*WeekMsgCountMatrix, error) {
+	w.Lock()
+	defer w.Unlock()
+
+	s, ok := w.VoiceMinutes[guildID]
+	if channelID != "" {
+		s, ok = w.ChannelVoiceMinutes[guildID][channelID]
+	}
+	if !ok {
+		return nil, errors.New("no time in voice has been recorded")
+	}
+	return s.WeekMatrixIn(loc), nil
+}
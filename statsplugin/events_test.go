@@ -0,0 +1,101 @@
+package statsplugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RoaringBitmap/roaring/roaring64"
+	"github.com/bwmarrin/discordgo"
+	"github.com/iopred/bruxism"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventTypes(t *testing.T) {
+	now := time.Date(2022, time.November, 16, 9, 30, 0, 0, timeZone)
+	w := newTestStatsPlugin(now)
+	count := func(b *roaring64.Bitmap) int { return int(b.GetCardinality()) }
+
+	w.recordMessage("g", "c", "1", bruxism.MessageTypeCreate)
+	w.reactionAdd(nil, &discordgo.MessageReactionAdd{MessageReaction: &discordgo.MessageReaction{UserID: "1", ChannelID: "c", GuildID: "g"}})
+	w.reactionAdd(nil, &discordgo.MessageReactionAdd{MessageReaction: &discordgo.MessageReaction{UserID: "2", ChannelID: "c", GuildID: "g"}})
+	w.memberAdd(nil, &discordgo.GuildMemberAdd{Member: &discordgo.Member{GuildID: "g", User: &discordgo.User{ID: "3"}}})
+	w.memberRemove(nil, &discordgo.GuildMemberRemove{Member: &discordgo.Member{GuildID: "g", User: &discordgo.User{ID: "4"}}})
+	w.threadCreate(nil, &discordgo.ThreadCreate{Channel: &discordgo.Channel{GuildID: "g", ParentID: "c", OwnerID: "1"}, NewlyCreated: true})
+	w.threadCreate(nil, &discordgo.ThreadCreate{Channel: &discordgo.Channel{GuildID: "g", ParentID: "c", OwnerID: "2"}})
+
+	expected := map[string]int{
+		eventMessage:  1,
+		eventReaction: 2,
+		eventJoin:     1,
+		eventLeave:    1,
+		eventThread:   1,
+		eventVoice:    0,
+	}
+	for event, users := range expected {
+		matrix, err := w.statsToMatrix("g", event, timeZone, count)
+		assert.Nil(t, err)
+		assert.Equal(t, users, matrix.matrix[6][9], event)
+	}
+
+	matrix, err := w.statsToMatrix("g", channelEventPrefix("c", eventReaction), timeZone, count)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, matrix.matrix[6][9])
+}
+
+func TestVoiceSessions(t *testing.T) {
+	start := time.Date(2022, time.November, 16, 9, 30, 0, 0, timeZone)
+	clock := &fixedClock{now: start}
+	w := newTestStatsPlugin(start)
+	w.clock = clock
+	w.VoiceMinutes["g"] = NewStatsRecorder(clock, 10)
+	w.ChannelVoiceMinutes["g"] = map[string]*StatsRecorder{"lounge": NewStatsRecorder(clock, 10)}
+	voice := func(channelID string, selfMute bool) {
+		w.voiceStateUpdate(nil, &discordgo.VoiceStateUpdate{VoiceState: &discordgo.VoiceState{GuildID: "g", UserID: "1", ChannelID: channelID, SelfMute: selfMute}})
+	}
+	count := func(b *roaring64.Bitmap) int { return int(b.GetCardinality()) }
+
+	voice("lounge", false)
+	clock.now = start.Add(time.Hour)
+	voice("lounge", true)
+	assert.Equal(t, 1, len(w.voiceSessions), "muting keeps the session going")
+	_, err := w.statsToMatrix("g", eventVoice, timeZone, count)
+	assert.NotNil(t, err, "nothing is recorded until the session ends")
+
+	clock.now = start.Add(2 * time.Hour)
+	voice("games", false)
+	clock.now = start.Add(3 * time.Hour)
+	voice("", false)
+	assert.Empty(t, w.voiceSessions)
+
+	matrix, err := w.statsToMatrix("g", eventVoice, timeZone, count)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{0, 1, 1, 1, 1, 0}, matrix.matrix[6][8:14])
+
+	lounge, err := w.statsToMatrix("g", channelEventPrefix("lounge", eventVoice), timeZone, count)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{0, 1, 1, 1, 0, 0}, lounge.matrix[6][8:14])
+
+	minutes, err := w.voiceMatrix("g", "", timeZone)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{0, 30, 60, 60, 30, 0}, minutes.matrix[6][8:14])
+	minutes, err = w.voiceMatrix("g", "lounge", timeZone)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{0, 30, 60, 30, 0, 0}, minutes.matrix[6][8:14])
+}
+
+func TestVoiceSessionOverMidnight(t *testing.T) {
+	evening := time.Date(2022, time.November, 15, 23, 30, 0, 0, timeZone)
+	clock := &fixedClock{now: evening.Add(2 * time.Hour)}
+	w := newTestStatsPlugin(clock.now)
+	w.clock = clock
+	w.VoiceMinutes["g"] = NewStatsRecorder(clock, 10)
+	w.VoiceMinutes["g"].Increment(evening.Add(-time.Hour))
+	w.VoiceMinutes["g"].Increment(clock.now)
+
+	w.recordVoice("g", "lounge", "1", evening, clock.now)
+
+	minutes, err := w.voiceMatrix("g", "", timeZone)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 30}, minutes.matrix[5][22:24], "the evening stays on its day")
+	assert.Equal(t, []int{60, 31}, minutes.matrix[6][0:2])
+}
@@ -0,0 +1,214 @@
+package statsplugin
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/iopred/bruxism"
+	"github.com/pkg/errors"
+)
+
+const (
+	exportCSV  = "csv"
+	exportJSON = "json"
+
+	defaultExportDays = 7
+	// maxExportDays is as far back as the hourly stats go.
+	maxExportDays = 10
+)
+
+// minExportDays is a variable so the period option can point to it.
+var minExportDays = 1.0
+
+// An exportRow is the activity in one hour of a day.
+type exportRow struct {
+	Date     string   `json:"date"`
+	Hour     int      `json:"hour"`
+	Messages int      `json:"messages"`
+	Users    uint64   `json:"users"`
+	UserIDs  []uint64 `json:"user_ids,omitempty"`
+}
+
+type statsExport struct {
+	GuildID string       `json:"guild_id"`
+	From    string       `json:"from"`
+	To      string       `json:"to"`
+	Hours   []*exportRow `json:"hours"`
+}
+
+// export collects the hourly message counts and unique users of the last
+// days in UTC, including today up to the current hour.
+func (w *StatsPlugin) export(guildID string, days int, userIDs bool) (*statsExport, error) {
+	w.Lock()
+	defer w.Unlock()
+
+	recorder, ok := w.MessageStats[guildID]
+	if !ok {
+		return nil, errors.New("stats not found for guild")
+	}
+	now := w.clock.Now().UTC()
+	first := dayStart(now).AddDate(0, 0, -(days - 1))
+	ex := &statsExport{
+		GuildID: guildID,
+		From:    first.Format(bsDateFormat),
+		To:      now.Format(bsDateFormat),
+		Hours:   []*exportRow{},
+	}
+	rows := map[string]*[24]*exportRow{}
+	for day := first; !day.After(now); day = day.AddDate(0, 0, 1) {
+		key := day.Format(bsDateFormat)
+		hours := [24]*exportRow{}
+		for hour := range hours {
+			if key == ex.To && hour > now.Hour() {
+				break
+			}
+			hours[hour] = &exportRow{Date: key, Hour: hour}
+			ex.Hours = append(ex.Hours, hours[hour])
+		}
+		rows[key] = &hours
+	}
+
+	if recorder.dayBuckets != nil {
+		recorder.dayBuckets.Do(func(v interface{}) {
+			b, ok := v.(*dayBucket)
+			if !ok {
+				return
+			}
+			year, month, day := b.End.Date()
+			for hour, count := range b.Hourly {
+				t := time.Date(year, month, day, hour, 0, 0, 0, b.End.Location()).UTC()
+				if hours, ok := rows[t.Format(bsDateFormat)]; ok && hours[t.Hour()] != nil {
+					hours[t.Hour()].Messages += count
+				}
+			}
+		})
+	}
+
+	if stats, ok := w.GuildStats[guildID]; ok {
+		for _, part := range stats.Partitions() {
+			hours, ok := rows[part]
+			if !ok {
+				continue
+			}
+			events, ok := stats.EventsByPrefix(part, string(bruxism.MessageTypeCreate))
+			if !ok {
+				continue
+			}
+			for _, event := range events {
+				hour, err := eventHour(event)
+				if err != nil || hours[hour] == nil {
+					continue
+				}
+				vals, ok := stats.ValuesSet(part, event)
+				if !ok {
+					continue
+				}
+				hours[hour].Users = vals.GetCardinality()
+				if userIDs {
+					hours[hour].UserIDs = vals.ToArray()
+				}
+			}
+		}
+	}
+	return ex, nil
+}
+
+func (ex *statsExport) csv(userIDs bool) ([]byte, error) {
+	buf := bytes.Buffer{}
+	out := csv.NewWriter(&buf)
+	header := []string{"date", "hour", "messages", "users"}
+	if userIDs {
+		header = append(header, "user_ids")
+	}
+	records := [][]string{header}
+	for _, row := range ex.Hours {
+		record := []string{row.Date, strconv.Itoa(row.Hour), strconv.Itoa(row.Messages), strconv.FormatUint(row.Users, 10)}
+		if userIDs {
+			ids := make([]string, len(row.UserIDs))
+			for i, id := range row.UserIDs {
+				ids[i] = strconv.FormatUint(id, 10)
+			}
+			record = append(record, strings.Join(ids, " "))
+		}
+		records = append(records, record)
+	}
+	if err := out.WriteAll(records); err != nil {
+		return nil, errors.Wrap(err, "unable to write csv")
+	}
+	return buf.Bytes(), nil
+}
+
+// encode writes the export as csv or json, returning the file name and
+// content type to attach it with.
+func (ex *statsExport) encode(format string, userIDs bool) ([]byte, string, string, error) {
+	name := fmt.Sprintf("stats_%s_%s", ex.From, ex.To)
+	if format == exportJSON {
+		data, err := json.MarshalIndent(ex, "", "  ")
+		if err != nil {
+			return nil, "", "", errors.Wrap(err, "unable to write json")
+		}
+		return data, name + ".json", "application/json", nil
+	}
+	data, err := ex.csv(userIDs)
+	return data, name + ".csv", "text/csv", err
+}
+
+func (w *StatsPlugin) handleExportCommand(s *discordgo.Session, i *discordgo.InteractionCreate, userID string, options []*discordgo.ApplicationCommandInteractionDataOption) {
+	format := exportCSV
+	days := defaultExportDays
+	userIDs := false
+	for _, opt := range options {
+		switch opt.Name {
+		case "format":
+			format = opt.StringValue()
+		case "period":
+			days = int(opt.IntValue())
+		case "user_ids":
+			userIDs = opt.BoolValue()
+		}
+	}
+	if days < 1 {
+		days = 1
+	}
+	if days > maxExportDays {
+		days = maxExportDays
+	}
+	if userIDs && userID != w.discord.OwnerUserID {
+		log.Printf("user: '%s' asked for user ids in an export on guild: '%s'", userID, i.GuildID)
+		w.respondEphemeral(s, i, "Only the bot owner can export user ids.")
+		return
+	}
+
+	ex, err := w.export(i.GuildID, days, userIDs)
+	if err != nil {
+		w.respondEphemeral(s, i, "unable to export stats: "+err.Error())
+		return
+	}
+	data, name, contentType, err := ex.encode(format, userIDs)
+	if err != nil {
+		w.respondEphemeral(s, i, "unable to export stats: "+err.Error())
+		return
+	}
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: fmt.Sprintf("Hourly stats in UTC from %s to %s", ex.From, ex.To),
+			Files: []*discordgo.File{
+				{Name: name, ContentType: contentType, Reader: bytes.NewReader(data)},
+			},
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Print("unable to respond")
+	} else {
+		log.Print("successfully responded to stats export")
+	}
+}
@@ -0,0 +1,52 @@
+package statsplugin
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iopred/bruxism"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExport(t *testing.T) {
+	now := time.Date(2022, time.November, 16, 9, 30, 0, 0, timeZone)
+	w := newTestStatsPlugin(now)
+	for _, userID := range []string{"1", "2", "1"} {
+		w.recordMessage("g", "c", userID, bruxism.MessageTypeCreate)
+		w.guildStats("g").Increment(now)
+	}
+
+	_, err := w.export("unknown", 1, false)
+	assert.NotNil(t, err)
+
+	ex, err := w.export("g", 2, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "2022-11-15", ex.From)
+	assert.Equal(t, 24+18, len(ex.Hours), "today only goes up to the current hour in UTC")
+	last := ex.Hours[len(ex.Hours)-1]
+	assert.Equal(t, exportRow{Date: "2022-11-16", Hour: 17, Messages: 3, Users: 2}, *last)
+
+	data, name, contentType, err := ex.encode(exportCSV, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "stats_2022-11-15_2022-11-16.csv", name)
+	assert.Equal(t, "text/csv", contentType)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Equal(t, "date,hour,messages,users", lines[0])
+	assert.Equal(t, "2022-11-16,17,3,2", lines[len(lines)-1])
+
+	ex, err = w.export("g", 1, true)
+	assert.Nil(t, err)
+	data, _, _, err = ex.encode(exportCSV, true)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(strings.TrimSpace(string(data)), "2022-11-16,17,3,2,1 2"))
+
+	data, name, _, err = ex.encode(exportJSON, true)
+	assert.Nil(t, err)
+	assert.Equal(t, "stats_2022-11-16_2022-11-16.json", name)
+	decoded := statsExport{}
+	assert.Nil(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, []uint64{1, 2}, decoded.Hours[17].UserIDs)
+	assert.Nil(t, decoded.Hours[0].UserIDs)
+}
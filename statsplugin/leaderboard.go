@@ -0,0 +1,216 @@
+package statsplugin
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/dustin/go-humanize"
+)
+
+const (
+	// memberRetention is how many days of member message counts are kept.
+	memberRetention = 90
+	topMembersCount = 10
+
+	periodToday  = "today"
+	period90Days = "90d"
+)
+
+var leaderboardDays = map[string]int{
+	periodToday:  1,
+	periodWeek:   7,
+	period30Days: 30,
+	period90Days: 90,
+}
+
+// A MemberDay is how many messages each member sent on a day, in the guild
+// and in each channel.
+type MemberDay struct {
+	Day      string
+	Users    map[string]int
+	Channels map[string]map[string]int
+}
+
+type memberCount struct {
+	UserID   string
+	Messages int
+}
+
+func (w *StatsPlugin) optedOut(guildID, userID string) bool {
+	return w.LeaderboardOptOut[guildID][userID]
+}
+
+// recordMemberMessage counts a message for the leaderboard, unless the user
+// opted out of it.
+func (w *StatsPlugin) recordMemberMessage(guildID, channelID, userID string, t time.Time) {
+	if guildID == "" || userID == "" {
+		return
+	}
+	w.Lock()
+	defer w.Unlock()
+
+	if w.optedOut(guildID, userID) {
+		return
+	}
+	days := w.MemberCounts[guildID]
+	key := dayStart(t).Format(bsDateFormat)
+	i := sort.Search(len(days), func(i int) bool { return days[i].Day >= key })
+	if i == len(days) || days[i].Day != key {
+		days = append(days, nil)
+		copy(days[i+1:], days[i:])
+		days[i] = &MemberDay{Day: key, Users: map[string]int{}, Channels: map[string]map[string]int{}}
+	}
+	day := days[i]
+	day.Users[userID]++
+	if channelID != "" {
+		if day.Channels[channelID] == nil {
+			day.Channels[channelID] = map[string]int{}
+		}
+		day.Channels[channelID][userID]++
+	}
+	if len(days) > memberRetention {
+		days = days[len(days)-memberRetention:]
+	}
+	w.MemberCounts[guildID] = days
+}
+
+// topMembers ranks the members of a guild, or of one of its channels, by the
+// messages they sent over the last days.
+func (w *StatsPlugin) topMembers(guildID, channelID string, days, n int) []memberCount {
+	w.Lock()
+	defer w.Unlock()
+
+	from := dayStart(w.clock.Now()).AddDate(0, 0, -(days - 1)).Format(bsDateFormat)
+	totals := map[string]int{}
+	for _, day := range w.MemberCounts[guildID] {
+		if day.Day < from {
+			continue
+		}
+		counts := day.Users
+		if channelID != "" {
+			counts = day.Channels[channelID]
+		}
+		for userID, c := range counts {
+			totals[userID] += c
+		}
+	}
+
+	ranking := []memberCount{}
+	for userID, c := range totals {
+		if !w.optedOut(guildID, userID) {
+			ranking = append(ranking, memberCount{UserID: userID, Messages: c})
+		}
+	}
+	sort.Slice(ranking, func(i, j int) bool {
+		if ranking[i].Messages != ranking[j].Messages {
+			return ranking[i].Messages > ranking[j].Messages
+		}
+		return ranking[i].UserID < ranking[j].UserID
+	})
+	if len(ranking) > n {
+		ranking = ranking[:n]
+	}
+	return ranking
+}
+
+// setLeaderboardOptOut hides a member from the leaderboard and forgets their
+// counts, or starts counting them again.
+func (w *StatsPlugin) setLeaderboardOptOut(guildID, userID string, optOut bool) {
+	w.Lock()
+	defer w.Unlock()
+
+	if !optOut {
+		delete(w.LeaderboardOptOut[guildID], userID)
+		return
+	}
+	if w.LeaderboardOptOut[guildID] == nil {
+		w.LeaderboardOptOut[guildID] = map[string]bool{}
+	}
+	w.LeaderboardOptOut[guildID][userID] = true
+	for _, day := range w.MemberCounts[guildID] {
+		delete(day.Users, userID)
+		for _, counts := range day.Channels {
+			delete(counts, userID)
+		}
+	}
+}
+
+func leaderboardText(ranking []memberCount, days int, channelID string) string {
+	where := ""
+	if channelID != "" {
+		where = fmt.Sprintf(" in <#%s>", channelID)
+	}
+	when := "today"
+	if days > 1 {
+		when = fmt.Sprintf("in the last %d days", days)
+	}
+	if len(ranking) == 0 {
+		return fmt.Sprintf("Nobody has sent messages%s %s.", where, when)
+	}
+	lines := []string{fmt.Sprintf("Most active members%s %s:", where, when)}
+	for i, m := range ranking {
+		lines = append(lines, fmt.Sprintf("%d. <@%s> %s messages", i+1, m.UserID, humanize.Comma(int64(m.Messages))))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (w *StatsPlugin) handleTopCommand(s *discordgo.Session, i *discordgo.InteractionCreate, userID string, options []*discordgo.ApplicationCommandInteractionDataOption) {
+	days := leaderboardDays[periodWeek]
+	channelID := ""
+	for _, opt := range options {
+		switch opt.Name {
+		case "period":
+			if d, ok := leaderboardDays[opt.StringValue()]; ok {
+				days = d
+			}
+		case "channel":
+			channelID = opt.ChannelValue(nil).ID
+		}
+	}
+
+	text := leaderboardText(w.topMembers(i.GuildID, channelID, days, topMembersCount), days, channelID)
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content:         text,
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		},
+	})
+	if err != nil {
+		log.Print("unable to respond")
+	} else {
+		log.Print("successfully responded to stats")
+	}
+}
+
+func (w *StatsPlugin) handleOptOutCommand(s *discordgo.Session, i *discordgo.InteractionCreate, userID string, options []*discordgo.ApplicationCommandInteractionDataOption) {
+	optOut := true
+	for _, opt := range options {
+		if opt.Name == "hidden" {
+			optOut = opt.BoolValue()
+		}
+	}
+	w.setLeaderboardOptOut(i.GuildID, userID, optOut)
+	if optOut {
+		w.respondEphemeral(s, i, "You're hidden from the leaderboard and your message counts were removed.")
+		return
+	}
+	w.respondEphemeral(s, i, "You'll show up on the leaderboard again.")
+}
+
+func (w *StatsPlugin) respondEphemeral(s *discordgo.Session, i *discordgo.InteractionCreate, msg string) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: msg,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Print("unable to respond")
+	}
+}
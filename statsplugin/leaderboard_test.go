@@ -0,0 +1,64 @@
+package statsplugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopMembers(t *testing.T) {
+	now := time.Date(2022, time.November, 16, 9, 0, 0, 0, timeZone)
+	w := newTestStatsPlugin(now)
+
+	messages := []struct {
+		daysAgo   int
+		channelID string
+		userID    string
+		count     int
+	}{
+		{0, "general", "1", 3},
+		{0, "general", "2", 5},
+		{0, "memes", "1", 4},
+		{3, "general", "3", 10},
+		{40, "general", "2", 50},
+	}
+	for _, m := range messages {
+		for i := 0; i < m.count; i++ {
+			w.recordMemberMessage("g", m.channelID, m.userID, now.AddDate(0, 0, -m.daysAgo))
+		}
+	}
+
+	assert.Equal(t, []memberCount{{"1", 7}, {"2", 5}}, w.topMembers("g", "", 1, 10))
+	assert.Equal(t, []memberCount{{"3", 10}, {"1", 7}}, w.topMembers("g", "", 7, 2))
+	assert.Equal(t, []memberCount{{"2", 55}, {"3", 10}, {"1", 7}}, w.topMembers("g", "", 90, 10))
+	assert.Equal(t, []memberCount{{"2", 5}, {"1", 3}}, w.topMembers("g", "general", 1, 10))
+	assert.Empty(t, w.topMembers("other", "", 90, 10))
+}
+
+func TestLeaderboardOptOut(t *testing.T) {
+	now := time.Date(2022, time.November, 16, 9, 0, 0, 0, timeZone)
+	w := newTestStatsPlugin(now)
+
+	w.recordMemberMessage("g", "general", "1", now)
+	w.recordMemberMessage("g", "general", "2", now)
+	w.setLeaderboardOptOut("g", "1", true)
+	w.recordMemberMessage("g", "general", "1", now)
+
+	assert.Equal(t, []memberCount{{"2", 1}}, w.topMembers("g", "", 7, 10))
+	assert.Equal(t, 0, w.MemberCounts["g"][0].Users["1"], "counts should be forgotten when opting out")
+
+	w.setLeaderboardOptOut("g", "1", false)
+	w.recordMemberMessage("g", "general", "1", now)
+	assert.Equal(t, []memberCount{{"1", 1}, {"2", 1}}, w.topMembers("g", "", 7, 10))
+}
+
+func TestMemberRetention(t *testing.T) {
+	now := time.Date(2022, time.November, 16, 9, 0, 0, 0, timeZone)
+	w := newTestStatsPlugin(now)
+	for day := 0; day < memberRetention+10; day++ {
+		w.recordMemberMessage("g", "general", "1", now.AddDate(0, 0, -day))
+	}
+	assert.Equal(t, memberRetention, len(w.MemberCounts["g"]))
+	assert.Equal(t, now.Format(bsDateFormat), w.MemberCounts["g"][memberRetention-1].Day)
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/RoaringBitmap/roaring/roaring64"
 	"github.com/bwmarrin/discordgo"
@@ -19,19 +21,61 @@ type StatsPlugin struct {
 	clock        Clock
 	MessageStats map[string]*StatsRecorder
 	GuildStats   map[string]*bitstats.Stats
+	// ChannelStats counts messages in each channel, by guild and channel id.
+	ChannelStats map[string]map[string]*StatsRecorder
+	// History keeps activity rolled up by day, week and month, by guild id.
+	History map[string]*History
+	// MemberCounts holds the messages each member sent per day, by guild id.
+	MemberCounts map[string][]*MemberDay
+	// LeaderboardOptOut holds the members hidden from the leaderboard, by
+	// guild and user id.
+	LeaderboardOptOut map[string]map[string]bool
+	// TimeZones holds the zone each guild's stats are shown in, by guild id.
+	TimeZones map[string]string
+	// StoredInUTC is set once stats are recorded in UTC, older saves used
+	// timeZone.
+	StoredInUTC bool
+	// AccessRules limit who can use /stats, by guild id.
+	AccessRules map[string]*AccessRule
+	// Digests are the stats digests posted to a channel, by guild id.
+	Digests map[string]*Digest
+	// VoiceMinutes counts the minutes spent in voice, by guild id.
+	VoiceMinutes map[string]*StatsRecorder
+	// ChannelVoiceMinutes counts the minutes spent in each voice channel, by
+	// guild and channel id.
+	ChannelVoiceMinutes map[string]map[string]*StatsRecorder
+	// allowedRoles are role names from the bot's config, a guild's access
+	// rule starts with them.
 	allowedRoles map[string][]string
+	roles        *roleCache
+	// voiceSessions holds the open voice sessions, by guild and user id.
+	voiceSessions map[string]*voiceSession
 }
 
 const statsAppCommandName = "stats"
 
 func New(d *bruxism.Discord, allowedRoles map[string][]string) bruxism.Plugin {
-	return &StatsPlugin{
-		discord:      d,
-		clock:        localClock(timeZone),
-		MessageStats: map[string]*StatsRecorder{},
-		allowedRoles: allowedRoles,
-		GuildStats:   map[string]*bitstats.Stats{},
+	w := &StatsPlugin{
+		discord:             d,
+		clock:               localClock(time.UTC),
+		MessageStats:        map[string]*StatsRecorder{},
+		allowedRoles:        allowedRoles,
+		GuildStats:          map[string]*bitstats.Stats{},
+		ChannelStats:        map[string]map[string]*StatsRecorder{},
+		History:             map[string]*History{},
+		MemberCounts:        map[string][]*MemberDay{},
+		LeaderboardOptOut:   map[string]map[string]bool{},
+		TimeZones:           map[string]string{},
+		AccessRules:         map[string]*AccessRule{},
+		Digests:             map[string]*Digest{},
+		VoiceMinutes:        map[string]*StatsRecorder{},
+		ChannelVoiceMinutes: map[string]map[string]*StatsRecorder{},
+		voiceSessions:       map[string]*voiceSession{},
 	}
+	w.roles = newRoleCache(w.clock, func(guildID string) ([]*discordgo.Role, error) {
+		return w.discord.Session.GuildRoles(guildID)
+	})
+	return w
 }
 
 func (w *StatsPlugin) Name() string {
@@ -48,8 +92,38 @@ func (w *StatsPlugin) Load(bot *bruxism.Bot, service bruxism.Service, data []byt
 			log.Println("StatsPlugin: loading data err:", err)
 		}
 	}
+	if w.ChannelStats == nil {
+		w.ChannelStats = map[string]map[string]*StatsRecorder{}
+	}
+	if w.History == nil {
+		w.History = map[string]*History{}
+	}
+	if w.MemberCounts == nil {
+		w.MemberCounts = map[string][]*MemberDay{}
+	}
+	if w.LeaderboardOptOut == nil {
+		w.LeaderboardOptOut = map[string]map[string]bool{}
+	}
+	if w.TimeZones == nil {
+		w.TimeZones = map[string]string{}
+	}
+	if w.AccessRules == nil {
+		w.AccessRules = map[string]*AccessRule{}
+	}
+	if w.Digests == nil {
+		w.Digests = map[string]*Digest{}
+	}
+	if w.VoiceMinutes == nil {
+		w.VoiceMinutes = map[string]*StatsRecorder{}
+	}
+	if w.ChannelVoiceMinutes == nil {
+		w.ChannelVoiceMinutes = map[string]map[string]*StatsRecorder{}
+	}
+	w.migrateToUTC()
+	w.rollupRecent()
 
 	go w.setupListeners()
+	go w.runDigests()
 
 	return nil
 }
@@ -67,8 +141,13 @@ func (w *StatsPlugin) setupListeners() {
 			}
 			log.Print("created stats command:", cmd.ApplicationID, "for guild:", guild.Name)
 		}
+		s.AddHandler(w.reactionAdd)
+		s.AddHandler(w.voiceStateUpdate)
+		s.AddHandler(w.memberAdd)
+		s.AddHandler(w.memberRemove)
+		s.AddHandler(w.threadCreate)
 		w.discord.Session.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-			if i.ApplicationCommandData().Name == statsAppCommandName {
+			if i.Type == discordgo.InteractionApplicationCommand && i.ApplicationCommandData().Name == statsAppCommandName {
 				w.handleStatsCommand(s, i)
 			}
 		})
@@ -80,25 +159,297 @@ func messageStatsCMD() *discordgo.ApplicationCommand {
 		ID:          applicationID,
 		Name:        statsAppCommandName,
 		Description: "Show server stats",
+		// Discord doesn't allow options next to subcommands, so the heatmap
+		// options are under activity.
 		Options: []*discordgo.ApplicationCommandOption{
 			{
-				Type:        discordgo.ApplicationCommandOptionUser,
-				Name:        "user",
-				Description: "Activity matrix for user",
-				Required:    false,
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "activity",
+				Description: "Show server activity",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionUser,
+						Name:        "user",
+						Description: "Activity matrix for user",
+						Required:    false,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionUser,
+						Name:        "user2",
+						Description: "Combine activity with user",
+						Required:    false,
+					},
+					{
+						Type:         discordgo.ApplicationCommandOptionChannel,
+						Name:         "channel",
+						Description:  "Activity matrix for channel and the most active channels",
+						Required:     false,
+						ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "period",
+						Description: "Server totals over a longer period",
+						Required:    false,
+						Choices: []*discordgo.ApplicationCommandOptionChoice{
+							{Name: "This week", Value: periodWeek},
+							{Name: "Last 30 days", Value: period30Days},
+							{Name: "Last quarter", Value: periodQuarter},
+							{Name: "Week over week", Value: periodWeeks},
+							{Name: "Month over month", Value: periodMonths},
+							{Name: "Active users", Value: periodActive},
+						},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "event",
+						Description: "What to plot on the heatmap, messages by default",
+						Required:    false,
+						Choices: []*discordgo.ApplicationCommandOptionChoice{
+							{Name: eventTitles[eventMessage], Value: eventMessage},
+							{Name: eventTitles[eventReaction], Value: eventReaction},
+							{Name: eventTitles[eventVoice], Value: eventVoice},
+							{Name: eventTitles[eventJoin], Value: eventJoin},
+							{Name: eventTitles[eventLeave], Value: eventLeave},
+							{Name: eventTitles[eventThread], Value: eventThread},
+						},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "chart",
+						Description: "Kind of chart to draw",
+						Required:    false,
+						Choices: []*discordgo.ApplicationCommandOptionChoice{
+							{Name: "Weekly heatmap", Value: chartHeatmap},
+							{Name: "Messages per day", Value: chartDaily},
+							{Name: "Hour of day", Value: chartHourly},
+							{Name: "Day of week", Value: chartWeekday},
+							{Name: "Overlap of user and user2", Value: chartOverlap},
+						},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionInteger,
+						Name:        "weeks",
+						Description: "How many weeks the chart covers",
+						Required:    false,
+						MinValue:    &minChartWeeks,
+						MaxValue:    maxChartWeeks,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "tz",
+						Description: "Time zone to show days and hours in, like Europe/Berlin",
+						Required:    false,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "size",
+						Description: "Size of the chart",
+						Required:    false,
+						Choices: []*discordgo.ApplicationCommandOptionChoice{
+							{Name: "Small", Value: "small"},
+							{Name: "Medium", Value: "medium"},
+							{Name: "Large", Value: "large"},
+						},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "format",
+						Description: "Image format of the chart",
+						Required:    false,
+						Choices: []*discordgo.ApplicationCommandOptionChoice{
+							{Name: "PNG", Value: "png"},
+							{Name: "SVG", Value: "svg"},
+						},
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "top",
+				Description: "Show the most active members",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "period",
+						Description: "How far back to count messages",
+						Required:    false,
+						Choices: []*discordgo.ApplicationCommandOptionChoice{
+							{Name: "Today", Value: periodToday},
+							{Name: "Last 7 days", Value: periodWeek},
+							{Name: "Last 30 days", Value: period30Days},
+							{Name: "Last 90 days", Value: period90Days},
+						},
+					},
+					{
+						Type:         discordgo.ApplicationCommandOptionChannel,
+						Name:         "channel",
+						Description:  "Only count messages in channel",
+						Required:     false,
+						ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "export",
+				Description: "Download hourly stats as a file",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "format",
+						Description: "File format",
+						Required:    false,
+						Choices: []*discordgo.ApplicationCommandOptionChoice{
+							{Name: "CSV", Value: exportCSV},
+							{Name: "JSON", Value: exportJSON},
+						},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionInteger,
+						Name:        "period",
+						Description: "How many days to export",
+						Required:    false,
+						MinValue:    &minExportDays,
+						MaxValue:    maxExportDays,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionBoolean,
+						Name:        "user_ids",
+						Description: "Include the ids of the users active each hour, bot owner only",
+						Required:    false,
+					},
+				},
 			},
 			{
-				Type:        discordgo.ApplicationCommandOptionUser,
-				Name:        "user2",
-				Description: "Combine activity with user",
-				Required:    false,
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "timezone",
+				Description: "Show or change the time zone stats are shown in",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "zone",
+						Description: "New time zone, like Europe/Berlin, needs Manage Server",
+						Required:    false,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "access",
+				Description: "Show or change who can use stats, needs Manage Server",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionRole,
+						Name:        "role",
+						Description: "Role that can use stats",
+						Required:    false,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionBoolean,
+						Name:        "remove",
+						Description: "Take the role's access away instead",
+						Required:    false,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "permission",
+						Description: "Members with this permission can use stats",
+						Required:    false,
+						Choices: []*discordgo.ApplicationCommandOptionChoice{
+							{Name: "Manage Server", Value: "manage_server"},
+							{Name: "Manage Channels", Value: "manage_channels"},
+							{Name: "Manage Messages", Value: "manage_messages"},
+							{Name: "Timeout Members", Value: "moderate_members"},
+							{Name: "View Audit Log", Value: "view_audit_log"},
+							{Name: "None", Value: "none"},
+						},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "denial",
+						Description: "Message shown to members that can't use stats",
+						Required:    false,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionBoolean,
+						Name:        "reset",
+						Description: "Go back to the roles from the bot's config, everyone when there are none",
+						Required:    false,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "digest",
+				Description: "Show or change the stats digest posted to a channel",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:         discordgo.ApplicationCommandOptionChannel,
+						Name:         "channel",
+						Description:  "Channel to post the digest in",
+						Required:     false,
+						ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "frequency",
+						Description: "How often to post the digest",
+						Required:    false,
+						Choices: []*discordgo.ApplicationCommandOptionChoice{
+							{Name: "Daily", Value: digestDaily},
+							{Name: "Weekly", Value: digestWeekly},
+							{Name: "Off", Value: digestOff},
+						},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionInteger,
+						Name:        "hour",
+						Description: "Hour of the day to post at, in the server's time zone",
+						Required:    false,
+						MinValue:    &minDigestHour,
+						MaxValue:    23,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "weekday",
+						Description: "Day to post weekly digests on",
+						Required:    false,
+						Choices: []*discordgo.ApplicationCommandOptionChoice{
+							{Name: "Monday", Value: "monday"},
+							{Name: "Tuesday", Value: "tuesday"},
+							{Name: "Wednesday", Value: "wednesday"},
+							{Name: "Thursday", Value: "thursday"},
+							{Name: "Friday", Value: "friday"},
+							{Name: "Saturday", Value: "saturday"},
+							{Name: "Sunday", Value: "sunday"},
+						},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionBoolean,
+						Name:        "preview",
+						Description: "Show the digest now, only to you",
+						Required:    false,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "optout",
+				Description: "Hide yourself from the leaderboard",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionBoolean,
+						Name:        "hidden",
+						Description: "False shows you on the leaderboard again",
+						Required:    false,
+					},
+				},
 			},
 		},
 	}
 }
 
-const protectedServer = "707620933841453186"
-
 func (w *StatsPlugin) handleStatsCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	userID := ""
 	if i.User != nil {
@@ -108,75 +459,76 @@ func (w *StatsPlugin) handleStatsCommand(s *discordgo.Session, i *discordgo.Inte
 		userID = i.Member.User.ID
 	}
 	log.Printf("responding to stats command from guild id: '%s' and user id: '%s'", i.GuildID, userID)
-	if i.GuildID != protectedServer {
-		w.sendStatsResponse(s, i)
-		return
-	}
-	if w.isUserAllowed(i.GuildID, userID) {
-		w.sendStatsResponse(s, i)
-		return
-	} else {
-		guildName := fmt.Sprintf(i.GuildID)
-		g, err := s.Guild(i.GuildID)
-		if err == nil {
-			guildName = g.Name
-		}
 
-		log.Printf("unauthorized user: '%s' requested stats on guild: '%s'", userID, guildName)
-	}
-
-	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-		Type: discordgo.InteractionResponseChannelMessageWithSource,
-		Data: &discordgo.InteractionResponseData{
-			Content: "Statistics is the discipline that concerns the collection, organization, analysis, interpretation, and presentation of data. In applying statistics to a scientific, industrial, or social problem, it is conventional to begin with a statistical population or a statistical model to be studied.",
-			Embeds: []*discordgo.MessageEmbed{
-				{Type: discordgo.EmbedTypeImage,
-					Image: &discordgo.MessageEmbedImage{
-						URL: "https://i.imgur.com/7Plfx7v.jpg",
-					},
-				},
-			},
-		},
-	})
-	if err != nil {
-		log.Print("unable to respond")
-	} else {
-		log.Print("successfully responded to stats")
-	}
-}
-
-func (w *StatsPlugin) isUserAllowed(guildID, userID string) bool {
-	roles, ok := w.allowedRoles[guildID]
-	if !ok {
-		return true
+	options := i.ApplicationCommandData().Options
+	if len(options) > 0 && options[0].Type == discordgo.ApplicationCommandOptionSubCommand {
+		switch options[0].Name {
+		case "optout":
+			w.handleOptOutCommand(s, i, userID, options[0].Options)
+			return
+		case "timezone":
+			w.handleTimeZoneCommand(s, i, userID, options[0].Options)
+			return
+		case "access":
+			w.handleAccessCommand(s, i, userID, options[0].Options)
+			return
+		case "digest":
+			w.handleDigestCommand(s, i, userID, options[0].Options)
+			return
+		}
 	}
-
-	guildRoles := fetchGuildRoles(w.discord.Session, guildID)
-	allowedRoles := filterRoles(guildRoles, roles, guildID)
-
-	guildMember, err := w.discord.Session.GuildMember(guildID, userID)
-	if err != nil {
-		log.Println("unable to get guild member for user:", userID, guildID, err)
-		return false
+	if !w.isAllowed(i) {
+		w.denyAccess(s, i, userID)
+		return
 	}
-
-	for _, userRoleID := range guildMember.Roles {
-		if _, ok := allowedRoles[userRoleID]; ok {
-			return true
+	if len(options) > 0 && options[0].Type == discordgo.ApplicationCommandOptionSubCommand {
+		switch options[0].Name {
+		case "top":
+			w.handleTopCommand(s, i, userID, options[0].Options)
+			return
+		case "export":
+			w.handleExportCommand(s, i, userID, options[0].Options)
+			return
 		}
+		options = options[0].Options
 	}
-	return false
+	w.sendStatsResponse(s, i, options)
 }
 
-func (w *StatsPlugin) sendStatsResponse(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	stats, ok := w.MessageStats[i.GuildID]
+func (w *StatsPlugin) sendStatsResponse(s *discordgo.Session, i *discordgo.InteractionCreate, options []*discordgo.ApplicationCommandInteractionDataOption) {
+	w.Lock()
+	_, ok := w.MessageStats[i.GuildID]
+	w.Unlock()
 	if !ok {
 		w.respondWithError(s, i, "stats not found for guild")
 		return
 	}
 	queryUserID := uint64(0)
 	secondQueryUserID := uint64(0)
-	for _, opt := range i.ApplicationCommandData().Options {
+	channelID := ""
+	period := periodWeek
+	event := eventMessage
+	chart, size, format, tz := "", "", "", ""
+	weeks := int64(0)
+	for _, opt := range options {
+		switch opt.Name {
+		case "channel":
+			channelID = opt.ChannelValue(nil).ID
+		case "period":
+			period = opt.StringValue()
+		case "event":
+			event = opt.StringValue()
+		case "chart":
+			chart = opt.StringValue()
+		case "weeks":
+			weeks = opt.IntValue()
+		case "size":
+			size = opt.StringValue()
+		case "format":
+			format = opt.StringValue()
+		case "tz":
+			tz = opt.StringValue()
+		}
 		if opt.Name == "user" || opt.Name == "user2" {
 			var userID uint64
 			var err error
@@ -196,10 +548,46 @@ func (w *StatsPlugin) sendStatsResponse(s *discordgo.Session, i *discordgo.Inter
 		}
 
 	}
+	chart, chartWeeks, opts := parseChartOptions(chart, weeks, size, format)
+	loc := w.zone(i.GuildID)
+	if tz != "" {
+		var err error
+		if loc, err = loadZone(tz); err != nil {
+			w.respondWithError(s, i, err.Error())
+			return
+		}
+	}
+	if _, ok := eventTitles[event]; !ok {
+		event = eventMessage
+	}
+	if event != eventMessage && (period != periodWeek || chart != chartHeatmap) {
+		w.respondWithError(s, i, "only the weekly heatmap can show "+strings.ToLower(eventTitles[event]))
+		return
+	}
+	if period == periodActive {
+		w.sendActiveResponse(s, i, opts)
+		return
+	}
+	if period != periodWeek {
+		w.sendHistoryResponse(s, i, period)
+		return
+	}
+	eventPrefix := event
+	title := "Server Activity Stats"
+	if event != eventMessage {
+		title = fmt.Sprintf("Server Activity Stats: %s", eventTitles[event])
+	}
+	if channelID != "" {
+		eventPrefix = channelEventPrefix(channelID, eventPrefix)
+		title = fmt.Sprintf("Activity Stats for <#%s>\n\n%s", channelID, channelRankingText(w.topChannels(i.GuildID, topChannelsCount)))
+	}
 	var imgReader io.Reader
 	var err error
-	if queryUserID != 0 {
-		matrix, err := w.statsToMatrix(i.GuildID, string(bruxism.MessageTypeCreate), func(b *roaring64.Bitmap) int {
+	if chart != chartHeatmap {
+		imgReader, err = w.chart(i.GuildID, chart, chartWeeks, [2]uint64{queryUserID, secondQueryUserID}, loc, opts)
+	} else if queryUserID != 0 {
+		var matrix *WeekMsgCountMatrix
+		matrix, err = w.statsToMatrix(i.GuildID, eventPrefix, loc, func(b *roaring64.Bitmap) int {
 			if b.Contains(queryUserID) {
 				if secondQueryUserID != 0 {
 					if b.Contains(secondQueryUserID) {
@@ -212,13 +600,39 @@ func (w *StatsPlugin) sendStatsResponse(s *discordgo.Session, i *discordgo.Inter
 			return 0
 		})
 		if err != nil {
-			log.Printf("unable to plot user %s matrix: %+v", queryUserID, err)
+			log.Printf("unable to plot user %d matrix: %+v", queryUserID, err)
+			w.respondWithError(s, i, "unable to render activity plot: "+err.Error())
+			return
+		}
+		imgReader, err = matrix.Render(opts)
+	} else if event == eventVoice {
+		var matrix *WeekMsgCountMatrix
+		matrix, err = w.voiceMatrix(i.GuildID, channelID, loc)
+		if err != nil {
+			w.respondWithError(s, i, err.Error())
+			return
+		}
+		imgReader, err = matrix.Render(opts)
+	} else if event != eventMessage {
+		var matrix *WeekMsgCountMatrix
+		matrix, err = w.statsToMatrix(i.GuildID, eventPrefix, loc, func(b *roaring64.Bitmap) int {
+			return int(b.GetCardinality())
+		})
+		if err != nil {
 			w.respondWithError(s, i, "unable to render activity plot: "+err.Error())
 			return
 		}
-		imgReader, err = matrix.Plot()
+		imgReader, err = matrix.Render(opts)
+	} else if channelID != "" {
+		var matrix *WeekMsgCountMatrix
+		matrix, err = w.channelMatrix(i.GuildID, channelID, loc)
+		if err != nil {
+			w.respondWithError(s, i, err.Error())
+			return
+		}
+		imgReader, err = matrix.Render(opts)
 	} else {
-		imgReader, err = stats.WeekMatrix().Plot()
+		imgReader, err = w.messageMatrix(i.GuildID, loc).Render(opts)
 	}
 	if err != nil {
 		w.respondWithError(s, i, "unable to render activity plot: "+err.Error())
@@ -227,9 +641,50 @@ func (w *StatsPlugin) sendStatsResponse(s *discordgo.Session, i *discordgo.Inter
 	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
-			Content: "Server Activity Stats",
+			Content: title,
 			Files: []*discordgo.File{
-				{Name: "activity_stats.png", ContentType: "image/png", Reader: imgReader},
+				{Name: opts.fileName("activity_stats"), ContentType: opts.contentType(), Reader: imgReader},
+			},
+		},
+	})
+	if err != nil {
+		log.Print("unable to respond")
+	} else {
+		log.Print("successfully responded to stats")
+	}
+}
+
+func (w *StatsPlugin) sendHistoryResponse(s *discordgo.Session, i *discordgo.InteractionCreate, period string) {
+	text, err := w.historyText(i.GuildID, period)
+	if err != nil {
+		w.respondWithError(s, i, "unable to summarize activity: "+err.Error())
+		return
+	}
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: "Server Activity Stats\n\n" + text,
+		},
+	})
+	if err != nil {
+		log.Print("unable to respond")
+	} else {
+		log.Print("successfully responded to stats")
+	}
+}
+
+func (w *StatsPlugin) sendActiveResponse(s *discordgo.Session, i *discordgo.InteractionCreate, opts chartOptions) {
+	text, imgReader, err := w.activeReport(i.GuildID, opts)
+	if err != nil {
+		w.respondWithError(s, i, "unable to render active users: "+err.Error())
+		return
+	}
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: "Server Activity Stats\n\n" + text,
+			Files: []*discordgo.File{
+				{Name: opts.fileName("active_users"), ContentType: opts.contentType(), Reader: imgReader},
 			},
 		},
 	})
@@ -257,7 +712,12 @@ func (w *StatsPlugin) respondWithError(s *discordgo.Session, i *discordgo.Intera
 func (w *StatsPlugin) Help(bot *bruxism.Bot, service bruxism.Service, message bruxism.Message, detailed bool) []string {
 	return []string{
 		"message stats about the server",
-		bruxism.CommandHelp(service, "stats", "", "To ask the bot to send the current message stats.")[0],
+		bruxism.CommandHelp(service, "stats activity", "[user] [user2] [period] [channel] [event] [chart] [tz]", "To ask the bot to send the current message stats, the options /stats used to take moved here: /stats user:@someone is now /stats activity user:@someone. Event shows reactions, minutes in voice, joins, leaves or threads instead of messages, with a user it shows the hours they were active.")[0],
+		bruxism.CommandHelp(service, "stats top", "[period] [channel]", "Shows the most active members, /stats optout hides you.")[0],
+		bruxism.CommandHelp(service, "stats export", "[format] [period]", "Sends the hourly message and user counts as csv or json.")[0],
+		bruxism.CommandHelp(service, "stats timezone", "[zone]", "Shows or changes the time zone stats are shown in, /stats activity tz picks one just for you.")[0],
+		bruxism.CommandHelp(service, "stats access", "[role] [permission] [denial]", "Shows or changes who can use stats on the server.")[0],
+		bruxism.CommandHelp(service, "stats digest", "[channel] [frequency] [hour]", "Shows or changes the daily or weekly stats digest posted to a channel.")[0],
 	}
 }
 
@@ -265,7 +725,13 @@ func (w *StatsPlugin) Message(bot *bruxism.Bot, service bruxism.Service, message
 	guildID := w.guildID(message)
 	w.recordMessage(guildID, message.Channel(), message.UserID(), message.Type())
 	if message.Type() == bruxism.MessageTypeCreate {
-		w.guildStats(guildID).Increment(w.clock.Now())
+		now := w.clock.Now()
+		w.Lock()
+		w.guildStats(guildID).Increment(now)
+		w.Unlock()
+		w.recordChannelMessage(guildID, message.Channel(), now)
+		w.recordHistory(guildID, message.UserID(), now)
+		w.recordMemberMessage(guildID, message.Channel(), message.UserID(), now)
 	}
 }
 
@@ -278,53 +744,32 @@ func (w *StatsPlugin) guildID(msg bruxism.Message) string {
 	return ch.GuildID
 }
 
+// guildStats returns the guild's message counts, callers hold the lock.
 func (w *StatsPlugin) guildStats(guildID string) *StatsRecorder {
 	if s, ok := w.MessageStats[guildID]; ok {
 		return s
 	}
 
-	s := NewStatsRecorder(localClock(timeZone), 10)
+	s := NewStatsRecorder(localClock(time.UTC), 10)
 	w.MessageStats[guildID] = s
 	return s
 }
 
-func (w *StatsPlugin) Save() ([]byte, error) {
-	return json.Marshal(w)
-}
+// messageMatrix is the weekly message count heatmap for a guild, in loc.
+func (w *StatsPlugin) messageMatrix(guildID string, loc *time.Location) *WeekMsgCountMatrix {
+	w.Lock()
+	defer w.Unlock()
 
-func (w *StatsPlugin) Stats(bot *bruxism.Bot, service bruxism.Service, message bruxism.Message) []string {
-	return nil
+	return w.guildStats(guildID).WeekMatrixIn(loc)
 }
 
-func fetchGuildRoles(session *discordgo.Session, guildID string) map[string]*discordgo.Role {
-	guildMap := map[string]*discordgo.Role{}
-
-	guildRoles, err := session.GuildRoles(guildID)
-	if err != nil {
-		log.Println("unable to get guild roles for guild:", guildID, err)
-		return guildMap
-	}
-
-	for _, role := range guildRoles {
-		guildMap[role.Name] = role
-	}
+func (w *StatsPlugin) Save() ([]byte, error) {
+	w.Lock()
+	defer w.Unlock()
 
-	return guildMap
+	return json.Marshal(w)
 }
 
-func filterRoles(guildRoles map[string]*discordgo.Role, adminRoles []string, guildID string) map[string]*discordgo.Role {
-	allowedRoles := map[string]*discordgo.Role{}
-
-	if len(adminRoles) == 0 {
-		log.Println("no admin roles configured")
-		return allowedRoles
-	}
-
-	for _, allowedRoleName := range adminRoles {
-		if r, ok := guildRoles[allowedRoleName]; ok {
-			allowedRoles[r.ID] = r
-		}
-	}
-
-	return allowedRoles
+func (w *StatsPlugin) Stats(bot *bruxism.Bot, service bruxism.Service, message bruxism.Message) []string {
+	return nil
 }
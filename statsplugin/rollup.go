@@ -0,0 +1,324 @@
+package statsplugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/RoaringBitmap/roaring/roaring64"
+	"github.com/dustin/go-humanize"
+	"github.com/iopred/bruxism"
+	"github.com/pkg/errors"
+)
+
+// how many of each aggregate a History keeps, enough for a year or more of
+// weeks and months.
+const (
+	dailyRetention   = 120
+	weeklyRetention  = 104
+	monthlyRetention = 60
+)
+
+// periods that /stats can summarize besides the weekly heatmap.
+const (
+	periodWeek    = "week"
+	period30Days  = "30d"
+	periodQuarter = "quarter"
+	periodWeeks   = "weeks"
+	periodMonths  = "months"
+)
+
+// userSet is a set of user ids that is saved as base64.
+type userSet struct {
+	*roaring64.Bitmap
+}
+
+func newUserSet() userSet {
+	return userSet{roaring64.New()}
+}
+
+func (u userSet) MarshalJSON() ([]byte, error) {
+	if u.Bitmap == nil {
+		return json.Marshal("")
+	}
+	s, err := u.ToBase64()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to encode users")
+	}
+	return json.Marshal(s)
+}
+
+func (u *userSet) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	u.Bitmap = roaring64.New()
+	if s == "" {
+		return nil
+	}
+	_, err := u.FromBase64(s)
+	return errors.Wrap(err, "unable to decode users")
+}
+
+// An Aggregate is the activity in a day, week or month.
+type Aggregate struct {
+	// Start is the date the day, week or month starts on.
+	Start    string
+	Messages int
+	// Hourly is the messages sent in each hour of the day.
+	Hourly [24]int
+	Users  userSet
+}
+
+// A History keeps a guild's activity rolled up by day, week and month. Only
+// the most recent aggregates are kept so that it doesn't grow forever.
+type History struct {
+	Daily   []*Aggregate
+	Weekly  []*Aggregate
+	Monthly []*Aggregate
+}
+
+func dayStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// weekStart returns the Monday t is in.
+func weekStart(t time.Time) time.Time {
+	return dayStart(t).AddDate(0, 0, -(int(t.Weekday())+6)%7)
+}
+
+func monthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+// Add records messages sent at t by a user, a zero user only adds to the
+// message count.
+func (h *History) Add(t time.Time, userID uint64, messages int) {
+	users := roaring64.New()
+	if userID != 0 {
+		users.Add(userID)
+	}
+	h.Rollup(t, messages, users)
+}
+
+// Rollup adds activity that happened at t to the day, week and month it is
+// in, in UTC.
+func (h *History) Rollup(t time.Time, messages int, users *roaring64.Bitmap) {
+	t = t.UTC()
+	h.Daily = rollup(h.Daily, dayStart(t), t.Hour(), messages, users, dailyRetention)
+	h.Weekly = rollup(h.Weekly, weekStart(t), t.Hour(), messages, users, weeklyRetention)
+	h.Monthly = rollup(h.Monthly, monthStart(t), t.Hour(), messages, users, monthlyRetention)
+}
+
+func rollup(aggregates []*Aggregate, start time.Time, hour, messages int, users *roaring64.Bitmap, retention int) []*Aggregate {
+	key := start.Format(bsDateFormat)
+	// aggregates are kept in order, activity is almost always in the last one
+	i := sort.Search(len(aggregates), func(i int) bool { return aggregates[i].Start >= key })
+	if i == len(aggregates) || aggregates[i].Start != key {
+		aggregates = append(aggregates, nil)
+		copy(aggregates[i+1:], aggregates[i:])
+		aggregates[i] = &Aggregate{Start: key, Users: newUserSet()}
+	}
+	aggregates[i].Messages += messages
+	aggregates[i].Hourly[hour] += messages
+	if aggregates[i].Users.Bitmap == nil {
+		aggregates[i].Users = newUserSet()
+	}
+	aggregates[i].Users.Or(users)
+
+	if len(aggregates) > retention {
+		aggregates = aggregates[len(aggregates)-retention:]
+	}
+	return aggregates
+}
+
+// A Summary is the activity between two times.
+type Summary struct {
+	From     time.Time
+	To       time.Time
+	Messages int
+	Users    uint64
+}
+
+// sum adds up the aggregates that start from from until, but not including,
+// to.
+func sum(aggregates []*Aggregate, from, to time.Time) Summary {
+	s := Summary{From: from, To: to}
+	users := roaring64.New()
+	fromKey, toKey := from.Format(bsDateFormat), to.Format(bsDateFormat)
+	for _, a := range aggregates {
+		if a.Start < fromKey || a.Start >= toKey {
+			continue
+		}
+		s.Messages += a.Messages
+		if a.Users.Bitmap != nil {
+			users.Or(a.Users.Bitmap)
+		}
+	}
+	s.Users = users.GetCardinality()
+	return s
+}
+
+// LastDays summarizes the last n days including today, and the n days before
+// them.
+func (h *History) LastDays(now time.Time, n int) (Summary, Summary) {
+	to := dayStart(now).AddDate(0, 0, 1)
+	from := to.AddDate(0, 0, -n)
+	return sum(h.Daily, from, to), sum(h.Daily, from.AddDate(0, 0, -n), from)
+}
+
+// LastQuarter summarizes the last complete calendar quarter and the one
+// before it.
+func (h *History) LastQuarter(now time.Time) (Summary, Summary) {
+	start := monthStart(now)
+	to := start.AddDate(0, -(int(start.Month())-1)%3, 0)
+	from := to.AddDate(0, -3, 0)
+	return sum(h.Monthly, from, to), sum(h.Monthly, from.AddDate(0, -3, 0), from)
+}
+
+// Weeks summarizes the last n weeks, oldest first, the current week included.
+func (h *History) Weeks(now time.Time, n int) []Summary {
+	summaries := []Summary{}
+	start := weekStart(now).AddDate(0, 0, -7*(n-1))
+	for i := 0; i < n; i++ {
+		summaries = append(summaries, sum(h.Weekly, start, start.AddDate(0, 0, 7)))
+		start = start.AddDate(0, 0, 7)
+	}
+	return summaries
+}
+
+// Months summarizes the last n months, oldest first, the current month
+// included.
+func (h *History) Months(now time.Time, n int) []Summary {
+	summaries := []Summary{}
+	start := monthStart(now).AddDate(0, -(n - 1), 0)
+	for i := 0; i < n; i++ {
+		summaries = append(summaries, sum(h.Monthly, start, start.AddDate(0, 1, 0)))
+		start = start.AddDate(0, 1, 0)
+	}
+	return summaries
+}
+
+// change describes how cur compares to prev as a percentage.
+func change(cur, prev int) string {
+	if prev == 0 {
+		if cur == 0 {
+			return "no change"
+		}
+		return "new"
+	}
+	return fmt.Sprintf("%+.0f%%", float64(cur-prev)/float64(prev)*100)
+}
+
+func summaryLine(label string, s Summary) string {
+	return fmt.Sprintf("%s: %s messages from %s users", label, humanize.Comma(int64(s.Messages)), humanize.Comma(int64(s.Users)))
+}
+
+func comparisonText(label, prevLabel string, cur, prev Summary) string {
+	return fmt.Sprintf("%s\n%s\nChange: %s messages, %s users",
+		summaryLine(label, cur), summaryLine(prevLabel, prev),
+		change(cur.Messages, prev.Messages), change(int(cur.Users), int(prev.Users)))
+}
+
+func seriesText(summaries []Summary, label func(Summary) string) string {
+	lines := []string{}
+	for i, s := range summaries {
+		line := summaryLine(label(s), s)
+		if i > 0 {
+			line += fmt.Sprintf(" (%s)", change(s.Messages, summaries[i-1].Messages))
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// periodText summarizes a guild's history over one of the periods.
+func (h *History) periodText(period string, now time.Time) (string, error) {
+	switch period {
+	case period30Days:
+		cur, prev := h.LastDays(now, 30)
+		return comparisonText("Last 30 days", "Previous 30 days", cur, prev), nil
+	case periodQuarter:
+		cur, prev := h.LastQuarter(now)
+		return comparisonText(quarterName(cur.From), quarterName(prev.From), cur, prev), nil
+	case periodWeeks:
+		return seriesText(h.Weeks(now, 12), func(s Summary) string { return "Week of " + s.From.Format("2 Jan") }), nil
+	case periodMonths:
+		return seriesText(h.Months(now, 12), func(s Summary) string { return s.From.Format("Jan 2006") }), nil
+	}
+	return "", errors.Errorf("unknown period %s", period)
+}
+
+func quarterName(start time.Time) string {
+	return fmt.Sprintf("Q%d %d", (int(start.Month())-1)/3+1, start.Year())
+}
+
+func (w *StatsPlugin) recordHistory(guildID, userID string, t time.Time) {
+	usrID, err := parseUserID(userID)
+	if err != nil {
+		return
+	}
+	w.Lock()
+	defer w.Unlock()
+
+	h, ok := w.History[guildID]
+	if !ok {
+		h = &History{}
+		w.History[guildID] = h
+	}
+	h.Add(t, usrID, 1)
+}
+
+// rollupRecent builds the history of guilds that don't have one from the
+// hourly stats that are still around.
+func (w *StatsPlugin) rollupRecent() {
+	w.Lock()
+	defer w.Unlock()
+
+	for guildID, recorder := range w.MessageStats {
+		if _, ok := w.History[guildID]; ok || recorder.dayBuckets == nil {
+			continue
+		}
+		h := &History{}
+		recorder.dayBuckets.Do(func(v interface{}) {
+			if b, ok := v.(*dayBucket); ok {
+				year, month, day := b.End.Date()
+				for hour, count := range b.Hourly {
+					h.Rollup(time.Date(year, month, day, hour, 0, 0, 0, b.End.Location()), count, roaring64.New())
+				}
+			}
+		})
+		if stats, ok := w.GuildStats[guildID]; ok {
+			for _, part := range stats.Partitions() {
+				day, err := time.Parse(bsDateFormat, part)
+				if err != nil {
+					continue
+				}
+				events, ok := stats.EventsByPrefix(part, string(bruxism.MessageTypeCreate))
+				if !ok {
+					continue
+				}
+				for _, event := range events {
+					if vals, ok := stats.ValuesSet(part, event); ok {
+						h.Rollup(day, 0, vals)
+					}
+				}
+			}
+		}
+		w.History[guildID] = h
+	}
+}
+
+func (w *StatsPlugin) historyText(guildID, period string) (string, error) {
+	w.Lock()
+	defer w.Unlock()
+
+	h, ok := w.History[guildID]
+	if !ok {
+		return "", errors.New("no history for this server yet")
+	}
+	return h.periodText(period, w.clock.Now().UTC())
+}
@@ -0,0 +1,92 @@
+package statsplugin
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistoryRetention(t *testing.T) {
+	start := time.Date(2021, time.January, 1, 12, 0, 0, 0, timeZone)
+	h := &History{}
+	for day := 0; day < 3*365; day++ {
+		h.Add(start.AddDate(0, 0, day), uint64(day%5+1), 2)
+	}
+
+	assert.Equal(t, dailyRetention, len(h.Daily))
+	assert.Equal(t, weeklyRetention, len(h.Weekly))
+	assert.Equal(t, 36, len(h.Monthly))
+	assert.Equal(t, "2021-01-01", h.Monthly[0].Start)
+	assert.Equal(t, 62, h.Monthly[0].Messages)
+	assert.Equal(t, uint64(5), h.Monthly[0].Users.GetCardinality())
+
+	for _, a := range h.Weekly {
+		start, err := time.Parse(bsDateFormat, a.Start)
+		assert.Nil(t, err)
+		assert.Equal(t, time.Monday, start.Weekday())
+	}
+}
+
+func TestHistoryPeriods(t *testing.T) {
+	now := time.Date(2022, time.November, 15, 9, 0, 0, 0, timeZone)
+	h := &History{}
+	for day := 0; day < 200; day++ {
+		when := now.AddDate(0, 0, -day)
+		h.Add(when, 1, 1)
+		if day < 30 {
+			h.Add(when, 2, 1)
+		}
+	}
+
+	cur, prev := h.LastDays(now, 30)
+	assert.Equal(t, 60, cur.Messages)
+	assert.Equal(t, uint64(2), cur.Users)
+	assert.Equal(t, 30, prev.Messages)
+	assert.Equal(t, uint64(1), prev.Users)
+
+	cur, prev = h.LastQuarter(now)
+	assert.Equal(t, "Q3 2022", quarterName(cur.From))
+	assert.Equal(t, 31+31+30, cur.Messages)
+	assert.Equal(t, "Q2 2022", quarterName(prev.From))
+
+	months := h.Months(now, 12)
+	assert.Equal(t, 12, len(months))
+	assert.Equal(t, time.November, months[11].From.Month())
+	assert.Equal(t, 0, months[0].Messages)
+
+	weeks := h.Weeks(now, 12)
+	assert.Equal(t, 12, len(weeks))
+	assert.Equal(t, 14, weeks[10].Messages)
+
+	text, err := h.periodText(period30Days, now)
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(text, "Change: +100% messages, +100% users"), text)
+	_, err = h.periodText("decade", now)
+	assert.NotNil(t, err)
+}
+
+func TestHistoryMarshaling(t *testing.T) {
+	h := &History{}
+	now := time.Date(2022, time.November, 15, 9, 0, 0, 0, timeZone)
+	h.Add(now, 1, 1)
+	h.Add(now, 2, 1)
+
+	data, err := json.Marshal(h)
+	assert.Nil(t, err)
+	loaded := &History{}
+	assert.Nil(t, json.Unmarshal(data, loaded))
+
+	cur, _ := loaded.LastDays(now, 30)
+	assert.Equal(t, 2, cur.Messages)
+	assert.Equal(t, uint64(2), cur.Users)
+}
+
+func TestChange(t *testing.T) {
+	assert.Equal(t, "+50%", change(150, 100))
+	assert.Equal(t, "-25%", change(75, 100))
+	assert.Equal(t, "new", change(5, 0))
+	assert.Equal(t, "no change", change(0, 0))
+}
@@ -1,25 +1,24 @@
 package statsplugin
 
 import (
-	"bytes"
 	"container/ring"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"math"
 	"sort"
 	"strings"
 	"time"
 
-	"github.com/pkg/errors"
 	"gonum.org/v1/plot"
 	"gonum.org/v1/plot/palette/brewer"
 	"gonum.org/v1/plot/plotter"
 	"gonum.org/v1/plot/vg"
 )
 
-var timeZone *time.Location = loadLocation("America/Vancouver") // where this bot works
+// timeZone is where this bot works, stats are shown in it unless a guild
+// picks another zone. Saves from before stats were kept in UTC used it too.
+var timeZone *time.Location = loadLocation("America/Vancouver")
 
 type Clock interface {
 	Now() time.Time
@@ -61,17 +60,77 @@ func NewStatsRecorder(clock Clock, days int) *StatsRecorder {
 }
 
 func (s *StatsRecorder) Increment(t time.Time) {
+	s.add(t, 1)
+}
+
+// add counts messages in the day and hour t is in, in the recorder's zone.
+// Earlier days are added to while they are kept.
+func (s *StatsRecorder) add(t time.Time, c int) {
+	t = t.In(s.location())
 	if s.dayBuckets == nil {
 		s.dayBuckets = ring.New(s.Days)
 	}
 	if s.dayBuckets.Value == nil {
 		s.dayBuckets.Value = newBucket(t)
 	}
-	for !s.curBucket().Add(t, 1) {
+	if t.Before(dayStart(s.curBucket().End)) {
+		if b := s.pastBucket(t); b != nil {
+			b.Add(t, c)
+		}
+		return
+	}
+	for !s.curBucket().Add(t, c) {
 		s.moveBucketForward()
 	}
 }
 
+// pastBucket returns the bucket of the day before the current one t is in,
+// nil once that day isn't kept.
+func (s *StatsRecorder) pastBucket(t time.Time) *dayBucket {
+	for r := s.dayBuckets.Prev(); r != s.dayBuckets; r = r.Prev() {
+		b, ok := r.Value.(*dayBucket)
+		if !ok {
+			return nil
+		}
+		if daysBetween(b.End, t) == 0 {
+			return b
+		}
+	}
+	return nil
+}
+
+// location is the zone the recorder's days and hours are in.
+func (s *StatsRecorder) location() *time.Location {
+	if s.clock == nil {
+		return timeZone
+	}
+	return s.clock.Now().Location()
+}
+
+// inZone copies the recorder into a new one that keeps its days in loc.
+func (s *StatsRecorder) inZone(loc *time.Location) *StatsRecorder {
+	r := NewStatsRecorder(localClock(loc), s.Days)
+	if s.dayBuckets == nil {
+		return r
+	}
+	buckets := []*dayBucket{}
+	s.dayBuckets.Do(func(v interface{}) {
+		if b, ok := v.(*dayBucket); ok {
+			buckets = append(buckets, b)
+		}
+	})
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].End.Before(buckets[j].End) })
+	for _, b := range buckets {
+		year, month, day := b.End.Date()
+		for hour, c := range b.Hourly {
+			if c > 0 {
+				r.add(time.Date(year, month, day, hour, 0, 0, 0, b.End.Location()), c)
+			}
+		}
+	}
+	return r
+}
+
 func (s *StatsRecorder) Today() int {
 	if s.dayBuckets == nil {
 		return 0
@@ -110,10 +169,17 @@ func (s *StatsRecorder) Week() int {
 	return count
 }
 func (s *StatsRecorder) WeekMatrix() *WeekMsgCountMatrix {
-	weekDate := s.clock.Now().Add(-6 * 24 * time.Hour)
+	return s.WeekMatrixIn(s.location())
+}
+
+// WeekMatrixIn is the last week's message counts with the days and hours in
+// loc. Every hour is converted on its own so days that change to or from
+// daylight saving time line up.
+func (s *StatsRecorder) WeekMatrixIn(loc *time.Location) *WeekMsgCountMatrix {
+	now := s.clock.Now().In(loc)
 	result := &WeekMsgCountMatrix{
 		matrix:    [7][24]int{},
-		startDate: weekDate,
+		startDate: now.AddDate(0, 0, -6),
 	}
 	if s.dayBuckets == nil {
 		return result
@@ -128,13 +194,15 @@ func (s *StatsRecorder) WeekMatrix() *WeekMsgCountMatrix {
 			return
 		}
 
-		dayDiff := int(b.End.Sub(weekDate).Hours() / 24)
-		if dayDiff < 0 || dayDiff >= 7 {
-			log.Printf("date diff %d is not in range [0, 6]: %s", dayDiff, b.End.Format("2-Jan"))
-			return
+		year, month, day := b.End.Date()
+		for hour, c := range b.Hourly {
+			t := time.Date(year, month, day, hour, 0, 0, 0, b.End.Location()).In(loc)
+			dayIndex := 6 - daysBetween(t, now)
+			if c == 0 || dayIndex < 0 || dayIndex >= 7 {
+				continue
+			}
+			result.matrix[dayIndex][t.Hour()] += c
 		}
-
-		result.matrix[dayDiff] = b.Hourly
 	})
 	return result
 }
@@ -191,13 +259,16 @@ type bucketSpec struct {
 }
 
 type statsSpec struct {
-	Days    int
+	Days int
+	// Zone is the zone of the buckets' days, older saves are in timeZone.
+	Zone    string
 	Buckets []bucketSpec
 }
 
 func (s StatsRecorder) MarshalJSON() ([]byte, error) {
 	statsSpec := statsSpec{
 		Days:    s.Days,
+		Zone:    s.location().String(),
 		Buckets: []bucketSpec{},
 	}
 
@@ -220,9 +291,17 @@ func (s *StatsRecorder) UnmarshalJSON(b []byte) error {
 	if err := json.Unmarshal(b, &spec); err != nil {
 		return err
 	}
+	zone := timeZone
+	if spec.Zone != "" {
+		loc, err := time.LoadLocation(spec.Zone)
+		if err != nil {
+			return err
+		}
+		zone = loc
+	}
 	s.Days = spec.Days
 	s.dayBuckets = ring.New(s.Days)
-	s.clock = localClock(timeZone)
+	s.clock = localClock(zone)
 
 	sort.Slice(spec.Buckets, func(i, j int) bool { return spec.Buckets[i].End.Before(spec.Buckets[j].End) })
 
@@ -230,7 +309,7 @@ func (s *StatsRecorder) UnmarshalJSON(b []byte) error {
 		s.dayBuckets = s.dayBuckets.Next()
 		s.dayBuckets.Value = &dayBucket{
 			Count:  bs.Count,
-			End:    bs.End.In(timeZone),
+			End:    bs.End.In(zone),
 			Hourly: bs.Hourly,
 		}
 	}
@@ -282,11 +361,16 @@ func (m *WeekMsgCountMatrix) Z(c, r int) float64 {
 }
 
 func (m *WeekMsgCountMatrix) Plot() (io.Reader, error) {
+	return m.Render(defaultChart)
+}
+
+// Render draws the heatmap with the chart options.
+func (m *WeekMsgCountMatrix) Render(opts chartOptions) (io.Reader, error) {
 	days := make([]string, 7)
 	timeIter := m.startDate
 	for i := range days {
 		days[i] = timeIter.Format("2-Jan")
-		timeIter = timeIter.Add(24 * time.Hour)
+		timeIter = timeIter.AddDate(0, 0, 1)
 	}
 
 	colorpalette, err := brewer.GetPalette(brewer.TypeSequential, "YlGnBu", 9)
@@ -295,22 +379,13 @@ func (m *WeekMsgCountMatrix) Plot() (io.Reader, error) {
 	}
 	hm := plotter.NewHeatMap(m, colorpalette)
 	pt := plot.New()
-	pt.Title.Text = "Weekly Activity"
+	pt.Title.Text = fmt.Sprintf("Weekly Activity (%s)", m.startDate.Location())
 	// pt.X.Label.Text = "Days"
 	// pt.Y.Label.Text = "Hours"
 	pt.X.Tick.Marker = ticks(days)
 	pt.Y.Tick.Marker = ticks(genHours())
 	pt.Add(hm)
-	wt, err := pt.WriterTo(7*vg.Inch, 7*vg.Inch, "png")
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to create plot writer")
-	}
-	buf := bytes.Buffer{}
-	_, err = wt.WriteTo(&buf)
-	if err != nil {
-		return nil, errors.Wrapf(err, "unable to writer plot to buffer")
-	}
-	return &buf, nil
+	return render(pt, 7*vg.Inch, 7*vg.Inch, opts)
 }
 
 func genHours() []string {
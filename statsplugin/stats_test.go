@@ -188,7 +188,7 @@ func TestStatsToMatrix(t *testing.T) {
 	if !assert.Nil(t, err) {
 		return
 	}
-	matrix, err := plugin.statsToMatrix("707620933841453186", "create", func(vals *roaring64.Bitmap) int {
+	matrix, err := plugin.statsToMatrix("707620933841453186", "create", timeZone, func(vals *roaring64.Bitmap) int {
 		return int(vals.GetCardinality())
 	})
 	assert.Nil(t, err)
@@ -0,0 +1,129 @@
+package statsplugin
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/RoaringBitmap/roaring/roaring64"
+	"github.com/bwmarrin/discordgo"
+	"github.com/pkg/errors"
+)
+
+// loadZone looks up a zone by its IANA name, like Europe/Berlin.
+func loadZone(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || name == "Local" {
+		return nil, errors.Errorf("unknown time zone %q, use a name like America/Vancouver or UTC", name)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, errors.Errorf("unknown time zone %q, use a name like America/Vancouver or UTC", name)
+	}
+	return loc, nil
+}
+
+// zone is the zone a guild's stats are shown in by default.
+func (w *StatsPlugin) zone(guildID string) *time.Location {
+	w.Lock()
+	name, ok := w.TimeZones[guildID]
+	w.Unlock()
+	if !ok {
+		return timeZone
+	}
+	loc, err := loadZone(name)
+	if err != nil {
+		log.Printf("guild %s has an invalid time zone: %v", guildID, err)
+		return timeZone
+	}
+	return loc
+}
+
+// migrateToUTC moves stats saved before they were kept in UTC out of
+// timeZone. The member counts per day are left as they are.
+func (w *StatsPlugin) migrateToUTC() {
+	w.Lock()
+	defer w.Unlock()
+
+	for guildID, s := range w.MessageStats {
+		if s.location() != time.UTC {
+			w.MessageStats[guildID] = s.inZone(time.UTC)
+		}
+	}
+	for _, channels := range w.ChannelStats {
+		for channelID, s := range channels {
+			if s.location() != time.UTC {
+				channels[channelID] = s.inZone(time.UTC)
+			}
+		}
+	}
+	if w.StoredInUTC {
+		return
+	}
+	for guildID, stats := range w.GuildStats {
+		w.GuildStats[guildID] = toUTC(stats, timeZone)
+	}
+	for _, h := range w.History {
+		h.Daily = dailyToUTC(h.Daily, timeZone)
+	}
+	w.StoredInUTC = true
+	log.Println("StatsPlugin: moved stats to UTC")
+}
+
+// dailyToUTC moves daily aggregates from loc to UTC hour by hour. The users
+// of a day stay on the same date.
+func dailyToUTC(daily []*Aggregate, loc *time.Location) []*Aggregate {
+	converted := []*Aggregate{}
+	for _, a := range daily {
+		day, err := time.ParseInLocation(bsDateFormat, a.Start, loc)
+		if err != nil {
+			continue
+		}
+		for hour, c := range a.Hourly {
+			if c > 0 {
+				t := time.Date(day.Year(), day.Month(), day.Day(), hour, 0, 0, 0, loc).UTC()
+				converted = rollup(converted, dayStart(t), t.Hour(), c, roaring64.New(), dailyRetention)
+			}
+		}
+		if a.Users.Bitmap != nil {
+			start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+			converted = rollup(converted, start, 0, 0, a.Users.Bitmap, dailyRetention)
+		}
+	}
+	return converted
+}
+
+func isAdmin(i *discordgo.InteractionCreate) bool {
+	return i.Member != nil && i.Member.Permissions&discordgo.PermissionManageServer != 0
+}
+
+// handleTimeZoneCommand shows or, for admins, changes the guild's default
+// zone.
+func (w *StatsPlugin) handleTimeZoneCommand(s *discordgo.Session, i *discordgo.InteractionCreate, userID string, options []*discordgo.ApplicationCommandInteractionDataOption) {
+	name := ""
+	for _, opt := range options {
+		if opt.Name == "zone" {
+			name = opt.StringValue()
+		}
+	}
+	if name == "" {
+		w.respondEphemeral(s, i, fmt.Sprintf("Stats are shown in %s.", w.zone(i.GuildID)))
+		return
+	}
+	if !isAdmin(i) {
+		log.Printf("unauthorized user: '%s' tried to change the time zone of guild: '%s'", userID, i.GuildID)
+		w.respondEphemeral(s, i, "You need the Manage Server permission to change the time zone.")
+		return
+	}
+	loc, err := loadZone(name)
+	if err != nil {
+		w.respondEphemeral(s, i, err.Error())
+		return
+	}
+
+	w.Lock()
+	w.TimeZones[i.GuildID] = loc.String()
+	w.Unlock()
+	w.respondEphemeral(s, i, fmt.Sprintf("Stats will be shown in %s.", loc))
+}
@@ -0,0 +1,115 @@
+package statsplugin
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/RoaringBitmap/roaring/roaring64"
+	"github.com/stretchr/testify/assert"
+	"github.com/voldyman/bitstats"
+)
+
+// Daylight saving time ended in Vancouver on 2022-11-06, 01:30 happened twice.
+var (
+	firstOneThirty  = time.Date(2022, time.November, 6, 8, 30, 0, 0, time.UTC)
+	secondOneThirty = time.Date(2022, time.November, 6, 9, 30, 0, 0, time.UTC)
+	dayAfterDST     = time.Date(2022, time.November, 7, 12, 0, 0, 0, time.UTC)
+)
+
+func TestStatsToMatrixZones(t *testing.T) {
+	w := newTestStatsPlugin(dayAfterDST)
+	w.recordEvent("g", "", "1", eventMessage, firstOneThirty)
+	w.recordEvent("g", "", "2", eventMessage, secondOneThirty)
+	count := func(b *roaring64.Bitmap) int { return int(b.GetCardinality()) }
+
+	vancouver, err := w.statsToMatrix("g", eventMessage, timeZone, count)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, vancouver.matrix[5][1], "both hours are 1am in Vancouver")
+	assert.Equal(t, 2, sumDay(vancouver.matrix[5]))
+
+	utc, err := w.statsToMatrix("g", eventMessage, time.UTC, count)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 1}, utc.matrix[5][8:10])
+
+	kolkata, err := w.statsToMatrix("g", eventMessage, loadLocation("Asia/Kolkata"), count)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 1}, kolkata.matrix[5][13:15], "hours start half way through in Kolkata")
+}
+
+func TestWeekMatrixIn(t *testing.T) {
+	s := NewStatsRecorder(&fixedClock{now: dayAfterDST}, 10)
+	s.Increment(firstOneThirty)
+	s.Increment(secondOneThirty)
+	s.Increment(secondOneThirty)
+
+	assert.Equal(t, 3, s.WeekMatrixIn(timeZone).matrix[5][1])
+	assert.Equal(t, []int{1, 2}, s.WeekMatrixIn(time.UTC).matrix[5][8:10])
+	assert.Equal(t, "2022-11-01", s.WeekMatrixIn(timeZone).startDate.Format(bsDateFormat))
+}
+
+func TestMigrateToUTC(t *testing.T) {
+	evening := time.Date(2022, time.November, 6, 20, 15, 0, 0, timeZone)
+	w := newTestStatsPlugin(evening)
+
+	stats := bitstats.New()
+	stats.Add("2022-11-06", "create:20", 1)
+	stats.Add("2022-11-06", channelEventPrefix("c", "create")+"20", 1)
+	w.GuildStats["g"] = stats
+	recorder := NewStatsRecorder(&fixedClock{now: evening}, 10)
+	recorder.Increment(evening)
+	w.MessageStats["g"] = recorder
+	w.History["g"] = &History{Daily: []*Aggregate{{Start: "2022-11-06", Messages: 3, Hourly: [24]int{20: 3}, Users: newUserSet()}}}
+	w.History["g"].Daily[0].Users.Add(1)
+
+	w.migrateToUTC()
+	assert.True(t, w.StoredInUTC)
+
+	events, ok := w.GuildStats["g"].EventsByPrefix("2022-11-07", "")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"channel:c:create:04", "create:04"}, events)
+	assert.Equal(t, time.UTC, w.MessageStats["g"].location())
+	assert.Equal(t, [24]int{4: 1}, w.MessageStats["g"].curBucket().Hourly)
+
+	daily := w.History["g"].Daily
+	assert.Equal(t, 2, len(daily))
+	assert.Equal(t, "2022-11-06", daily[0].Start, "users stay on their date")
+	assert.Equal(t, uint64(1), daily[0].Users.GetCardinality())
+	assert.Equal(t, "2022-11-07", daily[1].Start)
+	assert.Equal(t, 3, daily[1].Hourly[4])
+
+	w.migrateToUTC()
+	assert.Equal(t, 2, len(w.History["g"].Daily), "stats are only moved once")
+}
+
+func TestRecorderZoneMarshaling(t *testing.T) {
+	s := NewStatsRecorder(&fixedClock{now: dayAfterDST}, 10)
+	s.Increment(dayAfterDST)
+	data, err := json.Marshal(s)
+	assert.Nil(t, err)
+
+	loaded := &StatsRecorder{}
+	assert.Nil(t, json.Unmarshal(data, loaded))
+	assert.Equal(t, time.UTC, loaded.location())
+
+	legacy := &StatsRecorder{}
+	assert.Nil(t, json.Unmarshal([]byte(`{"Days":10,"Buckets":[{"Count":2,"Hourly":[0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,2,0,0,0,0],"End":"2022-09-26T23:57:26.599272-07:00"}]}`), legacy))
+	assert.Equal(t, timeZone, legacy.location())
+}
+
+func TestLoadZone(t *testing.T) {
+	loc, err := loadZone(" Europe/Berlin ")
+	assert.Nil(t, err)
+	assert.Equal(t, "Europe/Berlin", loc.String())
+
+	for _, name := range []string{"", "Local", "Mars/Olympus"} {
+		_, err := loadZone(name)
+		assert.NotNil(t, err, name)
+	}
+
+	w := newTestStatsPlugin(dayAfterDST)
+	w.TimeZones = map[string]string{"g": "Europe/Berlin", "broken": "Mars/Olympus"}
+	assert.Equal(t, "Europe/Berlin", w.zone("g").String())
+	assert.Equal(t, timeZone, w.zone("broken"))
+	assert.Equal(t, timeZone, w.zone("other"))
+}